@@ -7,6 +7,8 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"strings"
@@ -16,6 +18,7 @@ import (
 	"github.com/fsnotify/fsnotify"
 	"github.com/nuigcompsoc/api/internal/config"
 	"github.com/nuigcompsoc/api/internal/server"
+	"github.com/nuigcompsoc/api/internal/services"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
@@ -34,6 +37,27 @@ func init() {
 	viper.SetDefault("http.listen_address", ":80")
 	viper.SetDefault("http.cors.allowed_origins", []string{"*"})
 
+	viper.SetDefault("admin.tokens", map[string]string{})
+
+	viper.SetDefault("scheduler.lock_ttl", time.Minute)
+	viper.SetDefault("scheduler.sync.upcoming_behind", 24*time.Hour)
+	viper.SetDefault("scheduler.sync.upcoming_ahead", 365*24*time.Hour)
+	viper.SetDefault("scheduler.sync.history", 0)
+	viper.SetDefault("scheduler.sync.full_sync_max_age", 2*time.Hour)
+	viper.SetDefault("scheduler.jobs", map[string]config.JobConfig{})
+
+	viper.SetDefault("metrics.listen_address", "")
+
+	viper.SetDefault("database.driver", "mongo")
+	viper.SetDefault("database.dsn", "")
+	viper.SetDefault("database.migrate_on_startup", true)
+	viper.SetDefault("database.query_timeout", 30*time.Second)
+
+	viper.SetDefault("tracing.exporter", "none")
+	viper.SetDefault("tracing.otlp_endpoint", "localhost:4318")
+	viper.SetDefault("tracing.insecure", false)
+	viper.SetDefault("tracing.sample_ratio", 1.0)
+
 	// Config file loading
 	viper.SetConfigType("yaml")
 	viper.SetConfigName("api")
@@ -58,18 +82,23 @@ func init() {
 	}
 }
 
-func reload() {
-	if srv != nil {
-		stop()
-		srv = nil
-	}
-
+func loadConfig() config.Config {
 	var cfg config.Config
 	if err := viper.Unmarshal(&cfg, config.DecoderOptions); err != nil {
 		log.WithField("err", err).Fatal("Failed to parse configuration")
 	}
 
 	log.SetLevel(cfg.LogLevel)
+	return cfg
+}
+
+func reload() {
+	if srv != nil {
+		stop()
+		srv = nil
+	}
+
+	cfg := loadConfig()
 	cJSON, err := json.Marshal(cfg)
 	if err != nil {
 		log.WithError(err).Fatal("Failed to encode config as JSON")
@@ -100,7 +129,67 @@ func stop() {
 	log.Info("Stopped server sucessfully")
 }
 
+// Brings the datastore's schema up to date and exits, for deployments that
+// set database.migrate_on_startup to false
+func migrate() {
+	cfg := loadConfig()
+
+	ctx := context.Background()
+	datastore, err := services.OpenDatastore(ctx, &cfg)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to create Datastore")
+	}
+	if err := datastore.Migrate(ctx); err != nil {
+		log.WithError(err).Fatal("Failed to migrate Datastore")
+	}
+	if err := datastore.Close(ctx); err != nil {
+		log.WithError(err).Warn("Failed to close Datastore")
+	}
+
+	log.Info("Datastore is up to date")
+}
+
+// Asks the API on this host whether it's ready, for Docker's HEALTHCHECK,
+// exiting non-zero if it isn't
+func healthcheck() {
+	cfg := loadConfig()
+
+	client := http.Client{Timeout: 10 * time.Second}
+	res, err := client.Get("http://" + localAddress(cfg.HTTP.ListenAddress) + "/readyz")
+	if err != nil {
+		log.WithError(err).Fatal("Failed to reach the API")
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		log.WithField("status", res.StatusCode).Fatal("API is not ready")
+	}
+}
+
+// Where to reach a listen address like :80 from the same host
+func localAddress(listenAddress string) string {
+	host, port, err := net.SplitHostPort(listenAddress)
+	if err != nil {
+		return listenAddress
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	return net.JoinHostPort(host, port)
+}
+
 func main() {
+	switch pflag.Arg(0) {
+	case "":
+	case "migrate":
+		migrate()
+		return
+	case "healthcheck":
+		healthcheck()
+		return
+	default:
+		log.WithField("command", pflag.Arg(0)).Fatal("Unknown command")
+	}
+
 	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
 
@@ -5,3 +5,19 @@ import "testing"
 func TestHello(t *testing.T) {
 
 }
+
+func TestLocalAddress(t *testing.T) {
+	tests := map[string]string{
+		":80":            "localhost:80",
+		":8080":          "localhost:8080",
+		"0.0.0.0:8080":   "localhost:8080",
+		"[::]:8080":      "localhost:8080",
+		"127.0.0.1:8080": "127.0.0.1:8080",
+		"api:8080":       "api:8080",
+	}
+	for listenAddress, want := range tests {
+		if got := localAddress(listenAddress); got != want {
+			t.Errorf("localAddress(%q) = %q, want %q", listenAddress, got, want)
+		}
+	}
+}
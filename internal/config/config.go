@@ -29,11 +29,62 @@ type Config struct {
 		}
 	}
 
+	Admin struct {
+		// Bearer tokens allowed to manage the API, keyed by who they belong to
+		Tokens map[string]string `mapstructure:"tokens"`
+	}
+
+	Scheduler struct {
+		// How long a replica's lease on a job lasts unless it's renewed, so
+		// how long a replica that dies keeps others from running its jobs
+		LockTTL time.Duration `mapstructure:"lock_ttl"`
+
+		Sync struct {
+			// The upcoming sync refreshes events from UpcomingBehind ago
+			// until UpcomingAhead from now
+			UpcomingBehind time.Duration `mapstructure:"upcoming_behind"`
+			UpcomingAhead  time.Duration `mapstructure:"upcoming_ahead"`
+			// How far back the full sync goes, everything the portal has
+			// when zero
+			History time.Duration `mapstructure:"history"`
+			// Once the last successful full sync is this old, the upcoming
+			// sync catches it up rather than waiting for its schedule
+			FullSyncMaxAge time.Duration `mapstructure:"full_sync_max_age"`
+		}
+		// Overrides for the scheduler's jobs, keyed by job name
+		Jobs map[string]JobConfig `mapstructure:"jobs"`
+	}
+
+	Metrics struct {
+		// Serves /metrics on its own listener when set, otherwise alongside the API
+		ListenAddress string `mapstructure:"listen_address"`
+	}
+
+	Tracing struct {
+		// none, otlp or stdout
+		Exporter string `mapstructure:"exporter"`
+		// host:port of an OTLP/HTTP collector
+		OTLPEndpoint string  `mapstructure:"otlp_endpoint"`
+		Insecure     bool    `mapstructure:"insecure"`
+		SampleRatio  float64 `mapstructure:"sample_ratio"`
+	}
+
 	Database struct {
+		// mongo, sqlite or postgres
+		Driver string `mapstructure:"driver"`
+		// Where to find SQLite or PostgreSQL, a file path or a connection URL
+		DSN string `mapstructure:"dsn"`
+		// Whether to bring the schema up to date when the API starts, rather
+		// than with the migrate command
+		MigrateOnStartup bool `mapstructure:"migrate_on_startup"`
+
+		// Where to find Mongo
 		Host     string `mapstructure:"host"`
 		Name     string `mapstructure:"name"`
 		Username string `mapstructure:"username"`
 		Password string `mapstructure:"password"`
+		// Default time each query gets, cancelled sooner if the client goes away
+		QueryTimeout time.Duration `mapstructure:"query_timeout"`
 	}
 
 	LDAP struct {
@@ -61,6 +112,15 @@ type Config struct {
 	}
 }
 
+// JobConfig describes how one of the scheduler's jobs is run
+type JobConfig struct {
+	// An interval like 5m or a cron expression like '0 * * * *', the job's
+	// default when empty
+	Schedule string `mapstructure:"schedule"`
+	// Disabled jobs only run when an admin runs them
+	Disabled bool `mapstructure:"disabled"`
+}
+
 // StringToLogLevelHookFunc returns a mapstructure.DecodeHookFunc which parses a logrus Level from a string
 func StringToLogLevelHookFunc() mapstructure.DecodeHookFunc {
 	return func(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
@@ -0,0 +1,185 @@
+package helpers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nuigcompsoc/api/internal/logging"
+	"github.com/nuigcompsoc/api/internal/models"
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// RequestIDKey is where the ID of the current request is kept on the gin context
+const RequestIDKey = "request_id"
+
+// AdminKey is where the name of the admin making the request is kept on the
+// gin context, once they've been authenticated
+const AdminKey = "admin"
+
+// RequestIDHeader is the header request IDs are accepted from and returned in
+const RequestIDHeader = "X-Request-ID"
+
+// Request IDs we accept from clients or proxies, anything else is replaced so
+// that nothing odd ends up in our logs
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// NewRequestID returns a random ID for correlating a request with its logs
+func NewRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// ValidRequestID reports whether id is fit to use as a request ID
+func ValidRequestID(id string) bool {
+	return requestIDPattern.MatchString(id)
+}
+
+// APIError is an error that can be shown to clients. Code is stable and
+// meant for machines, Message is meant for humans and may change.
+type APIError struct {
+	Status  int
+	Code    string
+	Message string
+	Details interface{}
+
+	// What actually went wrong, logged but never shown to clients
+	cause error
+}
+
+/*
+ * The catalogue of errors the API responds with
+ */
+var (
+	ErrBadRequest       = &APIError{Status: http.StatusBadRequest, Code: "bad_request", Message: "the request could not be understood"}
+	ErrInvalidParameter = &APIError{Status: http.StatusBadRequest, Code: "invalid_parameter", Message: "a parameter of the request is invalid"}
+	ErrInvalidField     = &APIError{Status: http.StatusBadRequest, Code: "invalid_field", Message: "a field of the request body is invalid"}
+	ErrUnauthorized     = &APIError{Status: http.StatusUnauthorized, Code: "unauthorized", Message: "a valid admin token is required"}
+	ErrNotFound         = &APIError{Status: http.StatusNotFound, Code: "not_found", Message: "the requested resource could not be found"}
+	ErrRouteNotFound    = &APIError{Status: http.StatusNotFound, Code: "route_not_found", Message: "there is no such route"}
+	ErrMethodNotAllowed = &APIError{Status: http.StatusMethodNotAllowed, Code: "method_not_allowed", Message: "the route does not support this method"}
+	ErrConflict         = &APIError{Status: http.StatusConflict, Code: "conflict", Message: "the request conflicts with an existing resource"}
+	ErrNotAcceptable    = &APIError{Status: http.StatusNotAcceptable, Code: "not_acceptable", Message: "none of the requested formats are supported"}
+	ErrTeapot           = &APIError{Status: http.StatusTeapot, Code: "teapot", Message: "I refuse to brew coffee because I am, permanently, a teapot."}
+	ErrRequestCancelled = &APIError{Status: 499, Code: "request_cancelled", Message: "the request was cancelled by the client"}
+	ErrInternal         = &APIError{Status: http.StatusInternalServerError, Code: "internal_error", Message: "something went wrong handling the request"}
+	ErrNotImplemented   = &APIError{Status: http.StatusNotImplemented, Code: "not_implemented", Message: "the route has not been built yet"}
+	ErrDatabase         = &APIError{Status: http.StatusInternalServerError, Code: "database_error", Message: "failed to query the database"}
+	ErrTimeout          = &APIError{Status: http.StatusGatewayTimeout, Code: "timeout", Message: "a service took too long to respond"}
+)
+
+// serviceErrors maps errors returned by services onto what clients should see
+var serviceErrors = []struct {
+	err    error
+	apiErr *APIError
+}{
+	{models.ErrNotFound, ErrNotFound},
+	{models.ErrConflict, ErrConflict},
+	{mongo.ErrNoDocuments, ErrNotFound},
+	{context.DeadlineExceeded, ErrTimeout},
+	{context.Canceled, ErrRequestCancelled},
+}
+
+func (e *APIError) Error() string {
+	if e.cause != nil {
+		return e.Code + ": " + e.Message + ": " + e.cause.Error()
+	}
+	return e.Code + ": " + e.Message
+}
+
+func (e *APIError) Unwrap() error {
+	return e.cause
+}
+
+// WithMessage returns a copy of the error with a more specific message
+func (e *APIError) WithMessage(message string) *APIError {
+	err := *e
+	err.Message = message
+	return &err
+}
+
+// WithDetails returns a copy of the error with extra machine readable details
+func (e *APIError) WithDetails(details interface{}) *APIError {
+	err := *e
+	err.Details = details
+	return &err
+}
+
+// Because returns a copy of the error caused by cause. If cause is a service
+// error we know how to describe better, like a missing document, clients are
+// shown that instead.
+func (e *APIError) Because(cause error) *APIError {
+	err := *e
+	err.cause = cause
+	return &err
+}
+
+// InvalidParameter describes a bad path or query parameter
+func InvalidParameter(parameter string, message string) *APIError {
+	return ErrInvalidParameter.WithMessage(message).WithDetails(gin.H{"parameter": parameter})
+}
+
+// InvalidField describes a bad field of a request body
+func InvalidField(field string, message string) *APIError {
+	return ErrInvalidField.WithMessage(message).WithDetails(gin.H{"field": field})
+}
+
+// ToAPIError works out what clients should be told about err
+func ToAPIError(err error) *APIError {
+	var apiErr *APIError
+	isAPIError := errors.As(err, &apiErr)
+
+	// Client errors are specific enough already
+	if isAPIError && apiErr.Status < 500 {
+		return apiErr
+	}
+
+	for _, serviceErr := range serviceErrors {
+		if errors.Is(err, serviceErr.err) {
+			return serviceErr.apiErr.Because(err)
+		}
+	}
+
+	if isAPIError {
+		return apiErr
+	}
+	return ErrInternal.Because(err)
+}
+
+// The body of an error response
+func errorBody(c *gin.Context, err *APIError) gin.H {
+	body := gin.H{
+		"code":    err.Code,
+		"message": err.Message,
+	}
+	if err.Details != nil {
+		body["details"] = err.Details
+	}
+	if requestID := c.GetString(RequestIDKey); requestID != "" {
+		body["request_id"] = requestID
+	}
+
+	return gin.H{"status": err.Status, "error": body}
+}
+
+// Logs errors that are our fault rather than the client's
+func logAPIError(c *gin.Context, err *APIError) {
+	if err.Status < 500 {
+		return
+	}
+
+	fields := log.Fields{"code": err.Code, "path": c.Request.URL.Path}
+	if err.cause != nil {
+		fields["error"] = err.cause.Error()
+	}
+	// The request scoped entry carries the request ID
+	logging.FromContext(c.Request.Context()).WithFields(fields).Warn("Responding with error")
+}
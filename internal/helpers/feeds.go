@@ -0,0 +1,351 @@
+package helpers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nuigcompsoc/api/internal/models"
+)
+
+// FeedFormat is a syndication format events can be published in
+type FeedFormat int
+
+const (
+	FeedRSS FeedFormat = iota
+	FeedAtom
+	FeedJSON
+)
+
+// Feed describes a feed of events independently of the format it's rendered in
+type Feed struct {
+	// Permanent tag URI of the feed, see FeedID
+	ID          string
+	Title       string
+	Description string
+	// URL of the feed itself
+	FeedURL string
+	// URL of the website the feed is for
+	HomePageURL string
+	Events      []models.DatabaseEvent
+}
+
+// Updated returns when any event in the feed last changed
+func (f Feed) Updated() time.Time {
+	updated := time.Time{}
+	for _, event := range f.Events {
+		if event.UpdatedAt.After(updated) {
+			updated = event.UpdatedAt
+		}
+	}
+	return updated
+}
+
+// Respond with events as a feed, or not modified if the client has it already
+func RespondWithFeed(c *gin.Context, code int, format FeedFormat, feed Feed) {
+	var body []byte
+	var contentType string
+	var err error
+	switch format {
+	case FeedRSS:
+		contentType = "application/rss+xml; charset=utf-8"
+		body, err = feedRSS(feed)
+	case FeedAtom:
+		contentType = "application/atom+xml; charset=utf-8"
+		body, err = feedAtom(feed)
+	case FeedJSON:
+		contentType = "application/feed+json; charset=utf-8"
+		body, err = feedJSON(feed)
+	default:
+		err = fmt.Errorf("unknown feed format %v", format)
+	}
+	if err != nil {
+		RespondWithError(c, ErrInternal.Because(err))
+		return
+	}
+
+	RespondWithConditionalData(c, code, contentType, body)
+}
+
+// RespondWithConditionalData responds with body tagged with an ETag, or with
+// 304 Not Modified if the request's If-None-Match shows the client already
+// has it. There's no Last-Modified, as feeds change when events drop out of
+// them without anything in them being updated.
+func RespondWithConditionalData(c *gin.Context, code int, contentType string, body []byte) {
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	c.Header("ETag", etag)
+	if etagMatches(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	c.Header("Content-Type", contentType)
+	c.Data(code, contentType, body)
+}
+
+// Reports whether an If-None-Match header lists etag, comparing weakly as
+// RFC 7232 asks, so W/"x" matches "x"
+func etagMatches(header string, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// FeedID returns a tag URI which identifies the feed called name, like
+// upcoming, however its URL was written and whichever host served it
+func FeedID(name string) string {
+	return "tag:api.compsoc.ie,2022:feeds/" + name
+}
+
+// A tag URI which identifies an event in Atom and JSON feeds
+func feedItemID(event models.DatabaseEvent) string {
+	return fmt.Sprintf("tag:api.compsoc.ie,2022:events/%d-%d", event.EventID, event.EventDetailsID)
+}
+
+// Stands in for when an event was updated if it was stored before we kept
+// track, or for when an empty feed was. It never changes, so neither do
+// responses and their ETags from one request to the next.
+var unknownUpdated = time.Unix(0, 0).UTC()
+
+func feedItemUpdated(event models.DatabaseEvent) time.Time {
+	if event.UpdatedAt.IsZero() {
+		return unknownUpdated
+	}
+	return event.UpdatedAt
+}
+
+/*
+ * RSS 2.0
+ */
+
+type rss struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Atom    string     `xml:"xmlns:atom,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	SelfLink      atomLink  `xml:"atom:link"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link,omitempty"`
+	Description string  `xml:"description"`
+	Category    string  `xml:"category,omitempty"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+func feedRSS(feed Feed) ([]byte, error) {
+	channel := rssChannel{
+		Title:       feed.Title,
+		Link:        feed.HomePageURL,
+		Description: feed.Description,
+		SelfLink:    atomLink{Href: feed.FeedURL, Rel: "self", Type: "application/rss+xml"},
+		Items:       []rssItem{},
+	}
+	if updated := feed.Updated(); !updated.IsZero() {
+		channel.LastBuildDate = updated.UTC().Format(time.RFC1123Z)
+	}
+
+	for _, event := range feed.Events {
+		channel.Items = append(channel.Items, rssItem{
+			Title:       event.Title,
+			Link:        event.EventURL,
+			Description: event.DangerousDescriptionHTML,
+			Category:    event.EventType,
+			GUID:        rssGUID{Value: feedItemID(event)},
+			PubDate:     feedItemUpdated(event).UTC().Format(time.RFC1123Z),
+		})
+	}
+
+	body, err := xml.MarshalIndent(rss{Version: "2.0", Atom: "http://www.w3.org/2005/Atom", Channel: channel}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
+
+/*
+ * Atom (RFC 4287)
+ */
+
+type atomFeed struct {
+	XMLName  xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID       string      `xml:"id"`
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle,omitempty"`
+	Updated  string      `xml:"updated"`
+	Links    []atomLink  `xml:"link"`
+	Author   atomAuthor  `xml:"author"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomEntry struct {
+	ID       string      `xml:"id"`
+	Title    string      `xml:"title"`
+	Updated  string      `xml:"updated"`
+	Links    []atomLink  `xml:"link"`
+	Author   atomAuthor  `xml:"author"`
+	Category *atomTerm   `xml:"category,omitempty"`
+	Summary  string      `xml:"summary,omitempty"`
+	Content  atomContent `xml:"content"`
+}
+
+type atomTerm struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomContent struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+func feedAtom(feed Feed) ([]byte, error) {
+	// Atom feeds must say when they were updated, even with nothing in them
+	updated := feed.Updated()
+	if updated.IsZero() {
+		updated = unknownUpdated
+	}
+
+	atom := atomFeed{
+		ID:       feed.ID,
+		Title:    feed.Title,
+		Subtitle: feed.Description,
+		Updated:  updated.UTC().Format(time.RFC3339),
+		Links: []atomLink{
+			{Href: feed.FeedURL, Rel: "self", Type: "application/atom+xml"},
+			{Href: feed.HomePageURL, Rel: "alternate"},
+		},
+		Author:  atomAuthor{Name: feed.Title},
+		Entries: []atomEntry{},
+	}
+
+	for _, event := range feed.Events {
+		entry := atomEntry{
+			ID:      feedItemID(event),
+			Title:   event.Title,
+			Updated: feedItemUpdated(event).UTC().Format(time.RFC3339),
+			Links:   []atomLink{},
+			Author:  atomAuthor{Name: event.SocietyName},
+			Summary: event.DatetimeFormatted,
+			Content: atomContent{Type: "html", Value: event.DangerousDescriptionHTML},
+		}
+		if event.EventURL != "" {
+			entry.Links = append(entry.Links, atomLink{Href: event.EventURL, Rel: "alternate"})
+		}
+		if event.EventType != "" {
+			entry.Category = &atomTerm{Term: event.EventType}
+		}
+		atom.Entries = append(atom.Entries, entry)
+	}
+
+	body, err := xml.MarshalIndent(atom, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
+
+/*
+ * JSON Feed 1.1 (https://www.jsonfeed.org/version/1.1/)
+ */
+
+type jsonFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url,omitempty"`
+	FeedURL     string         `json:"feed_url,omitempty"`
+	Description string         `json:"description,omitempty"`
+	Language    string         `json:"language"`
+	Items       []jsonFeedItem `json:"items"`
+}
+
+type jsonFeedItem struct {
+	ID            string           `json:"id"`
+	URL           string           `json:"url,omitempty"`
+	Title         string           `json:"title"`
+	ContentHTML   string           `json:"content_html"`
+	ContentText   string           `json:"content_text"`
+	Summary       string           `json:"summary,omitempty"`
+	DateModified  string           `json:"date_modified"`
+	Authors       []jsonFeedAuthor `json:"authors,omitempty"`
+	Tags          []string         `json:"tags,omitempty"`
+	StartDatetime string           `json:"_start_datetime"`
+	EndDatetime   string           `json:"_end_datetime"`
+	Location      string           `json:"_location,omitempty"`
+}
+
+type jsonFeedAuthor struct {
+	Name string `json:"name"`
+}
+
+func feedJSON(feed Feed) ([]byte, error) {
+	out := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       feed.Title,
+		HomePageURL: feed.HomePageURL,
+		FeedURL:     feed.FeedURL,
+		Description: feed.Description,
+		Language:    "en-IE",
+		Items:       []jsonFeedItem{},
+	}
+
+	for _, event := range feed.Events {
+		item := jsonFeedItem{
+			ID:            feedItemID(event),
+			URL:           event.EventURL,
+			Title:         event.Title,
+			ContentHTML:   event.DangerousDescriptionHTML,
+			ContentText:   event.DescriptionMarkdown,
+			Summary:       event.DatetimeFormatted,
+			DateModified:  feedItemUpdated(event).UTC().Format(time.RFC3339),
+			StartDatetime: event.StartDatetime.In(models.EventLocation).Format(time.RFC3339),
+			EndDatetime:   event.EndDatetime.In(models.EventLocation).Format(time.RFC3339),
+			Location:      event.Location,
+		}
+		if event.SocietyName != "" {
+			item.Authors = []jsonFeedAuthor{{Name: event.SocietyName}}
+		}
+		if event.EventType != "" {
+			item.Tags = []string{event.EventType}
+		}
+		out.Items = append(out.Items, item)
+	}
+
+	return json.MarshalIndent(out, "", "  ")
+}
@@ -0,0 +1,130 @@
+package helpers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nuigcompsoc/api/internal/models"
+)
+
+const (
+	icalProductID = "-//CompSoc//CompSoc API//EN"
+	icalUIDDomain = "api.compsoc.ie"
+	icalLocalTime = "20060102T150405"
+	icalUTCTime   = "20060102T150405Z"
+)
+
+// The societies portal is in Ireland, so every event is given in Europe/Dublin
+const icalDublinTimezone = "BEGIN:VTIMEZONE\r\n" +
+	"TZID:Europe/Dublin\r\n" +
+	"X-LIC-LOCATION:Europe/Dublin\r\n" +
+	"BEGIN:DAYLIGHT\r\n" +
+	"TZOFFSETFROM:+0000\r\n" +
+	"TZOFFSETTO:+0100\r\n" +
+	"TZNAME:IST\r\n" +
+	"DTSTART:19700329T010000\r\n" +
+	"RRULE:FREQ=YEARLY;BYMONTH=3;BYDAY=-1SU\r\n" +
+	"END:DAYLIGHT\r\n" +
+	"BEGIN:STANDARD\r\n" +
+	"TZOFFSETFROM:+0100\r\n" +
+	"TZOFFSETTO:+0000\r\n" +
+	"TZNAME:GMT\r\n" +
+	"DTSTART:19701025T020000\r\n" +
+	"RRULE:FREQ=YEARLY;BYMONTH=10;BYDAY=-1SU\r\n" +
+	"END:STANDARD\r\n" +
+	"END:VTIMEZONE\r\n"
+
+// Respond with an RFC 5545 calendar of events, or not modified if the client has it already
+func RespondWithCalendar(c *gin.Context, code int, name string, events []models.DatabaseEvent) {
+	RespondWithConditionalData(c, code, "text/calendar; charset=utf-8", []byte(Calendar(name, events)))
+}
+
+// Calendar renders events as an RFC 5545 VCALENDAR
+func Calendar(name string, events []models.DatabaseEvent) string {
+	var b strings.Builder
+	b.WriteString("BEGIN:VCALENDAR\r\n")
+	writeICalLine(&b, "VERSION", "2.0")
+	writeICalLine(&b, "PRODID", icalProductID)
+	writeICalLine(&b, "CALSCALE", "GREGORIAN")
+	writeICalLine(&b, "METHOD", "PUBLISH")
+	writeICalLine(&b, "X-WR-CALNAME", escapeICalText(name))
+	writeICalLine(&b, "X-WR-TIMEZONE", models.EventLocation.String())
+	b.WriteString(icalDublinTimezone)
+
+	for _, event := range events {
+		writeICalEvent(&b, event)
+	}
+
+	b.WriteString("END:VCALENDAR\r\n")
+	return b.String()
+}
+
+func writeICalEvent(b *strings.Builder, event models.DatabaseEvent) {
+	modified := feedItemUpdated(event)
+
+	status := "CONFIRMED"
+	if event.Cancelled() {
+		status = "CANCELLED"
+	}
+
+	b.WriteString("BEGIN:VEVENT\r\n")
+	writeICalLine(b, "UID", ICalUID(event))
+	writeICalLine(b, "DTSTAMP", modified.UTC().Format(icalUTCTime))
+	writeICalLine(b, "LAST-MODIFIED", modified.UTC().Format(icalUTCTime))
+	writeICalLine(b, "SEQUENCE", strconv.Itoa(event.Sequence))
+	writeICalLine(b, "STATUS", status)
+	writeICalLine(b, "DTSTART;TZID=Europe/Dublin", event.StartDatetime.In(models.EventLocation).Format(icalLocalTime))
+	writeICalLine(b, "DTEND;TZID=Europe/Dublin", event.EndDatetime.In(models.EventLocation).Format(icalLocalTime))
+	writeICalLine(b, "SUMMARY", escapeICalText(event.Title))
+	if event.Location != "" {
+		writeICalLine(b, "LOCATION", escapeICalText(strings.TrimSpace(event.Location)))
+	}
+	if event.Description != "" {
+		writeICalLine(b, "DESCRIPTION", escapeICalText(event.Description))
+	}
+	if event.EventType != "" {
+		writeICalLine(b, "CATEGORIES", escapeICalText(event.EventType))
+	}
+	if event.EventURL != "" {
+		writeICalLine(b, "URL", event.EventURL)
+	}
+	b.WriteString("END:VEVENT\r\n")
+}
+
+// ICalUID returns a UID for the event that stays the same across syncs
+func ICalUID(event models.DatabaseEvent) string {
+	return fmt.Sprintf("%d-%d@%s", event.EventID, event.EventDetailsID, icalUIDDomain)
+}
+
+// Writes a content line, folding it so no line is longer than 75 octets
+func writeICalLine(b *strings.Builder, name string, value string) {
+	line := name + ":" + value
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+		// Continuation lines lose an octet to the leading space
+		limit = 74
+	}
+	b.WriteString(line)
+	b.WriteString("\r\n")
+}
+
+func escapeICalText(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+		"\r", `\n`,
+	).Replace(s)
+}
@@ -0,0 +1,448 @@
+package helpers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v2"
+)
+
+// Format is a representation responses can be negotiated into
+type Format string
+
+const (
+	FormatJSON Format = "json"
+	FormatCSV  Format = "csv"
+	FormatYAML Format = "yaml"
+	FormatXML  Format = "xml"
+)
+
+// Formats lists every format responses can be negotiated into, preferred first
+var Formats = []Format{FormatJSON, FormatCSV, FormatYAML, FormatXML}
+
+// The media types each format answers to, the first being the one we respond with
+var formatMediaTypes = map[Format][]string{
+	FormatJSON: {"application/json"},
+	FormatCSV:  {"text/csv"},
+	FormatYAML: {"application/yaml", "application/x-yaml", "text/yaml", "text/x-yaml"},
+	FormatXML:  {"application/xml", "text/xml"},
+}
+
+// MediaType returns the Content-Type responses in the format are sent with
+func (f Format) MediaType() string {
+	return formatMediaTypes[f][0] + "; charset=utf-8"
+}
+
+// Render writes body to the client in whichever format they asked for,
+// either with the format query parameter or the Accept header. Clients
+// asking for nothing we support get 406 Not Acceptable.
+func Render(c *gin.Context, code int, body gin.H) {
+	format, ok := NegotiateFormat(c)
+	if !ok {
+		supported := []string{}
+		for _, f := range Formats {
+			supported = append(supported, formatMediaTypes[f]...)
+		}
+		c.AbortWithStatusJSON(http.StatusNotAcceptable, errorBody(c, ErrNotAcceptable.WithDetails(gin.H{"supported": supported})))
+		return
+	}
+
+	render(c, code, format, body)
+}
+
+// Writes an error in whichever format the client asked for, or in JSON if
+// it's one we don't support, so that the client still learns what went wrong
+// rather than getting 406 Not Acceptable
+func renderError(c *gin.Context, err *APIError) {
+	format, ok := NegotiateFormat(c)
+	if !ok {
+		format = FormatJSON
+	}
+	render(c, err.Status, format, errorBody(c, err))
+}
+
+func render(c *gin.Context, code int, format Format, body gin.H) {
+	if format == FormatJSON {
+		c.JSON(code, body)
+		return
+	}
+
+	// Other formats are derived from the JSON representation so that field
+	// names and values are identical no matter what format is asked for
+	generic, err := toGeneric(body)
+	if err == nil {
+		var out []byte
+		switch format {
+		case FormatCSV:
+			out, err = renderCSV(generic)
+			c.Header("Content-Disposition", "inline; filename=\""+csvFilename(c)+"\"")
+		case FormatYAML:
+			out, err = yaml.Marshal(generic)
+		case FormatXML:
+			out, err = renderXML(generic)
+		}
+		if err == nil {
+			c.Data(code, format.MediaType(), out)
+			return
+		}
+	}
+
+	apiErr := ErrInternal.WithMessage(fmt.Sprintf("failed to render response as %v", format)).Because(err)
+	logAPIError(c, apiErr)
+	c.AbortWithStatusJSON(apiErr.Status, errorBody(c, apiErr))
+}
+
+// NegotiateFormat picks the response format for a request. The format query
+// parameter takes precedence over the Accept header, and no preference at
+// all means JSON, as does a browser's Accept header.
+func NegotiateFormat(c *gin.Context) (Format, bool) {
+	if f := strings.ToLower(c.Query("format")); f != "" {
+		for _, format := range Formats {
+			if Format(f) == format {
+				return format, true
+			}
+		}
+		return "", false
+	}
+
+	accept := c.GetHeader("Accept")
+	if strings.TrimSpace(accept) == "" {
+		return FormatJSON, true
+	}
+
+	ranges := parseAccept(accept)
+	browser, top := false, 0.0
+	for _, mediaRange := range ranges {
+		if mediaRange.mediaType == "text/html" || mediaRange.mediaType == "application/xhtml+xml" {
+			browser = true
+		}
+		top = math.Max(top, mediaRange.q)
+	}
+
+	// How much the client wants each format, going by the media types it
+	// names and by wildcards like */* that merely put up with the format
+	named := map[Format]float64{}
+	tolerated := map[Format]float64{}
+	for _, mediaRange := range ranges {
+		for _, format := range Formats {
+			if !mediaRange.matches(formatMediaTypes[format]) {
+				continue
+			}
+			// Browsers ask for XML alongside HTML out of habit, they'd
+			// rather have JSON than a page of XML
+			if strings.Contains(mediaRange.mediaType, "*") || browser && format == FormatXML {
+				tolerated[format] = math.Max(tolerated[format], mediaRange.q)
+			} else {
+				named[format] = math.Max(named[format], mediaRange.q)
+			}
+		}
+	}
+
+	// We only switch away from JSON for a format the client names above
+	// everything else it accepts, HTML included. A format it names ties
+	// with JSON it only tolerates, so "text/csv, */*" picks CSV.
+	jsonQ := math.Max(named[FormatJSON], tolerated[FormatJSON])
+	best, bestQ := Format(""), 0.0
+	for _, format := range Formats[1:] {
+		if named[format] > bestQ {
+			best, bestQ = format, named[format]
+		}
+	}
+	if best != "" && bestQ >= top && (bestQ > jsonQ || bestQ == jsonQ && named[FormatJSON] < jsonQ) {
+		return best, true
+	}
+	if jsonQ > 0 {
+		return FormatJSON, true
+	}
+
+	// Otherwise the client gets whatever it will put up with
+	for _, format := range Formats[1:] {
+		if q := math.Max(named[format], tolerated[format]); q > bestQ {
+			best, bestQ = format, q
+		}
+	}
+	return best, best != ""
+}
+
+type acceptedMediaRange struct {
+	mediaType string
+	q         float64
+}
+
+// Splits an Accept header into its media ranges, leaving out those the
+// client refuses with q=0
+func parseAccept(header string) []acceptedMediaRange {
+	ranges := []acceptedMediaRange{}
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		mediaRange := acceptedMediaRange{mediaType: strings.ToLower(strings.TrimSpace(params[0])), q: 1}
+		for _, param := range params[1:] {
+			key, value, found := strings.Cut(strings.TrimSpace(param), "=")
+			if found && strings.ToLower(key) == "q" {
+				if q, err := strconv.ParseFloat(value, 64); err == nil {
+					mediaRange.q = q
+				}
+			}
+		}
+		if mediaRange.mediaType != "" && mediaRange.q > 0 {
+			ranges = append(ranges, mediaRange)
+		}
+	}
+	return ranges
+}
+
+func (r acceptedMediaRange) matches(mediaTypes []string) bool {
+	for _, mediaType := range mediaTypes {
+		if r.mediaType == "*/*" || r.mediaType == mediaType {
+			return true
+		}
+		if strings.HasSuffix(r.mediaType, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(r.mediaType, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+// Converts v into its JSON representation built from yaml.MapSlice, []interface{}
+// and scalars, keeping the order of object keys
+func toGeneric(v interface{}) (interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	return decodeGeneric(dec)
+}
+
+func decodeGeneric(dec *json.Decoder) (interface{}, error) {
+	token, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch token {
+	case json.Delim('{'):
+		object := yaml.MapSlice{}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeGeneric(dec)
+			if err != nil {
+				return nil, err
+			}
+			object = append(object, yaml.MapItem{Key: key, Value: value})
+		}
+		_, err = dec.Token()
+		return object, err
+	case json.Delim('['):
+		array := []interface{}{}
+		for dec.More() {
+			value, err := decodeGeneric(dec)
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, value)
+		}
+		_, err = dec.Token()
+		return array, err
+	default:
+		return token, nil
+	}
+}
+
+/*
+ * CSV
+ */
+
+// Names the CSV after the resource requested, e.g. events/upcoming -> upcoming.csv
+func csvFilename(c *gin.Context) string {
+	name := path.Base(c.Request.URL.Path)
+	if name == "/" || name == "." || name == "" {
+		name = "data"
+	}
+	return strings.NewReplacer(`"`, "", `\`, "").Replace(name) + ".csv"
+}
+
+// Renders a response as CSV. Arrays of objects in data become one row per
+// object, with nested fields flattened into dotted column names.
+func renderCSV(body interface{}) ([]byte, error) {
+	envelope, ok := body.(yaml.MapSlice)
+	if !ok {
+		return nil, errors.New("response body is not an object")
+	}
+
+	var rows []interface{}
+	var data interface{}
+	for _, item := range envelope {
+		if item.Key == "data" {
+			data = item.Value
+		}
+	}
+	switch d := data.(type) {
+	case []interface{}:
+		rows = d
+	case yaml.MapSlice:
+		rows = []interface{}{d}
+	default:
+		// Strings such as errors are written out along with the status
+		rows = []interface{}{envelope}
+	}
+
+	columns := []string{}
+	seen := map[string]bool{}
+	flattened := []map[string]string{}
+	for _, row := range rows {
+		fields := map[string]string{}
+		flattenCSV("", row, fields, &columns, seen)
+		flattened = append(flattened, fields)
+	}
+
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+	if err := w.Write(columns); err != nil {
+		return nil, err
+	}
+	for _, fields := range flattened {
+		record := make([]string, len(columns))
+		for i, column := range columns {
+			record[i] = fields[column]
+		}
+		if err := w.Write(record); err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+
+	return b.Bytes(), w.Error()
+}
+
+func flattenCSV(prefix string, value interface{}, fields map[string]string, columns *[]string, seen map[string]bool) {
+	switch v := value.(type) {
+	case yaml.MapSlice:
+		for _, item := range v {
+			key := fmt.Sprint(item.Key)
+			if prefix != "" {
+				key = prefix + "." + key
+			}
+			flattenCSV(key, item.Value, fields, columns, seen)
+		}
+		return
+	case []interface{}:
+		values := []string{}
+		for _, element := range v {
+			values = append(values, csvScalar(element))
+		}
+		value = strings.Join(values, "; ")
+	}
+
+	if prefix == "" {
+		prefix = "data"
+	}
+	if !seen[prefix] {
+		seen[prefix] = true
+		*columns = append(*columns, prefix)
+	}
+	fields[prefix] = csvScalar(value)
+}
+
+func csvScalar(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case yaml.MapSlice, []interface{}:
+		b, _ := yaml.Marshal(v)
+		return strings.TrimSpace(string(b))
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+/*
+ * XML
+ */
+
+// Renders a response as XML under a <response> element. Object keys become
+// elements and array elements are each wrapped in <item>.
+func renderXML(body interface{}) ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+
+	enc := xml.NewEncoder(&b)
+	enc.Indent("", "  ")
+	if err := encodeXML(enc, "response", body); err != nil {
+		return nil, err
+	}
+	if err := enc.Flush(); err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+func encodeXML(enc *xml.Encoder, name string, value interface{}) error {
+	start := xml.StartElement{Name: xml.Name{Local: xmlName(name)}}
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+
+	switch v := value.(type) {
+	case yaml.MapSlice:
+		for _, item := range v {
+			if err := encodeXML(enc, fmt.Sprint(item.Key), item.Value); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, element := range v {
+			if err := encodeXML(enc, "item", element); err != nil {
+				return err
+			}
+		}
+	case nil:
+	default:
+		if err := enc.EncodeToken(xml.CharData(csvScalar(v))); err != nil {
+			return err
+		}
+	}
+
+	return enc.EncodeToken(start.End())
+}
+
+// Makes a JSON key safe to use as an XML element name
+func xmlName(key string) string {
+	var b strings.Builder
+	for i, r := range key {
+		valid := r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' ||
+			i > 0 && (r == '-' || r == '.' || r >= '0' && r <= '9')
+		if !valid {
+			if i == 0 && r >= '0' && r <= '9' {
+				b.WriteRune('_')
+				b.WriteRune(r)
+				continue
+			}
+			r = '_'
+		}
+		b.WriteRune(r)
+	}
+	if b.Len() == 0 {
+		return "_"
+	}
+	return b.String()
+}
@@ -0,0 +1,56 @@
+package helpers
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		accept string
+		want   Format
+		// False when nothing the client accepts can be served
+		ok bool
+	}{
+		{name: "no preference", want: FormatJSON, ok: true},
+		{name: "curl", accept: "*/*", want: FormatJSON, ok: true},
+		{name: "chrome", accept: "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7", want: FormatJSON, ok: true},
+		{name: "firefox", accept: "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", want: FormatJSON, ok: true},
+		{name: "old safari", accept: "application/xml,application/xhtml+xml,text/html;q=0.9,text/plain;q=0.8,image/png,*/*;q=0.5", want: FormatJSON, ok: true},
+		{name: "edge", accept: "text/html, application/xhtml+xml, image/jxr, */*", want: FormatJSON, ok: true},
+		{name: "fetch", accept: "application/json, text/plain, */*", want: FormatJSON, ok: true},
+		{name: "json", accept: "application/json", want: FormatJSON, ok: true},
+		{name: "csv", accept: "text/csv", want: FormatCSV, ok: true},
+		{name: "csv over anything", accept: "text/csv, */*", want: FormatCSV, ok: true},
+		{name: "csv preferred to json", accept: "application/json;q=0.5, text/csv", want: FormatCSV, ok: true},
+		{name: "json preferred to xml", accept: "application/xml;q=0.9, application/json", want: FormatJSON, ok: true},
+		{name: "json tied with csv", accept: "application/json, text/csv", want: FormatJSON, ok: true},
+		{name: "yaml", accept: "application/x-yaml", want: FormatYAML, ok: true},
+		{name: "xml", accept: "application/xml", want: FormatXML, ok: true},
+		{name: "text xml", accept: "text/xml", want: FormatXML, ok: true},
+		{name: "any text", accept: "text/*", want: FormatCSV, ok: true},
+		{name: "refused json", accept: "application/json;q=0, text/csv;q=0.5", want: FormatCSV, ok: true},
+		{name: "only html", accept: "text/html", ok: false},
+		{name: "format over accept", query: "?format=xml", accept: "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", want: FormatXML, ok: true},
+		{name: "unsupported format", query: "?format=pdf", ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest("GET", "/v1/events"+tt.query, nil)
+			if tt.accept != "" {
+				c.Request.Header.Set("Accept", tt.accept)
+			}
+
+			format, ok := NegotiateFormat(c)
+			if ok != tt.ok || format != tt.want {
+				t.Errorf("negotiated %q, %v, want %q, %v", format, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
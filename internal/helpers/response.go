@@ -1,10 +1,13 @@
 package helpers
 
 import (
-	"github.com/gin-gonic/gin"
 	"encoding/json"
-	"time"
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
 )
 
 //Respond with status
@@ -14,41 +17,80 @@ func Respond(c *gin.Context, code int) {
 
 //Respond returns basic status and message
 func RespondWithString(c *gin.Context, code int, data string) {
-	c.JSON(code, gin.H{"status": code, "data": data})
+	Render(c, code, gin.H{"status": code, "data": data})
 }
 
 //Respond returns status and json
 func RespondWithJSON(c *gin.Context, code int, data interface{}) {
-	c.JSON(code, gin.H{"status": code, "data": data})
+	Render(c, code, gin.H{"status": code, "data": data})
+}
+
+//Respond returns status, json and where to find the next page of it
+func RespondWithPage(c *gin.Context, code int, data interface{}, nextCursor string, total int64) {
+	// Formats like CSV only have room for the data, so these go in headers too
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	if nextCursor != "" {
+		c.Header("X-Next-Cursor", nextCursor)
+	}
+	Render(c, code, gin.H{"status": code, "data": data, "next_cursor": nextCursor, "total": total})
 }
 
 //Respond with error, aborts rest of request
-func RespondWithError(c *gin.Context, code int, data error) {
-	c.AbortWithStatusJSON(code, gin.H{"status": code, "data": data.Error()})
+func RespondWithError(c *gin.Context, err error) {
+	apiErr := ToAPIError(err)
+	logAPIError(c, apiErr)
+
+	c.Abort()
+	renderError(c, apiErr)
 }
 
 func RespondWithToken(c *gin.Context, token string) {
-	c.Header("Set-Cookie", "data=" + token)
+	c.Header("Set-Cookie", "data="+token)
 	c.SetCookie(c.Request.Host, token, int((24 * time.Hour).Seconds()), "/", c.Request.Host, false, true)
-	c.Redirect(http.StatusTemporaryRedirect, c.Request.URL.Scheme + "://" + c.Request.Host)
+	c.Redirect(http.StatusTemporaryRedirect, RequestScheme(c)+"://"+c.Request.Host)
 }
 
 func RedirectWithToken(c *gin.Context, token string) {
-	c.Header("Set-Cookie", "data=" + token)
+	c.Header("Set-Cookie", "data="+token)
 	c.SetCookie(c.Request.Host, token, int((24 * time.Hour).Seconds()), "/", c.Request.Host, false, true)
-	c.Redirect(http.StatusTemporaryRedirect, c.Request.URL.Scheme + "://" + c.Request.Host)
+	c.Redirect(http.StatusTemporaryRedirect, RequestScheme(c)+"://"+c.Request.Host)
 }
 
 func RedirectWithString(c *gin.Context, message string) {
-	c.Redirect(http.StatusTemporaryRedirect, c.Request.URL.Scheme + "://" + c.Request.Host + "?message=" + message)
+	c.Redirect(http.StatusTemporaryRedirect, RequestScheme(c)+"://"+c.Request.Host+"?message="+url.QueryEscape(message))
 }
 
+// Redirects with the code of the error, and the request ID if there is one,
+// rather than its message so nothing internal ends up in a URL
 func RedirectWithError(c *gin.Context, err error) {
-	c.Redirect(http.StatusTemporaryRedirect, c.Request.URL.Scheme + "://" + c.Request.Host + "?error=" + err.Error())
+	q := url.Values{}
+	q.Set("error", ToAPIError(err).Code)
+	if requestID := c.GetString(RequestIDKey); requestID != "" {
+		q.Set("request_id", requestID)
+	}
+	c.Redirect(http.StatusTemporaryRedirect, RequestScheme(c)+"://"+c.Request.Host+"?"+q.Encode())
+}
+
+// RequestScheme returns the scheme the client used to reach us. Go never fills
+// in the scheme of a server request's URL, and behind a reverse proxy such as
+// Traefik the connection we see is plain HTTP anyway.
+func RequestScheme(c *gin.Context) string {
+	if proto := c.GetHeader("X-Forwarded-Proto"); proto != "" {
+		return proto
+	}
+	if c.Request.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// RequestURL returns the absolute URL the client requested
+func RequestURL(c *gin.Context) string {
+	return RequestScheme(c) + "://" + c.Request.Host + c.Request.URL.RequestURI()
 }
 
 func StringToJSON(s string) map[string]interface{} {
 	var sJSON map[string]interface{}
 	json.Unmarshal([]byte(s), &sJSON)
 	return sJSON
-}
\ No newline at end of file
+}
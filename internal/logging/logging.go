@@ -0,0 +1,25 @@
+// Package logging carries a request scoped logrus entry on contexts, so logs
+// from services can be correlated with the request that caused them.
+package logging
+
+import (
+	"context"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type entryKey struct{}
+
+// WithEntry returns a copy of ctx carrying entry
+func WithEntry(ctx context.Context, entry *log.Entry) context.Context {
+	return context.WithValue(ctx, entryKey{}, entry)
+}
+
+// FromContext returns the entry carried by ctx, or one without any fields
+// for work that isn't part of a request, like scheduled jobs
+func FromContext(ctx context.Context) *log.Entry {
+	if entry, ok := ctx.Value(entryKey{}).(*log.Entry); ok {
+		return entry
+	}
+	return log.NewEntry(log.StandardLogger())
+}
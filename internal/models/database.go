@@ -1,23 +1,245 @@
 package models
 
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned by datastores when what was asked for doesn't exist
+var ErrNotFound = errors.New("not found")
+
+// ErrConflict is returned by datastores when a write would duplicate
+// something that must be unique
+var ErrConflict = errors.New("conflicts with an existing resource")
+
 type DatabaseEvent struct {
-	EventID                  int    `bson:"event_id, omitempty"`
-	EventDetailsID           int    `bson:"event_details_id, omitempty"`
-	Title                    string `bson:"title, omitempty"`
-	SocietyID                int    `bson:"society_id, omitempty"`
-	SocietyName              string `bson:"society_name, omitempty"`
-	Location                 string `bson:"location, omitempty"`
-	Description              string `bson:"description, omitempty"`
-	DescriptionMarkdown      string `bson:"description_markdown, omitempty"`
-	DangerousDescriptionHTML string `bson:"dangerous_description_html, omitempty"`
-	StartDatetime            string `bson:"start_datetime, omitempty"`
-	EndDatetime              string `bson:"end_datetime, omitempty"`
-	DatetimeFormatted        string `bson:"datetime_formatted, omitempty"`
-	EventURL                 string `bson:"event_url, omitempty"`
-	EventICalURL             string `bson:"event_ical_url, omitempty"`
+	EventID                  int       `bson:"event_id, omitempty"`
+	EventDetailsID           int       `bson:"event_details_id, omitempty"`
+	Title                    string    `bson:"title, omitempty"`
+	SocietyID                int       `bson:"society_id, omitempty"`
+	SocietyName              string    `bson:"society_name, omitempty"`
+	EventType                string    `bson:"event_type, omitempty"`
+	Location                 string    `bson:"location, omitempty"`
+	LocationType             string    `bson:"location_type, omitempty"`
+	Description              string    `bson:"description, omitempty"`
+	DescriptionMarkdown      string    `bson:"description_markdown, omitempty"`
+	DangerousDescriptionHTML string    `bson:"dangerous_description_html, omitempty"`
+	StartDatetime            time.Time `bson:"start_datetime, omitempty"`
+	EndDatetime              time.Time `bson:"end_datetime, omitempty"`
+	DatetimeFormatted        string    `bson:"datetime_formatted, omitempty"`
+	EventURL                 string    `bson:"event_url, omitempty"`
+	EventICalURL             string    `bson:"event_ical_url, omitempty"`
+	Status                   string    `bson:"status, omitempty"`
+	Sequence                 int       `bson:"sequence, omitempty"`
+	UpdatedAt                time.Time `bson:"updated_at, omitempty"`
+	ContentHash              string    `bson:"content_hash, omitempty" json:"-"`
+}
+
+// Fingerprint returns a hash of everything about the event that came from
+// the societies portal, so we can tell when the portal changes an event
+func (e DatabaseEvent) Fingerprint() string {
+	e.Sequence = 0
+	e.UpdatedAt = time.Time{}
+	e.ContentHash = ""
+	e.StartDatetime = e.StartDatetime.UTC()
+	e.EndDatetime = e.EndDatetime.UTC()
+
+	b, _ := json.Marshal(e)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// Version fills in the content hash, sequence and updated time of an event
+// about to be stored, given the copy already stored if any. The sequence is
+// bumped, as calendar clients expect, whenever the portal's copy of an event
+// differs from what we have stored.
+func (e *DatabaseEvent) Version(previous *DatabaseEvent, now time.Time) {
+	e.ContentHash = e.Fingerprint()
+
+	switch {
+	case previous == nil:
+		e.Sequence = 0
+		e.UpdatedAt = now
+	case previous.ContentHash == e.ContentHash:
+		e.Sequence = previous.Sequence
+		e.UpdatedAt = previous.UpdatedAt
+	case previous.ContentHash == "":
+		// Stored before we kept hashes, we can't tell whether it changed
+		e.Sequence = previous.Sequence
+		e.UpdatedAt = now
+	default:
+		e.Sequence = previous.Sequence + 1
+		e.UpdatedAt = now
+	}
+}
+
+// Cancelled reports whether the societies portal has the event as cancelled
+func (e DatabaseEvent) Cancelled() bool {
+	return strings.Contains(strings.ToLower(e.Status), "cancel")
+}
+
+// InEventLocation returns the event with its datetimes expressed in EventLocation.
+// Mongo hands dates back to us in UTC, so this should be applied before the
+// event is returned to a client.
+func (e DatabaseEvent) InEventLocation() DatabaseEvent {
+	e.StartDatetime = e.StartDatetime.In(EventLocation)
+	e.EndDatetime = e.EndDatetime.In(EventLocation)
+	return e
+}
+
+// EventFilter narrows down and orders a query on the events collection
+type EventFilter struct {
+	// Only events overlapping [From, To] are returned, either may be zero
+	From          time.Time
+	To            time.Time
+	SocietyIDs    []int
+	LocationTypes []string
+	EventTypes    []string
+	Descending    bool
+	Limit         int64
+	After         *EventCursor
+}
+
+// EventPage is one page of results from a filtered events query
+type EventPage struct {
+	Events     []DatabaseEvent
+	NextCursor string
+	Total      int64
+}
+
+// EventCursor marks the last event of a page. Events are ordered by start
+// datetime, and then by their IDs so that the ordering is total. Search
+// results are ordered by their score first.
+type EventCursor struct {
+	Score          float64   `json:"r,omitempty"`
+	StartDatetime  time.Time `json:"s"`
+	EventDetailsID int       `json:"d"`
+	EventID        int       `json:"e"`
+}
+
+// CursorAfter returns the cursor pointing after event
+func (e DatabaseEvent) CursorAfter() EventCursor {
+	return EventCursor{
+		StartDatetime:  e.StartDatetime,
+		EventDetailsID: e.EventDetailsID,
+		EventID:        e.EventID,
+	}
+}
+
+// Encode returns the opaque string form of the cursor given to clients
+func (c EventCursor) Encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// ParseEventCursor decodes a cursor previously returned by EventCursor.Encode
+func ParseEventCursor(s string) (*EventCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.New("malformed cursor")
+	}
+
+	var c EventCursor
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, errors.New("malformed cursor")
+	}
+	return &c, nil
 }
 
 type Society struct {
 	Name              string
 	SocietiesPortalID int32
+
+	// Shown in the society directory, none of these affect syncing events
+	Slug        string            `bson:"slug,omitempty"`
+	Description string            `bson:"description,omitempty"`
+	Website     string            `bson:"website,omitempty"`
+	LogoURL     string            `bson:"logo_url,omitempty"`
+	SocialLinks map[string]string `bson:"social_links,omitempty"`
+}
+
+// ChangedFields lists the fields that differ between s and other
+func (s Society) ChangedFields(other Society) []string {
+	changes := []string{}
+	if s.Name != other.Name {
+		changes = append(changes, "Name")
+	}
+	if s.SocietiesPortalID != other.SocietiesPortalID {
+		changes = append(changes, "SocietiesPortalID")
+	}
+	if s.Slug != other.Slug {
+		changes = append(changes, "Slug")
+	}
+	if s.Description != other.Description {
+		changes = append(changes, "Description")
+	}
+	if s.Website != other.Website {
+		changes = append(changes, "Website")
+	}
+	if s.LogoURL != other.LogoURL {
+		changes = append(changes, "LogoURL")
+	}
+
+	// No links and an empty map of them are the same thing
+	sameLinks := len(s.SocialLinks) == len(other.SocialLinks)
+	for platform, link := range s.SocialLinks {
+		if otherLink, ok := other.SocialLinks[platform]; !ok || otherLink != link {
+			sameLinks = false
+		}
+	}
+	if !sameLinks {
+		changes = append(changes, "SocialLinks")
+	}
+
+	return changes
+}
+
+// What was done to a society, as recorded in a SocietyAuditEntry
+const (
+	SocietyCreated = "created"
+	SocietyUpdated = "updated"
+	SocietyDeleted = "deleted"
+)
+
+// SocietyAuditEntry records a change to a society and who made it. Entries
+// are kept under the society's portal ID after the change, or before it for
+// deletions.
+type SocietyAuditEntry struct {
+	SocietiesPortalID int32  `bson:"societies_portal_id"`
+	Action            string `bson:"action"`
+	// The admin who made the change, or the job that did
+	Actor string `bson:"actor"`
+	// Names of the fields that changed
+	Changes []string `bson:"changes"`
+	// Before is nil for creations and After is nil for deletions
+	Before *Society  `bson:"before,omitempty"`
+	After  *Society  `bson:"after,omitempty"`
+	At     time.Time `bson:"at"`
+}
+
+// What admins have decided about a SocietyProposal
+const (
+	ProposalPending  = "pending"
+	ProposalApproved = "approved"
+	ProposalRejected = "rejected"
+)
+
+// SocietyProposal is a society seen on the societies portal that we don't
+// track, waiting for an admin to decide whether we should
+type SocietyProposal struct {
+	SocietiesPortalID int32  `bson:"societies_portal_id"`
+	Name              string `bson:"name"`
+	// How many events of the society the portal listed when last checked
+	EventCount int       `bson:"event_count"`
+	FirstSeen  time.Time `bson:"first_seen"`
+	LastSeen   time.Time `bson:"last_seen"`
+	Status     string    `bson:"status"`
+	// The admin who approved or rejected the proposal, and when
+	DecidedBy string     `bson:"decided_by,omitempty"`
+	DecidedAt *time.Time `bson:"decided_at,omitempty"`
 }
@@ -0,0 +1,60 @@
+package models
+
+import "time"
+
+// What started a JobRun
+const (
+	JobTriggerSchedule = "schedule"
+	JobTriggerManual   = "manual"
+	// Started by another job because the job's last success is overdue
+	JobTriggerCatchUp = "catch_up"
+)
+
+// How a JobRun ended
+const (
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+// JobRun records a run of one of the scheduler's jobs
+type JobRun struct {
+	Job     string `bson:"job"`
+	Trigger string `bson:"trigger"`
+	// The admin who ran the job by hand
+	TriggeredBy string `bson:"triggered_by,omitempty"`
+	// The replica of the API that ran the job
+	Replica    string    `bson:"replica"`
+	StartedAt  time.Time `bson:"started_at"`
+	FinishedAt time.Time `bson:"finished_at"`
+	Outcome    string    `bson:"outcome"`
+	// What the job got through, like how many events it synced
+	Counts map[string]int `bson:"counts,omitempty"`
+	Error  string         `bson:"error,omitempty"`
+}
+
+// JobStatus is what admins see of one of the scheduler's jobs
+type JobStatus struct {
+	Name string
+	// An interval like 5m or a cron expression
+	Schedule string
+	// Disabled jobs only run when an admin runs them
+	Disabled bool
+	// Whether any replica of the API is running the job
+	Running bool
+	// The replica running the job and when it started, empty unless Running
+	RunningOn    string
+	RunningSince *time.Time
+	// Nil when the job isn't scheduled
+	NextRun *time.Time
+	// Newest first
+	RecentRuns []JobRun
+}
+
+// Lock is a replica's lease on something only one replica may do at a time,
+// like running a job. The lease lapses at ExpiresAt unless it's renewed.
+type Lock struct {
+	Name       string    `bson:"_id"`
+	Holder     string    `bson:"holder"`
+	AcquiredAt time.Time `bson:"acquired_at"`
+	ExpiresAt  time.Time `bson:"expires_at"`
+}
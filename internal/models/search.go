@@ -0,0 +1,106 @@
+package models
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// How many bytes of context either side of a match a highlight snippet keeps
+const highlightContext = 60
+
+// EventSearchResult is an event matched by a full-text search, ranked by score
+type EventSearchResult struct {
+	DatabaseEvent `bson:",inline"`
+	Score         float64           `bson:"score"`
+	Highlights    map[string]string `bson:"-"`
+}
+
+// EventSearchPage is one page of results from a full-text search
+type EventSearchPage struct {
+	Results    []EventSearchResult
+	NextCursor string
+	Total      int64
+}
+
+// CursorAfter returns the cursor pointing after the search result
+func (r EventSearchResult) CursorAfter() EventCursor {
+	cursor := r.DatabaseEvent.CursorAfter()
+	cursor.Score = r.Score
+	return cursor
+}
+
+// SearchTermsPattern returns a case insensitive pattern matching any of the
+// terms in a Mongo $text search string, or nil if there's nothing to match.
+// Negated terms are left out as they can't appear in a result.
+func SearchTermsPattern(query string) *regexp.Regexp {
+	terms := []string{}
+	for _, term := range strings.Fields(query) {
+		if strings.HasPrefix(term, "-") {
+			continue
+		}
+		term = strings.Trim(term, `"`)
+		if term == "" {
+			continue
+		}
+		terms = append(terms, regexp.QuoteMeta(term))
+
+		// Mongo stems terms, so "talks" also finds "talk"
+		if stem := strings.TrimSuffix(term, "s"); stem != term && len(stem) > 2 {
+			terms = append(terms, regexp.QuoteMeta(stem))
+		}
+	}
+	if len(terms) == 0 {
+		return nil
+	}
+
+	return regexp.MustCompile(`(?i)(` + strings.Join(terms, "|") + `)`)
+}
+
+// Highlight fills in Highlights with a snippet of each searched field that
+// matches pattern, with the matches wrapped in <mark> tags
+func (r *EventSearchResult) Highlight(pattern *regexp.Regexp) {
+	r.Highlights = map[string]string{}
+	if pattern == nil {
+		return
+	}
+
+	fields := map[string]string{
+		"title":                r.Title,
+		"society_name":         r.SocietyName,
+		"location":             r.Location,
+		"description_markdown": r.DescriptionMarkdown,
+	}
+	for name, value := range fields {
+		if snippet := highlightSnippet(value, pattern); snippet != "" {
+			r.Highlights[name] = snippet
+		}
+	}
+}
+
+func highlightSnippet(s string, pattern *regexp.Regexp) string {
+	match := pattern.FindStringIndex(s)
+	if match == nil {
+		return ""
+	}
+
+	start, end := match[0]-highlightContext, match[1]+highlightContext
+	prefix, suffix := "…", "…"
+	if start <= 0 {
+		start, prefix = 0, ""
+	}
+	if end >= len(s) {
+		end, suffix = len(s), ""
+	}
+
+	// Don't cut a multi-byte character in half
+	for start > 0 && !utf8.RuneStart(s[start]) {
+		start--
+	}
+	for end < len(s) && !utf8.RuneStart(s[end]) {
+		end++
+	}
+
+	window := strings.Join(strings.Fields(s[start:end]), " ")
+	return prefix + pattern.ReplaceAllString(window, "<mark>$1</mark>") + suffix
+}
@@ -1,7 +1,10 @@
 package models
 
 import (
+	"fmt"
 	"html"
+	"time"
+	_ "time/tzdata" // the runtime image doesn't ship a zoneinfo database
 
 	md "github.com/JohannesKaufmann/html-to-markdown"
 	"github.com/microcosm-cc/bluemonday"
@@ -60,7 +63,51 @@ type EventDetails struct {
 	EventICalUrl           string `json:"eventICalUrl"`
 }
 
-func (e EventDetails) ToDatabaseEvent() DatabaseEvent {
+// EventLocation is the timezone the societies portal reports event times in.
+// The portal gives us wall clock times without an offset, so everything we
+// parse from it is assumed to be local to the university.
+var EventLocation = mustLoadLocation("Europe/Dublin")
+
+// portalDatetimeLayouts are the formats the societies portal has been seen
+// using for event start and end times, most common first
+var portalDatetimeLayouts = []string{
+	"2006-01-02T15:04",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+func mustLoadLocation(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		log.WithError(err).Fatalf("Failed to load %v timezone", name)
+	}
+	return loc
+}
+
+// ParsePortalDatetime parses a datetime as given by the societies portal,
+// e.g. "2022-09-07T12:00", as a wall clock time in EventLocation. Daylight
+// saving transitions are resolved the same way as time.Date.
+func ParsePortalDatetime(s string) (time.Time, error) {
+	for _, layout := range portalDatetimeLayouts {
+		t, err := time.ParseInLocation(layout, s, EventLocation)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognised societies portal datetime %q", s)
+}
+
+func (e EventDetails) ToDatabaseEvent() (DatabaseEvent, error) {
+
+	start, err := ParsePortalDatetime(e.Start)
+	if err != nil {
+		return DatabaseEvent{}, err
+	}
+	end, err := ParsePortalDatetime(e.End)
+	if err != nil {
+		return DatabaseEvent{}, err
+	}
 
 	pEasy := bluemonday.UGCPolicy()
 	pStrict := bluemonday.StrictPolicy()
@@ -76,14 +123,17 @@ func (e EventDetails) ToDatabaseEvent() DatabaseEvent {
 		Title:                    pStrict.Sanitize(e.Title),
 		SocietyID:                e.OwnerID,
 		SocietyName:              pStrict.Sanitize(e.OwnerTitle),
+		EventType:                pStrict.Sanitize(e.EventTypeTitle),
 		Location:                 pStrict.Sanitize(e.LocationDetails),
+		LocationType:             pStrict.Sanitize(e.LocationTypeTitle),
 		Description:              pStrict.Sanitize(html.UnescapeString(e.DescriptionHTML)),
 		DescriptionMarkdown:      descriptionMarkdown,
 		DangerousDescriptionHTML: pEasy.Sanitize(html.UnescapeString(e.DescriptionHTML)),
-		StartDatetime:            pStrict.Sanitize(e.Start),
-		EndDatetime:              pStrict.Sanitize(e.End),
+		StartDatetime:            start,
+		EndDatetime:              end,
 		DatetimeFormatted:        pStrict.Sanitize(e.StartDateTimeFormatted),
 		EventURL:                 pStrict.Sanitize("https://socs.nuigalway.ie/" + e.EventReadUrl),
 		EventICalURL:             pStrict.Sanitize(e.EventICalUrl),
-	}
+		Status:                   pStrict.Sanitize(e.StatusTypeTitle),
+	}, nil
 }
@@ -0,0 +1,37 @@
+package models
+
+// SocietyStats sums up how active a society is from its events. Cancelled
+// events aren't counted.
+type SocietyStats struct {
+	SocietyID      int
+	SocietyName    string
+	Events         int
+	UpcomingEvents int
+	// In order of month, only months with events are listed
+	EventsPerMonth        []MonthCount
+	EventsPerType         map[string]int
+	EventsPerLocationType map[string]int
+	// Zero when there are no events
+	AverageDurationMinutes float64
+	// The day of the week most events start on in the portal's timezone,
+	// empty when there are no events
+	BusiestWeekday string
+}
+
+// MonthCount is how many events started in a month, YYYY-MM in the portal's
+// timezone
+type MonthCount struct {
+	Month  string
+	Events int
+}
+
+// SocietyRanking is a society's place on the leaderboard of who runs the most
+// events. Societies with as many events share a rank.
+type SocietyRanking struct {
+	Rank                   int
+	SocietyID              int
+	SocietyName            string
+	Events                 int
+	UpcomingEvents         int
+	AverageDurationMinutes float64
+}
@@ -3,9 +3,11 @@ package server
 import (
 	"errors"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	h "github.com/nuigcompsoc/api/internal/helpers"
+	"github.com/nuigcompsoc/api/internal/models"
 )
 
 func (s *Server) RootGet(c *gin.Context) {
@@ -26,6 +28,9 @@ func (s *Server) AuthV1RegisterPost(c *gin.Context) {
 	// If they're a member, sign a token and send it off to them in an email
 
 	// If not, tell them to go register
+
+	h.RespondWithError(c, h.ErrNotImplemented)
+	return
 }
 
 func (s *Server) AuthV1RegisterVerifyGet(c *gin.Context) {
@@ -36,14 +41,23 @@ func (s *Server) AuthV1RegisterVerifyGet(c *gin.Context) {
 	// Register them in LDAP
 
 	// Send out an email on account info
+
+	h.RespondWithError(c, h.ErrNotImplemented)
+	return
 }
 
 func (s *Server) AuthV1OpenIDGet(c *gin.Context) {
 	// Redirect to CompSoc SSO
+
+	h.RespondWithError(c, h.ErrNotImplemented)
+	return
 }
 
 func (s *Server) AuthV1GoogleGet(c *gin.Context) {
 	// Redirect to Society SSO
+
+	h.RespondWithError(c, h.ErrNotImplemented)
+	return
 }
 
 func (s *Server) AuthV1OpenIDCallbackGet(c *gin.Context) {
@@ -52,6 +66,9 @@ func (s *Server) AuthV1OpenIDCallbackGet(c *gin.Context) {
 	// Contact CompSoc SSO to get token
 
 	// Set token received from CompSoc SSO
+
+	h.RespondWithError(c, h.ErrNotImplemented)
+	return
 }
 
 func (s *Server) AuthV1GoogleCallbackGet(c *gin.Context) {
@@ -64,6 +81,9 @@ func (s *Server) AuthV1GoogleCallbackGet(c *gin.Context) {
 	// Make a new LDAP society account if none exists
 
 	// Set token received from Google SSO
+
+	h.RespondWithError(c, h.ErrNotImplemented)
+	return
 }
 
 /***************************
@@ -72,73 +92,286 @@ func (s *Server) AuthV1GoogleCallbackGet(c *gin.Context) {
  *
  ***************************/
 
+// Responds with a page of events, or with just the events as before they
+// were paged when the request didn't ask for a page
+func respondWithEventList(c *gin.Context, page *models.EventPage) {
+	if !paged(c) {
+		h.RespondWithJSON(c, 200, page.Events)
+		return
+	}
+	h.RespondWithPage(c, 200, page.Events, page.NextCursor, page.Total)
+}
+
 func (s *Server) EventsV1Get(c *gin.Context) {
-	events, err := s.Datastore.GetAllEvents()
+	filter, err := parseEventListFilter(c, false)
 	if err != nil {
-		h.RespondWithError(c, 500, errors.New("failed to query database for events"))
+		h.RespondWithError(c, err)
 		return
 	}
 
-	h.RespondWithJSON(c, 200, events)
+	page, err := s.Datastore.GetAllEvents(c.Request.Context(), filter)
+	if err != nil {
+		h.RespondWithError(c, h.ErrDatabase.Because(err))
+		return
+	}
+
+	respondWithEventList(c, page)
 	return
 }
 
 func (s *Server) EventsV1UpcomingGet(c *gin.Context) {
-	events, err := s.Datastore.GetAllUpcomingEvents()
+	filter, err := parseEventListFilter(c, false)
+	if err != nil {
+		h.RespondWithError(c, err)
+		return
+	}
+
+	page, err := s.Datastore.GetAllUpcomingEvents(c.Request.Context(), filter)
 	if err != nil {
-		h.RespondWithError(c, 500, errors.New("failed to query database for events"))
+		h.RespondWithError(c, h.ErrDatabase.Because(err))
 		return
 	}
 
-	h.RespondWithJSON(c, 200, events)
+	respondWithEventList(c, page)
 	return
 }
 
 func (s *Server) EventsV1UpcomingSocIDGet(c *gin.Context) {
 	socID, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		h.RespondWithError(c, 400, errors.New("could not convert socID into integer"))
+		h.RespondWithError(c, h.InvalidParameter("id", "could not convert socID into integer"))
 		return
 	}
 
-	events, err := s.Datastore.GetAllUpcomingEventsForSocID(socID)
+	filter, err := parseEventListFilter(c, false)
 	if err != nil {
-		h.RespondWithError(c, 500, errors.New("failed to query database for events"))
+		h.RespondWithError(c, err)
 		return
 	}
 
-	h.RespondWithJSON(c, 200, events)
+	page, err := s.Datastore.GetAllUpcomingEventsForSocID(c.Request.Context(), socID, filter)
+	if err != nil {
+		h.RespondWithError(c, h.ErrDatabase.Because(err))
+		return
+	}
+
+	respondWithEventList(c, page)
 	return
 }
 
 func (s *Server) EventsV1PastGet(c *gin.Context) {
-	events, err := s.Datastore.GetAllPastEvents()
+	filter, err := parseEventListFilter(c, true)
+	if err != nil {
+		h.RespondWithError(c, err)
+		return
+	}
+
+	page, err := s.Datastore.GetAllPastEvents(c.Request.Context(), filter)
 	if err != nil {
-		h.RespondWithError(c, 500, errors.New("failed to query database for events"))
+		h.RespondWithError(c, h.ErrDatabase.Because(err))
 		return
 	}
 
-	h.RespondWithJSON(c, 200, events)
+	respondWithEventList(c, page)
 	return
 }
 
 func (s *Server) EventsV1PastSocIDGet(c *gin.Context) {
 	socID, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		h.RespondWithError(c, 400, errors.New("could not convert socID into integer"))
+		h.RespondWithError(c, h.InvalidParameter("id", "could not convert socID into integer"))
+		return
+	}
+
+	filter, err := parseEventListFilter(c, true)
+	if err != nil {
+		h.RespondWithError(c, err)
+		return
+	}
+
+	page, err := s.Datastore.GetAllPastEventsForSocID(c.Request.Context(), socID, filter)
+	if err != nil {
+		h.RespondWithError(c, h.ErrDatabase.Because(err))
+		return
+	}
+
+	respondWithEventList(c, page)
+	return
+}
+
+func (s *Server) EventsV1SearchGet(c *gin.Context) {
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" {
+		h.RespondWithError(c, h.InvalidParameter("q", "q must not be empty"))
+		return
+	}
+
+	// Results are ranked by relevance, so sort has no effect here
+	filter, err := parseEventFilter(c, true)
+	if err != nil {
+		h.RespondWithError(c, err)
+		return
+	}
+
+	page, err := s.Datastore.SearchEvents(c.Request.Context(), query, filter)
+	if err != nil {
+		h.RespondWithError(c, h.ErrDatabase.Because(err))
+		return
+	}
+
+	h.RespondWithPage(c, 200, page.Results, page.NextCursor, page.Total)
+	return
+}
+
+func (s *Server) EventsV1EventDetailsIDGet(c *gin.Context) {
+	eventDetailsID, err := strconv.Atoi(c.Param("eventDetailsID"))
+	if err != nil {
+		h.RespondWithError(c, h.InvalidParameter("eventDetailsID", "could not convert eventDetailsID into integer"))
+		return
+	}
+
+	event, err := s.Datastore.GetEventByEventDetailsID(c.Request.Context(), eventDetailsID)
+	if errors.Is(err, models.ErrNotFound) {
+		h.RespondWithError(c, h.ErrNotFound.WithMessage("there is no event with eventDetailsID "+c.Param("eventDetailsID")))
+		return
+	}
+	if err != nil {
+		h.RespondWithError(c, h.ErrDatabase.Because(err))
+		return
+	}
+
+	h.RespondWithJSON(c, 200, event)
+	return
+}
+
+func (s *Server) EventsV1EventDetailsIDEventIDGet(c *gin.Context) {
+	eventDetailsID, err := strconv.Atoi(c.Param("eventDetailsID"))
+	if err != nil {
+		h.RespondWithError(c, h.InvalidParameter("eventDetailsID", "could not convert eventDetailsID into integer"))
+		return
+	}
+
+	eventID, err := strconv.Atoi(c.Param("eventID"))
+	if err != nil {
+		h.RespondWithError(c, h.InvalidParameter("eventID", "could not convert eventID into integer"))
+		return
+	}
+
+	event, err := s.Datastore.GetEventByEventID(c.Request.Context(), eventDetailsID, eventID)
+	if errors.Is(err, models.ErrNotFound) {
+		h.RespondWithError(c, h.ErrNotFound.WithMessage("there is no event with eventID "+c.Param("eventID")+" under eventDetailsID "+c.Param("eventDetailsID")))
+		return
+	}
+	if err != nil {
+		h.RespondWithError(c, h.ErrDatabase.Because(err))
+		return
+	}
+
+	h.RespondWithJSON(c, 200, event)
+	return
+}
+
+func (s *Server) EventsV1ICalGet(c *gin.Context) {
+	page, err := s.Datastore.GetAllEvents(c.Request.Context(), feedEventFilter())
+	if err != nil {
+		h.RespondWithError(c, h.ErrDatabase.Because(err))
+		return
+	}
+
+	h.RespondWithCalendar(c, 200, "University of Galway Society Events", page.Events)
+	return
+}
+
+func (s *Server) EventsV1UpcomingRSSGet(c *gin.Context) {
+	s.respondWithUpcomingFeed(c, h.FeedRSS)
+}
+
+func (s *Server) EventsV1UpcomingAtomGet(c *gin.Context) {
+	s.respondWithUpcomingFeed(c, h.FeedAtom)
+}
+
+func (s *Server) EventsV1UpcomingJSONFeedGet(c *gin.Context) {
+	s.respondWithUpcomingFeed(c, h.FeedJSON)
+}
+
+// Responds with a feed of upcoming events, of all societies or just the one in the path
+func (s *Server) respondWithUpcomingFeed(c *gin.Context, format h.FeedFormat) {
+	filter := models.EventFilter{}
+	feedID := h.FeedID("upcoming")
+	if c.Param("id") != "" {
+		socID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			h.RespondWithError(c, h.InvalidParameter("id", "could not convert socID into integer"))
+			return
+		}
+		filter.SocietyIDs = []int{socID}
+		feedID = h.FeedID("upcoming/society/" + strconv.Itoa(socID))
+	}
+
+	page, err := s.Datastore.GetAllUpcomingEvents(c.Request.Context(), filter)
+	if err != nil {
+		h.RespondWithError(c, h.ErrDatabase.Because(err))
+		return
+	}
+
+	title := "Upcoming University of Galway Society Events"
+	if len(filter.SocietyIDs) > 0 {
+		title = "Upcoming Society " + c.Param("id") + " Events"
+		if len(page.Events) > 0 {
+			title = "Upcoming " + page.Events[0].SocietyName + " Events"
+		}
+	}
+
+	h.RespondWithFeed(c, 200, format, h.Feed{
+		ID:          feedID,
+		Title:       title,
+		Description: "Events run by societies at the University of Galway, as listed on the societies portal",
+		FeedURL:     h.RequestURL(c),
+		HomePageURL: "https://compsoc.ie",
+		Events:      page.Events,
+	})
+}
+
+/***************************
+ *
+ * = SOCIETIES V1 ENDPOINTS =
+ *
+ ***************************/
+
+func (s *Server) SocietiesV1SocIDICalGet(c *gin.Context) {
+	socID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		h.RespondWithError(c, h.InvalidParameter("id", "could not convert socID into integer"))
 		return
 	}
 
-	events, err := s.Datastore.GetAllPastEventsForSocID(socID)
+	page, err := s.Datastore.GetAllEvents(c.Request.Context(), feedEventFilter(socID))
 	if err != nil {
-		h.RespondWithError(c, 500, errors.New("failed to query database for events"))
+		h.RespondWithError(c, h.ErrDatabase.Because(err))
 		return
 	}
 
-	h.RespondWithJSON(c, 200, events)
+	name := "Society " + strconv.Itoa(socID) + " Events"
+	if len(page.Events) > 0 {
+		name = page.Events[0].SocietyName + " Events"
+	}
+
+	h.RespondWithCalendar(c, 200, name, page.Events)
 	return
 }
 
+func (s *Server) SocietiesV1SocIDUpcomingRSSGet(c *gin.Context) {
+	s.respondWithUpcomingFeed(c, h.FeedRSS)
+}
+
+func (s *Server) SocietiesV1SocIDUpcomingAtomGet(c *gin.Context) {
+	s.respondWithUpcomingFeed(c, h.FeedAtom)
+}
+
+func (s *Server) SocietiesV1SocIDUpcomingJSONFeedGet(c *gin.Context) {
+	s.respondWithUpcomingFeed(c, h.FeedJSON)
+}
+
 /***************************
  *
  * === MISC V1 ENDPOINTS ===
@@ -146,7 +379,7 @@ func (s *Server) EventsV1PastSocIDGet(c *gin.Context) {
  ***************************/
 
 func (s *Server) MiscV1BrewGet(c *gin.Context) {
-	h.RespondWithError(c, 418, errors.New("I refuse to brew coffee because I am, permanently, a teapot."))
+	h.RespondWithError(c, h.ErrTeapot)
 	return
 }
 
@@ -0,0 +1,358 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nuigcompsoc/api/internal/models"
+	"github.com/nuigcompsoc/api/internal/services"
+	log "github.com/sirupsen/logrus"
+)
+
+func TestMain(m *testing.M) {
+	// Request logs drown out test failures
+	log.SetLevel(log.WarnLevel)
+	os.Exit(m.Run())
+}
+
+// Events relative to now, so the upcoming/past split is the same whenever the
+// tests run. Weekly Talks (104) recurs, with one instance either side of now.
+func testEvents(now time.Time) []models.DatabaseEvent {
+	event := func(eventID int, eventDetailsID int, socID int, society string, title string, eventType string, start time.Duration, end time.Duration) models.DatabaseEvent {
+		return models.DatabaseEvent{
+			EventID:             eventID,
+			EventDetailsID:      eventDetailsID,
+			Title:               title,
+			SocietyID:           socID,
+			SocietyName:         society,
+			EventType:           eventType,
+			Location:            "Aras an Mac Leinn",
+			LocationType:        "On Campus",
+			DescriptionMarkdown: title + " run by " + society,
+			StartDatetime:       now.Add(start),
+			EndDatetime:         now.Add(end),
+			Status:              "Active",
+		}
+	}
+
+	return []models.DatabaseEvent{
+		event(1, 101, 30, "CompSoc", "Intro to Go Workshop", "Workshop", -72*time.Hour, -70*time.Hour),
+		event(2, 102, 30, "CompSoc", "Game Night", "Social", 48*time.Hour, 52*time.Hour),
+		event(3, 103, 31, "ChessSoc", "Chess Tournament", "Social", 24*time.Hour, 28*time.Hour),
+		event(4, 104, 30, "CompSoc", "Weekly Talks", "Talk", -168*time.Hour, -167*time.Hour),
+		event(5, 104, 30, "CompSoc", "Weekly Talks", "Talk", 168*time.Hour, 169*time.Hour),
+		// Ended half an hour ago, so still upcoming
+		event(6, 105, 31, "ChessSoc", "Chess Lessons", "Other", -90*time.Minute, -30*time.Minute),
+	}
+}
+
+func newTestServer(t *testing.T) *gin.Engine {
+	t.Helper()
+
+	datastore := services.NewMemoryDatastore()
+	if err := datastore.UpsertEvents(context.Background(), testEvents(time.Now().Truncate(time.Second))); err != nil {
+		t.Fatalf("failed to store test events: %v", err)
+	}
+	// ChessSoc has events but isn't in the directory
+	if err := datastore.CreateSociety(context.Background(), models.Society{Name: "CompSoc", SocietiesPortalID: 30}, "test"); err != nil {
+		t.Fatalf("failed to store test society: %v", err)
+	}
+
+	s := &Server{Datastore: datastore}
+	r := SetupRouter()
+	s.routes(r)
+	return r
+}
+
+type eventsResponse struct {
+	Status     int             `json:"status"`
+	Data       json.RawMessage `json:"data"`
+	NextCursor string          `json:"next_cursor"`
+	Total      int64           `json:"total"`
+	Error      struct {
+		Code string `json:"code"`
+	} `json:"error"`
+}
+
+// Returns the IDs of the events in a response, whether it has one or many
+func (r eventsResponse) eventIDs(t *testing.T) []int {
+	t.Helper()
+
+	var events []models.DatabaseEvent
+	if err := json.Unmarshal(r.Data, &events); err != nil {
+		var event models.DatabaseEvent
+		if err := json.Unmarshal(r.Data, &event); err != nil {
+			t.Fatalf("data is neither events nor an event: %s", r.Data)
+		}
+		events = []models.DatabaseEvent{event}
+	}
+
+	ids := []int{}
+	for _, event := range events {
+		ids = append(ids, event.EventID)
+	}
+	return ids
+}
+
+func TestEventsEndpoints(t *testing.T) {
+	r := newTestServer(t)
+
+	tests := []struct {
+		name   string
+		path   string
+		accept string
+		status int
+		// For JSON responses, the events expected in order
+		eventIDs []int
+		total    int64
+		// For other responses
+		contentType string
+		contains    []string
+		excludes    []string
+		errorCode   string
+	}{
+		{name: "all events", path: "/v1/events", status: 200, eventIDs: []int{4, 1, 6, 3, 2, 5}},
+		{name: "all events descending", path: "/v1/events?sort=desc", status: 200, eventIDs: []int{5, 2, 3, 6, 1, 4}},
+		{name: "events of a society", path: "/v1/events?society_id=31", status: 200, eventIDs: []int{6, 3}},
+		{name: "events of several societies", path: "/v1/events?society_id=31&society_id=30&event_type=Social", status: 200, eventIDs: []int{3, 2}},
+		{name: "events by type", path: "/v1/events?event_type=Talk,Workshop", status: 200, eventIDs: []int{4, 1, 5}},
+		{name: "events in a range", path: "/v1/events?from=" + url.QueryEscape(time.Now().Add(time.Hour).Format(time.RFC3339)) + "&to=" + url.QueryEscape(time.Now().Add(72*time.Hour).Format(time.RFC3339)), status: 200, eventIDs: []int{3, 2}},
+		{name: "first page of events", path: "/v1/events?limit=2", status: 200, eventIDs: []int{4, 1}, total: 6},
+		// Clients from before events were paged get them all, without paging fields
+		{name: "events unpaged", path: "/v1/events", status: 200, contains: []string{`"data":[`}, excludes: []string{"next_cursor", `"total"`}},
+		{name: "upcoming events unpaged", path: "/v1/events/upcoming/30", status: 200, contains: []string{`"data":[`}, excludes: []string{"next_cursor", `"total"`}},
+		{name: "events paged by cursor", path: "/v1/events?cursor=" + url.QueryEscape(testEvents(time.Now())[0].CursorAfter().Encode()), status: 200, contains: []string{"next_cursor", `"total"`}},
+		{name: "events as CSV", path: "/v1/events?format=csv", status: 200, contentType: "text/csv", contains: []string{"Game Night", "Chess Lessons"}},
+		{name: "limit too small", path: "/v1/events?limit=0", status: 400, errorCode: "invalid_parameter"},
+		{name: "limit too big", path: "/v1/events?limit=501", status: 400, errorCode: "invalid_parameter"},
+		{name: "bad sort", path: "/v1/events?sort=sideways", status: 400, errorCode: "invalid_parameter"},
+		{name: "bad from", path: "/v1/events?from=yesterday", status: 400, errorCode: "invalid_parameter"},
+		{name: "bad society ID", path: "/v1/events?society_id=compsoc", status: 400, errorCode: "invalid_parameter"},
+		{name: "bad cursor", path: "/v1/events?cursor=!!!", status: 400, errorCode: "invalid_parameter"},
+		{name: "unacceptable format", path: "/v1/events?format=pdf", status: 406, errorCode: "not_acceptable"},
+		{name: "events in a browser", path: "/v1/events", accept: "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", status: 200, eventIDs: []int{4, 1, 6, 3, 2, 5}},
+		{name: "events as XML", path: "/v1/events", accept: "application/xml", status: 200, contentType: "application/xml", contains: []string{"<response>", "<Title>Game Night</Title>"}},
+		{name: "events as YAML", path: "/v1/events", accept: "application/yaml", status: 200, contentType: "application/yaml", contains: []string{"Title: Game Night"}},
+		{name: "unacceptable Accept", path: "/v1/events", accept: "text/html", status: 406, errorCode: "not_acceptable"},
+		{name: "error with an unacceptable Accept", path: "/v1/events/999", accept: "text/html", status: 404, contentType: "application/json", errorCode: "not_found"},
+		{name: "error with an unacceptable format", path: "/v1/events/999?format=pdf", status: 404, contentType: "application/json", errorCode: "not_found"},
+		{name: "calendar error", path: "/v1/societies/chess/events.ics", accept: "text/calendar", status: 400, contentType: "application/json", errorCode: "invalid_parameter"},
+
+		{name: "upcoming events", path: "/v1/events/upcoming", status: 200, eventIDs: []int{6, 3, 2, 5}},
+		{name: "upcoming events descending", path: "/v1/events/upcoming?sort=desc", status: 200, eventIDs: []int{5, 2, 3, 6}},
+		{name: "upcoming events of a society", path: "/v1/events/upcoming/30", status: 200, eventIDs: []int{2, 5}},
+		{name: "upcoming events of a society without any", path: "/v1/events/upcoming/99", status: 200, eventIDs: []int{}},
+		{name: "upcoming events of a bad society ID", path: "/v1/events/upcoming/compsoc", status: 400, errorCode: "invalid_parameter"},
+
+		{name: "past events", path: "/v1/events/past", status: 200, eventIDs: []int{1, 4}},
+		{name: "past events ascending", path: "/v1/events/past?sort=asc", status: 200, eventIDs: []int{4, 1}},
+		{name: "past events of a society", path: "/v1/events/past/30", status: 200, eventIDs: []int{1, 4}},
+		{name: "past events of a society without any", path: "/v1/events/past/31", status: 200, eventIDs: []int{}},
+		{name: "past events of a bad society ID", path: "/v1/events/past/compsoc", status: 400, errorCode: "invalid_parameter"},
+
+		{name: "search", path: "/v1/events/search?q=chess", status: 200, eventIDs: []int{3, 6}, total: 2},
+		{name: "search excluding a term", path: "/v1/events/search?q=" + url.QueryEscape("chess -tournament"), status: 200, eventIDs: []int{6}, total: 1},
+		{name: "search for a phrase", path: "/v1/events/search?q=" + url.QueryEscape(`"weekly talks"`), status: 200, eventIDs: []int{5, 4}, total: 2},
+		{name: "search with a filter", path: "/v1/events/search?q=chess&event_type=Other", status: 200, eventIDs: []int{6}, total: 1},
+		{name: "search without results", path: "/v1/events/search?q=quidditch", status: 200, eventIDs: []int{}, total: 0},
+		{name: "search without a query", path: "/v1/events/search?q=%20", status: 400, errorCode: "invalid_parameter"},
+
+		{name: "event", path: "/v1/events/101", status: 200, eventIDs: []int{1}},
+		{name: "recurring event is its next instance", path: "/v1/events/104", status: 200, eventIDs: []int{5}},
+		{name: "missing event", path: "/v1/events/999", status: 404, errorCode: "not_found"},
+		{name: "bad event details ID", path: "/v1/events/game-night", status: 400, errorCode: "invalid_parameter"},
+		{name: "instance of a recurring event", path: "/v1/events/104/4", status: 200, eventIDs: []int{4}},
+		{name: "missing instance", path: "/v1/events/104/1", status: 404, errorCode: "not_found"},
+		{name: "bad event ID", path: "/v1/events/104/first", status: 400, errorCode: "invalid_parameter"},
+
+		{name: "calendar", path: "/v1/events.ics", status: 200, contentType: "text/calendar", contains: []string{"BEGIN:VCALENDAR", "SUMMARY:Game Night", "SUMMARY:Chess Lessons"}},
+		{name: "RSS feed", path: "/v1/events/upcoming.rss", status: 200, contentType: "application/rss+xml", contains: []string{"<rss", "Game Night"}, excludes: []string{"Intro to Go Workshop"}},
+		{name: "Atom feed", path: "/v1/events/upcoming.atom", status: 200, contentType: "application/atom+xml", contains: []string{"<feed", "<id>tag:api.compsoc.ie,2022:feeds/upcoming</id>", "Game Night"}, excludes: []string{"Intro to Go Workshop"}},
+		{name: "Atom feed ID ignores the query", path: "/v1/events/upcoming.atom?utm_source=newsletter", status: 200, contentType: "application/atom+xml", contains: []string{"<id>tag:api.compsoc.ie,2022:feeds/upcoming</id>"}},
+		{name: "JSON feed", path: "/v1/events/upcoming.json", status: 200, contentType: "application/feed+json", contains: []string{"https://jsonfeed.org/version/1.1", "Game Night"}, excludes: []string{"Intro to Go Workshop"}},
+
+		{name: "society calendar", path: "/v1/societies/31/events.ics", status: 200, contentType: "text/calendar", contains: []string{"X-WR-CALNAME:ChessSoc Events", "SUMMARY:Chess Tournament"}, excludes: []string{"Game Night"}},
+		{name: "society calendar of a bad society ID", path: "/v1/societies/chess/events.ics", status: 400, errorCode: "invalid_parameter"},
+		{name: "society RSS feed", path: "/v1/societies/31/events/upcoming.rss", status: 200, contentType: "application/rss+xml", contains: []string{"Upcoming ChessSoc Events", "Chess Tournament"}, excludes: []string{"Game Night"}},
+		{name: "society Atom feed", path: "/v1/societies/31/events/upcoming.atom", status: 200, contentType: "application/atom+xml", contains: []string{"<id>tag:api.compsoc.ie,2022:feeds/upcoming/society/31</id>", "Chess Tournament"}, excludes: []string{"Game Night"}},
+		{name: "society JSON feed", path: "/v1/societies/31/events/upcoming.json", status: 200, contentType: "application/feed+json", contains: []string{"Chess Tournament"}, excludes: []string{"Game Night"}},
+		{name: "society feed of a bad society ID", path: "/v1/societies/chess/events/upcoming.json", status: 400, errorCode: "invalid_parameter"},
+
+		{name: "society stats", path: "/v1/societies/30/stats", status: 200, contains: []string{`"SocietyName":"CompSoc"`, `"Events":4`, `"UpcomingEvents":2`, `"Talk":2`}},
+		{name: "society stats from a date", path: "/v1/societies/30/stats?from=" + url.QueryEscape(time.Now().Format(time.RFC3339)), status: 200, contains: []string{`"Events":2`}},
+		{name: "society stats of a society not in the directory", path: "/v1/societies/31/stats", status: 404, errorCode: "not_found"},
+		{name: "society stats with a bad from", path: "/v1/societies/30/stats?from=yesterday", status: 400, errorCode: "invalid_parameter"},
+		{name: "leaderboard", path: "/v1/societies/leaderboard", status: 200, contains: []string{`"Rank":1,"SocietyID":30`, `"Rank":2,"SocietyID":31`}},
+		{name: "leaderboard limited", path: "/v1/societies/leaderboard?limit=1", status: 200, contains: []string{`"SocietyID":30`}, excludes: []string{`"SocietyID":31`}},
+		{name: "leaderboard of event types", path: "/v1/societies/leaderboard?event_type=Social,Other", status: 200, contains: []string{`"Rank":1,"SocietyID":31`}},
+		{name: "leaderboard with a bad limit", path: "/v1/societies/leaderboard?limit=0", status: 400, errorCode: "invalid_parameter"},
+
+		{name: "auth isn't built yet", path: "/v1/auth/openid", status: 501, errorCode: "not_implemented"},
+		{name: "auth callbacks aren't built yet", path: "/v1/auth/google/callback", status: 501, errorCode: "not_implemented"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("responded %v, want %v: %s", w.Code, tt.status, w.Body.String())
+			}
+			if tt.contentType != "" && !strings.HasPrefix(w.Header().Get("Content-Type"), tt.contentType) {
+				t.Errorf("Content-Type is %q, want %q", w.Header().Get("Content-Type"), tt.contentType)
+			}
+			for _, s := range tt.contains {
+				if !strings.Contains(w.Body.String(), s) {
+					t.Errorf("response does not contain %q: %s", s, w.Body.String())
+				}
+			}
+			for _, s := range tt.excludes {
+				if strings.Contains(w.Body.String(), s) {
+					t.Errorf("response contains %q: %s", s, w.Body.String())
+				}
+			}
+
+			if tt.eventIDs == nil && tt.errorCode == "" {
+				return
+			}
+			var body eventsResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("response is not JSON: %v", err)
+			}
+			if tt.errorCode != "" {
+				if body.Error.Code != tt.errorCode {
+					t.Errorf("error code is %q, want %q", body.Error.Code, tt.errorCode)
+				}
+				return
+			}
+			if ids := body.eventIDs(t); !reflect.DeepEqual(ids, tt.eventIDs) {
+				t.Errorf("got events %v, want %v", ids, tt.eventIDs)
+			}
+			if tt.total != 0 && body.Total != tt.total {
+				t.Errorf("total is %v, want %v", body.Total, tt.total)
+			}
+		})
+	}
+}
+
+func TestEventsPagination(t *testing.T) {
+	r := newTestServer(t)
+
+	tests := []struct {
+		name  string
+		path  string
+		pages [][]int
+	}{
+		{name: "all events", path: "/v1/events?limit=4", pages: [][]int{{4, 1, 6, 3}, {2, 5}}},
+		{name: "all events descending", path: "/v1/events?limit=2&sort=desc", pages: [][]int{{5, 2}, {3, 6}, {1, 4}}},
+		{name: "upcoming events", path: "/v1/events/upcoming?limit=3", pages: [][]int{{6, 3, 2}, {5}}},
+		{name: "past events", path: "/v1/events/past?limit=1", pages: [][]int{{1}, {4}}},
+		{name: "search", path: "/v1/events/search?q=chess&limit=1", pages: [][]int{{3}, {6}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := tt.path
+			for i, want := range tt.pages {
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+				if w.Code != http.StatusOK {
+					t.Fatalf("page %v responded %v: %s", i, w.Code, w.Body.String())
+				}
+
+				var body eventsResponse
+				if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+					t.Fatalf("page %v is not JSON: %v", i, err)
+				}
+				if ids := body.eventIDs(t); !reflect.DeepEqual(ids, want) {
+					t.Errorf("page %v has events %v, want %v", i, ids, want)
+				}
+				if w.Header().Get("X-Next-Cursor") != body.NextCursor {
+					t.Errorf("page %v has X-Next-Cursor %q but next_cursor %q", i, w.Header().Get("X-Next-Cursor"), body.NextCursor)
+				}
+
+				last := i == len(tt.pages)-1
+				if last != (body.NextCursor == "") {
+					t.Fatalf("page %v has next_cursor %q", i, body.NextCursor)
+				}
+				path = tt.path + "&cursor=" + url.QueryEscape(body.NextCursor)
+			}
+		})
+	}
+}
+
+func TestFeedsConditionalRequests(t *testing.T) {
+	r := newTestServer(t)
+	get := func(path string, header string, value string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	for _, path := range []string{
+		"/v1/events.ics",
+		"/v1/events/upcoming.rss",
+		"/v1/events/upcoming.atom",
+		"/v1/events/upcoming.json",
+		// Empty feeds are just as stable
+		"/v1/societies/99/events/upcoming.atom",
+		"/v1/societies/99/events/upcoming.json",
+	} {
+		t.Run(path, func(t *testing.T) {
+			w := get(path, "", "")
+			etag := w.Header().Get("ETag")
+			if w.Code != http.StatusOK || etag == "" {
+				t.Fatalf("responded %v with ETag %q", w.Code, etag)
+			}
+			if w.Header().Get("Last-Modified") != "" {
+				t.Errorf("responded with Last-Modified %q", w.Header().Get("Last-Modified"))
+			}
+			if again := get(path, "", ""); again.Header().Get("ETag") != etag || again.Body.String() != w.Body.String() {
+				t.Errorf("responded differently the second time, with ETag %q", again.Header().Get("ETag"))
+			}
+
+			tests := []struct {
+				name   string
+				header string
+				value  string
+				status int
+			}{
+				{name: "matching tag", header: "If-None-Match", value: etag, status: http.StatusNotModified},
+				{name: "weak tag", header: "If-None-Match", value: "W/" + etag, status: http.StatusNotModified},
+				{name: "list of tags", header: "If-None-Match", value: `"stale", ` + etag, status: http.StatusNotModified},
+				{name: "any tag", header: "If-None-Match", value: "*", status: http.StatusNotModified},
+				{name: "stale tag", header: "If-None-Match", value: `"stale"`, status: http.StatusOK},
+				// Feeds change without any event in them being modified
+				{name: "modified since", header: "If-Modified-Since", value: time.Now().Add(time.Hour).UTC().Format(http.TimeFormat), status: http.StatusOK},
+			}
+			for _, tt := range tests {
+				w := get(path, tt.header, tt.value)
+				if w.Code != tt.status {
+					t.Errorf("%v: responded %v, want %v", tt.name, w.Code, tt.status)
+				}
+				if w.Code == http.StatusNotModified && w.Body.Len() != 0 {
+					t.Errorf("%v: not modified response has a body: %s", tt.name, w.Body.String())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	h "github.com/nuigcompsoc/api/internal/helpers"
+	"github.com/nuigcompsoc/api/internal/models"
+)
+
+const (
+	defaultEventsLimit = 100
+	maxEventsLimit     = 500
+
+	// How far back subscribable feeds like calendars go
+	feedHistory = 6 * 30 * 24 * time.Hour
+)
+
+// Returns the filter for events that belong in a subscribable feed
+func feedEventFilter(societyIDs ...int) models.EventFilter {
+	return models.EventFilter{
+		From:       time.Now().Add(-feedHistory),
+		SocietyIDs: societyIDs,
+	}
+}
+
+/*
+ * Builds an EventFilter from the query parameters of an events request:
+ *   from, to        RFC 3339 datetimes or dates (YYYY-MM-DD), events overlapping the range are returned
+ *   society_id      society IDs, comma separated or repeated
+ *   location_type   location types e.g. "On Campus", comma separated or repeated
+ *   event_type      event types e.g. "Other", comma separated or repeated
+ *   sort            "asc" or "desc" by start datetime
+ *   limit           page size, 1 to 500
+ *   cursor          next_cursor from a previous page
+ */
+func parseEventFilter(c *gin.Context, descendingByDefault bool) (models.EventFilter, error) {
+	filter := models.EventFilter{
+		Descending: descendingByDefault,
+		Limit:      defaultEventsLimit,
+	}
+
+	var err error
+	if err = parseEventConditions(c, &filter); err != nil {
+		return filter, err
+	}
+
+	switch c.Query("sort") {
+	case "":
+	case "asc":
+		filter.Descending = false
+	case "desc":
+		filter.Descending = true
+	default:
+		return filter, h.InvalidParameter("sort", "sort must be either asc or desc")
+	}
+
+	if limit := c.Query("limit"); limit != "" {
+		filter.Limit, err = strconv.ParseInt(limit, 10, 64)
+		if err != nil || filter.Limit < 1 || filter.Limit > maxEventsLimit {
+			return filter, h.InvalidParameter("limit", "limit must be an integer between 1 and "+strconv.Itoa(maxEventsLimit))
+		}
+	}
+
+	if cursor := c.Query("cursor"); cursor != "" {
+		if filter.After, err = models.ParseEventCursor(cursor); err != nil {
+			return filter, h.InvalidParameter("cursor", err.Error())
+		}
+	}
+
+	return filter, nil
+}
+
+// parseEventListFilter is parseEventFilter for the event lists that returned
+// every event before they were paged. They still do unless the request
+// passes limit or cursor, so clients like compsoc.ie and the Discord bots
+// keep getting every event.
+func parseEventListFilter(c *gin.Context, descendingByDefault bool) (models.EventFilter, error) {
+	filter, err := parseEventFilter(c, descendingByDefault)
+	if !paged(c) {
+		filter.Limit = 0
+	}
+	return filter, err
+}
+
+// Whether the request asks for a page of results
+func paged(c *gin.Context) bool {
+	return c.Query("limit") != "" || c.Query("cursor") != ""
+}
+
+// Fills in which events filter matches from the from, to, society_id,
+// location_type and event_type query parameters, leaving ordering and paging
+func parseEventConditions(c *gin.Context, filter *models.EventFilter) error {
+	var err error
+	if from := c.Query("from"); from != "" {
+		if filter.From, err = parseFilterDatetime(from); err != nil {
+			return h.InvalidParameter("from", "could not parse from as a datetime")
+		}
+	}
+	if to := c.Query("to"); to != "" {
+		if filter.To, err = parseFilterDatetime(to); err != nil {
+			return h.InvalidParameter("to", "could not parse to as a datetime")
+		}
+	}
+
+	for _, id := range queryList(c, "society_id") {
+		socID, err := strconv.Atoi(id)
+		if err != nil {
+			return h.InvalidParameter("society_id", "could not convert society_id into integer")
+		}
+		filter.SocietyIDs = append(filter.SocietyIDs, socID)
+	}
+	filter.LocationTypes = queryList(c, "location_type")
+	filter.EventTypes = queryList(c, "event_type")
+
+	return nil
+}
+
+// Dates without a time are taken as midnight in the portal's timezone
+func parseFilterDatetime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", s, models.EventLocation)
+}
+
+// Returns every value given for a query parameter, splitting comma separated lists
+func queryList(c *gin.Context, key string) []string {
+	values := []string{}
+	for _, value := range c.QueryArray(key) {
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+	}
+	return values
+}
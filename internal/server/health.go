@@ -0,0 +1,165 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	h "github.com/nuigcompsoc/api/internal/helpers"
+	"github.com/nuigcompsoc/api/internal/services"
+)
+
+const (
+	// How long each dependency has to respond before it's considered down
+	readinessCheckTimeout = 5 * time.Second
+	// Events sync every 5 minutes, so a few missed runs means something is up
+	maxEventSyncAge = 30 * time.Minute
+)
+
+// Statuses of a dependency, or of the API as a whole
+const (
+	StatusOK       = "ok"
+	StatusDegraded = "degraded"
+	StatusDown     = "down"
+)
+
+// Readiness describes whether the API can serve requests, and why not
+type Readiness struct {
+	// ok, degraded if a non critical dependency is down, or down
+	Status string                      `json:"status"`
+	Checks map[string]DependencyStatus `json:"checks"`
+}
+
+// DependencyStatus is the outcome of checking a single dependency
+type DependencyStatus struct {
+	Status string `json:"status"`
+	// Whether the API is unready while this dependency is down
+	Critical  bool    `json:"critical"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+	// Only for the societies portal sync
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+	AgeSeconds  *float64   `json:"age_seconds,omitempty"`
+}
+
+// Routes polled by Traefik and Docker rather than people, so they live
+// outside of /v1 and skip the request logging
+func (s *Server) healthRouter(r *gin.Engine) {
+	r.GET("/healthz", s.HealthzGet)
+	r.GET("/readyz", s.ReadyzGet)
+}
+
+// The process is up and handling requests, nothing more
+func (s *Server) HealthzGet(c *gin.Context) {
+	h.RespondWithString(c, http.StatusOK, "OK")
+}
+
+// Checks every dependency and responds with 503 if a critical one is down
+func (s *Server) ReadyzGet(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), readinessCheckTimeout)
+	defer cancel()
+
+	readiness := s.readiness(ctx)
+	code := http.StatusOK
+	if readiness.Status == StatusDown {
+		code = http.StatusServiceUnavailable
+	}
+	h.RespondWithJSON(c, code, readiness)
+}
+
+// Runs the dependency checks concurrently so the slowest sets the latency
+func (s *Server) readiness(ctx context.Context) Readiness {
+	checks := map[string]func(context.Context) DependencyStatus{
+		"database": func(ctx context.Context) DependencyStatus {
+			return timeCheck(true, func() error {
+				if s.Datastore == nil {
+					return errors.New("no datastore")
+				}
+				return s.Datastore.Ping(ctx)
+			})
+		},
+		"ldap": func(ctx context.Context) DependencyStatus {
+			// Only registration and sign in need LDAP
+			return timeCheck(false, func() error { return services.CheckLdapBind(ctx, &s.Config) })
+		},
+		"societies_portal_sync": func(ctx context.Context) DependencyStatus {
+			return s.eventSyncStatus(ctx)
+		},
+	}
+
+	readiness := Readiness{Status: StatusOK, Checks: map[string]DependencyStatus{}}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check func(context.Context) DependencyStatus) {
+			defer wg.Done()
+			status := check(ctx)
+
+			mu.Lock()
+			defer mu.Unlock()
+			readiness.Checks[name] = status
+			if status.Status != StatusOK {
+				if status.Critical {
+					readiness.Status = StatusDown
+				} else if readiness.Status == StatusOK {
+					readiness.Status = StatusDegraded
+				}
+			}
+		}(name, check)
+	}
+	wg.Wait()
+
+	return readiness
+}
+
+func timeCheck(critical bool, check func() error) DependencyStatus {
+	start := time.Now()
+	err := check()
+
+	status := DependencyStatus{
+		Status:    StatusOK,
+		Critical:  critical,
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		status.Status = StatusDown
+		status.Error = err.Error()
+	}
+	return status
+}
+
+// Events are still served while the sync is failing, they just go stale
+func (s *Server) eventSyncStatus(ctx context.Context) DependencyStatus {
+	status := DependencyStatus{Status: StatusOK}
+	if s.Scheduler == nil {
+		status.Status = StatusDown
+		status.Error = "the scheduler is not running"
+		return status
+	}
+
+	lastSuccess, err := s.Scheduler.LastEventSync(ctx)
+	if err != nil {
+		status.Status = StatusDown
+		status.Error = err.Error()
+		return status
+	}
+	if lastSuccess.IsZero() {
+		status.Status = StatusDown
+		status.Error = "events have never been synced"
+		return status
+	}
+
+	age := time.Since(lastSuccess)
+	ageSeconds := age.Seconds()
+	status.LastSuccess = &lastSuccess
+	status.AgeSeconds = &ageSeconds
+	if age > maxEventSyncAge {
+		status.Status = StatusDown
+		status.Error = "events have not been synced for over " + maxEventSyncAge.String()
+	}
+	return status
+}
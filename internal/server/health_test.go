@@ -0,0 +1,70 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHealthEndpoints(t *testing.T) {
+	// No datastore at all, so the database check fails
+	down := SetupRouter()
+	(&Server{}).routes(down)
+
+	tests := []struct {
+		name   string
+		server http.Handler
+		path   string
+		status int
+		// Overall readiness, empty for /healthz
+		readiness string
+	}{
+		{name: "alive", server: newTestServer(t), path: "/healthz", status: http.StatusOK},
+		{name: "alive without database", server: down, path: "/healthz", status: http.StatusOK},
+		// LDAP and the portal sync aren't set up, but neither is critical
+		{name: "degraded", server: newTestServer(t), path: "/readyz", status: http.StatusOK, readiness: StatusDegraded},
+		{name: "database down", server: down, path: "/readyz", status: http.StatusServiceUnavailable, readiness: StatusDown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			tt.server.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+
+			if w.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+			if tt.readiness == "" {
+				return
+			}
+
+			var resp struct {
+				Status int       `json:"status"`
+				Data   Readiness `json:"data"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("body isn't readiness JSON: %s", w.Body.String())
+			}
+			if resp.Status != tt.status {
+				t.Errorf("body status %d, want %d", resp.Status, tt.status)
+			}
+			readiness := resp.Data
+			if readiness.Status != tt.readiness {
+				t.Errorf("readiness %q, want %q", readiness.Status, tt.readiness)
+			}
+			database, ok := readiness.Checks["database"]
+			if !ok || !database.Critical {
+				t.Fatalf("database check missing or not critical: %+v", readiness.Checks)
+			}
+			if wantDown := tt.readiness == StatusDown; (database.Status == StatusDown) != wantDown {
+				t.Errorf("database check %q with readiness %q", database.Status, tt.readiness)
+			}
+			for _, name := range []string{"ldap", "societies_portal_sync"} {
+				if check, ok := readiness.Checks[name]; !ok || check.Critical {
+					t.Errorf("%s check missing or critical: %+v", name, check)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	h "github.com/nuigcompsoc/api/internal/helpers"
+	"github.com/nuigcompsoc/api/internal/models"
+)
+
+/***************************
+ *
+ * = ADMIN V1 ENDPOINTS =
+ *
+ ***************************/
+
+// Lists the scheduler's jobs, whether they're running and their recent runs
+func (s *Server) AdminV1JobsGet(c *gin.Context) {
+	if s.Scheduler == nil {
+		h.RespondWithError(c, h.ErrInternal.WithMessage("the scheduler is not running"))
+		return
+	}
+
+	statuses, err := s.Scheduler.JobStatuses(c.Request.Context())
+	if err != nil {
+		h.RespondWithError(c, h.ErrDatabase.Because(err))
+		return
+	}
+
+	h.RespondWithJSON(c, 200, statuses)
+	return
+}
+
+// Runs a job in the background now, responding with its status once it has
+// started
+func (s *Server) AdminV1JobsNameRunPost(c *gin.Context) {
+	if s.Scheduler == nil {
+		h.RespondWithError(c, h.ErrInternal.WithMessage("the scheduler is not running"))
+		return
+	}
+
+	name := c.Param("name")
+	err := s.Scheduler.TriggerJob(c.Request.Context(), name, c.GetString(h.AdminKey))
+	if errors.Is(err, models.ErrNotFound) {
+		h.RespondWithError(c, h.ErrNotFound.WithMessage("there is no job called "+name))
+		return
+	}
+	if errors.Is(err, models.ErrConflict) {
+		h.RespondWithError(c, h.ErrConflict.WithMessage("the job is already running"))
+		return
+	}
+	if err != nil {
+		h.RespondWithError(c, h.ErrDatabase.Because(err))
+		return
+	}
+
+	status, err := s.Scheduler.JobStatus(c.Request.Context(), s.Scheduler.Job(name))
+	if err != nil {
+		h.RespondWithError(c, h.ErrDatabase.Because(err))
+		return
+	}
+
+	h.RespondWithJSON(c, 202, status)
+	return
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nuigcompsoc/api/internal/models"
+	"github.com/nuigcompsoc/api/internal/services"
+)
+
+func TestAdminJobsEndpoints(t *testing.T) {
+	s := &Server{Datastore: services.NewMemoryDatastore()}
+	s.Config.Admin.Tokens = map[string]string{"tester": testAdminToken}
+	s.Scheduler = services.NewSchedulerService(&s.Config, s.Datastore)
+	release := make(chan struct{})
+	s.Scheduler.Register("test", "1h", func(ctx context.Context) (map[string]int, error) {
+		<-release
+		return map[string]int{"things": 1}, nil
+	})
+	r := SetupRouter()
+	s.routes(r)
+
+	request := func(method string, path string, token string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+	jobs := func() []models.JobStatus {
+		w := request("GET", "/v1/admin/jobs", testAdminToken)
+		var body struct {
+			Data []models.JobStatus `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || w.Code != 200 {
+			t.Fatalf("listing jobs responded %v: %s", w.Code, w.Body.String())
+		}
+		return body.Data
+	}
+
+	// Each step builds on the ones before it
+	steps := []struct {
+		name      string
+		method    string
+		path      string
+		token     string
+		status    int
+		errorCode string
+	}{
+		{name: "list without a token", method: "GET", path: "/v1/admin/jobs", status: 401, errorCode: "unauthorized"},
+		{name: "run without a token", method: "POST", path: "/v1/admin/jobs/test/run", status: 401, errorCode: "unauthorized"},
+		{name: "run missing", method: "POST", path: "/v1/admin/jobs/missing/run", token: testAdminToken, status: 404, errorCode: "not_found"},
+		{name: "run", method: "POST", path: "/v1/admin/jobs/test/run", token: testAdminToken, status: 202},
+		{name: "run while running", method: "POST", path: "/v1/admin/jobs/test/run", token: testAdminToken, status: 409, errorCode: "conflict"},
+	}
+	for _, step := range steps {
+		w := request(step.method, step.path, step.token)
+		if w.Code != step.status {
+			t.Fatalf("%v: responded %v, want %v: %s", step.name, w.Code, step.status, w.Body.String())
+		}
+		if step.errorCode != "" {
+			var body eventsResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Error.Code != step.errorCode {
+				t.Errorf("%v: error code is %q, want %q", step.name, body.Error.Code, step.errorCode)
+			}
+		}
+	}
+
+	statuses := jobs()
+	names := []string{}
+	for _, status := range statuses {
+		names = append(names, status.Name)
+	}
+	if want := []string{services.JobSyncUpcomingEvents, services.JobSyncAllEvents, services.JobDiscoverSocieties, "test"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("jobs are %v, want %v", names, want)
+	}
+	if test := statuses[3]; !test.Running || test.Schedule != "1h" {
+		t.Errorf("running job has status %+v", test)
+	}
+
+	close(release)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		test := jobs()[3]
+		if !test.Running && len(test.RecentRuns) == 1 {
+			run := test.RecentRuns[0]
+			if run.Trigger != models.JobTriggerManual || run.TriggeredBy != "tester" || run.Outcome != models.JobSucceeded || run.Counts["things"] != 1 {
+				t.Errorf("run is %+v", run)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job never finished, its status is %+v", test)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -1,12 +1,19 @@
 package server
 
 import (
-	"errors"
+	"crypto/subtle"
+	"fmt"
+	"runtime/debug"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	h "github.com/nuigcompsoc/api/internal/helpers"
+	"github.com/nuigcompsoc/api/internal/logging"
+	"github.com/nuigcompsoc/api/internal/metrics"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 /*
@@ -18,6 +25,63 @@ func (s *Server) MiscMiddleware() gin.HandlerFunc {
 	}
 }
 
+/*
+ * This middleware gives every request an ID, either the X-Request-ID it came
+ * with or a new one, and a logrus entry carrying it on the request's context
+ * for handlers and services to log with. The ID is sent back in X-Request-ID
+ * and in error bodies so users can quote it when reporting problems.
+ */
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(h.RequestIDHeader)
+		if !h.ValidRequestID(requestID) {
+			requestID = h.NewRequestID()
+		}
+
+		c.Set(h.RequestIDKey, requestID)
+		c.Header(h.RequestIDHeader, requestID)
+
+		fields := log.Fields{
+			"request_id": requestID,
+			"method":     c.Request.Method,
+			"path":       c.Request.URL.Path,
+		}
+		if span := trace.SpanFromContext(c.Request.Context()); span.SpanContext().IsValid() {
+			fields["trace_id"] = span.SpanContext().TraceID().String()
+			span.SetAttributes(attribute.String("request_id", requestID))
+		}
+		entry := log.WithFields(fields)
+		c.Request = c.Request.WithContext(logging.WithEntry(c.Request.Context(), entry))
+
+		c.Next()
+	}
+}
+
+/*
+ * This middleware only lets through requests with one of the admin tokens in
+ * an Authorization: Bearer header, noting whose token it was for the handler.
+ * With no tokens configured nobody gets through.
+ */
+func (s *Server) AdminMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if token != "" && token != c.GetHeader("Authorization") {
+			for name, adminToken := range s.Config.Admin.Tokens {
+				if adminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) == 1 {
+					c.Set(h.AdminKey, name)
+					entry := logging.FromContext(c.Request.Context()).WithField("admin", name)
+					c.Request = c.Request.WithContext(logging.WithEntry(c.Request.Context(), entry))
+					c.Next()
+					return
+				}
+			}
+		}
+
+		c.Header("WWW-Authenticate", `Bearer realm="compsoc-api"`)
+		h.RespondWithError(c, h.ErrUnauthorized)
+	}
+}
+
 /*
  * This middleware logs primarily the request path, method, response status and completion latency
  */
@@ -35,20 +99,63 @@ func (s *Server) LoggingMiddleware() gin.HandlerFunc {
 
 		logFields["latency_ns"] = time.Since(start).Nanoseconds()
 		logFields["status"] = c.Writer.Status()
-		log.WithFields(logFields).Info("request")
+		logging.FromContext(c.Request.Context()).WithFields(logFields).Info("request")
 	}
 }
 
 /*
- * This middleware prints a panic in JSON to the log and redirects
- * the user to an error page with a get parameter containing the error message
+ * This middleware records the request in the Prometheus metrics, by route
+ * template rather than path so the number of series stays bounded
  */
-func RecoveryMiddlware(c *gin.Context, recovered interface{}) {
-	message, ok := recovered.(string)
-	if !ok {
-		h.RedirectWithError(c, errors.New("unknown error"))
+func MetricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		metrics.ObserveHTTPRequest(c.Request.Method, route, c.Writer.Status(), time.Since(start))
+	}
+}
+
+/*
+ * This middleware logs a panic along with its stack trace and responds with a
+ * structured internal error, so API clients always get something they can parse
+ */
+func RecoveryMiddleware(c *gin.Context, recovered interface{}) {
+	logPanic(c, recovered)
+	if c.Writer.Written() {
+		// Too late to tell the client anything, they'll see a truncated response
+		c.Abort()
 		return
 	}
-	h.RedirectWithError(c, errors.New(message))
-	return
+	h.RespondWithError(c, h.ErrInternal)
+}
+
+/*
+ * This middleware logs a panic along with its stack trace and redirects the
+ * user to an error page with a get parameter containing the error code. Only
+ * for routes people reach in their browser, like the auth flows.
+ */
+func BrowserRecoveryMiddleware(c *gin.Context, recovered interface{}) {
+	logPanic(c, recovered)
+	h.RedirectWithError(c, h.ErrInternal)
+}
+
+func logPanic(c *gin.Context, recovered interface{}) {
+	requestID := c.GetString(h.RequestIDKey)
+	if requestID == "" {
+		requestID = h.NewRequestID()
+		c.Set(h.RequestIDKey, requestID)
+	}
+
+	logging.FromContext(c.Request.Context()).WithFields(log.Fields{
+		"panic":      fmt.Sprint(recovered),
+		"stack":      string(debug.Stack()),
+		"method":     c.Request.Method,
+		"path":       c.Request.URL.Path,
+		"request_id": requestID,
+	}).Error("Recovered from panic")
 }
@@ -0,0 +1,157 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+type errorResponse struct {
+	Status int `json:"status"`
+	Error  struct {
+		Code      string `json:"code"`
+		RequestID string `json:"request_id"`
+	} `json:"error"`
+}
+
+func TestRecovery(t *testing.T) {
+	// The panics are expected, so only the hook should see them
+	hook := test.NewLocal(log.StandardLogger())
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	r := newTestServer(t)
+	boom := func(c *gin.Context) { panic("boom") }
+	r.GET("/v1/panic", boom)
+	r.GET("/v1/auth/panic", gin.CustomRecoveryWithWriter(io.Discard, BrowserRecoveryMiddleware), boom)
+
+	t.Run("api", func(t *testing.T) {
+		hook.Reset()
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/v1/panic", nil))
+
+		if w.Code != http.StatusInternalServerError {
+			t.Fatalf("status %d, want %d", w.Code, http.StatusInternalServerError)
+		}
+		var resp errorResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("body isn't JSON: %s", w.Body.String())
+		}
+		requestID := w.Header().Get("X-Request-ID")
+		if resp.Status != http.StatusInternalServerError || resp.Error.Code != "internal_error" {
+			t.Errorf("got status %d code %q, want 500 internal_error", resp.Status, resp.Error.Code)
+		}
+		if requestID == "" || resp.Error.RequestID != requestID {
+			t.Errorf("body request ID %q doesn't match header %q", resp.Error.RequestID, requestID)
+		}
+
+		entry := findEntry(hook, "Recovered from panic")
+		if entry == nil {
+			t.Fatal("panic wasn't logged")
+		}
+		if entry.Data["request_id"] != requestID || entry.Data["panic"] != "boom" {
+			t.Errorf("panic logged with %v", entry.Data)
+		}
+	})
+
+	t.Run("browser", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "http://api.example.com/v1/auth/panic", nil))
+
+		if w.Code != http.StatusTemporaryRedirect {
+			t.Fatalf("status %d, want %d", w.Code, http.StatusTemporaryRedirect)
+		}
+		location, err := url.Parse(w.Header().Get("Location"))
+		if err != nil {
+			t.Fatalf("bad redirect %q: %v", w.Header().Get("Location"), err)
+		}
+		if location.Query().Get("error") != "internal_error" {
+			t.Errorf("redirected to %s, want an internal_error", location)
+		}
+		if location.Query().Get("request_id") != w.Header().Get("X-Request-ID") {
+			t.Errorf("redirect request ID %q doesn't match header %q", location.Query().Get("request_id"), w.Header().Get("X-Request-ID"))
+		}
+	})
+}
+
+// Returns the most recent log entry with the message, or nil if there isn't one
+func findEntry(hook *test.Hook, message string) *log.Entry {
+	entries := hook.AllEntries()
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].Message == message {
+			return entries[i]
+		}
+	}
+	return nil
+}
+
+func TestRequestID(t *testing.T) {
+	r := newTestServer(t)
+
+	tests := []struct {
+		name     string
+		incoming string
+		// Empty when a new ID should be generated instead
+		want string
+	}{
+		{name: "missing"},
+		{name: "valid", incoming: "abc-123.def:456_789", want: "abc-123.def:456_789"},
+		{name: "uuid", incoming: "0f8fad5b-d9cb-469f-a165-70867728950e", want: "0f8fad5b-d9cb-469f-a165-70867728950e"},
+		{name: "spaces", incoming: "not a request id"},
+		{name: "log injection", incoming: "abc\" level=error msg=\"forged"},
+		{name: "too long", incoming: strings.Repeat("a", 129)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Unknown events respond with an error, which should carry the ID too
+			req := httptest.NewRequest("GET", "/v1/events/999", nil)
+			if tt.incoming != "" {
+				req.Header.Set("X-Request-ID", tt.incoming)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != http.StatusNotFound {
+				t.Fatalf("status %d, want %d", w.Code, http.StatusNotFound)
+			}
+
+			requestID := w.Header().Get("X-Request-ID")
+			if tt.want != "" && requestID != tt.want {
+				t.Errorf("responded with request ID %q, want %q", requestID, tt.want)
+			}
+			if tt.want == "" && (requestID == "" || requestID == tt.incoming) {
+				t.Errorf("responded with request ID %q, want a new one", requestID)
+			}
+
+			var resp errorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("body isn't JSON: %s", w.Body.String())
+			}
+			if resp.Error.RequestID != requestID {
+				t.Errorf("body request ID %q doesn't match header %q", resp.Error.RequestID, requestID)
+			}
+		})
+	}
+
+	t.Run("unique", func(t *testing.T) {
+		seen := map[string]bool{}
+		for i := 0; i < 10; i++ {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil))
+			requestID := w.Header().Get("X-Request-ID")
+			if seen[requestID] {
+				t.Fatalf("request ID %q generated twice", requestID)
+			}
+			seen[requestID] = true
+		}
+	})
+}
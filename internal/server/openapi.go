@@ -0,0 +1,521 @@
+package server
+
+import (
+	_ "embed"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	h "github.com/nuigcompsoc/api/internal/helpers"
+	"github.com/nuigcompsoc/api/internal/models"
+	swaggerFiles "github.com/swaggo/files"
+)
+
+//go:embed docs/index.html
+var docsIndex []byte
+
+// apiOperation documents a single route in the OpenAPI specification
+type apiOperation struct {
+	Method  string
+	Path    string
+	Tag     string
+	Summary string
+	// Names of query parameters, see openAPIParameters
+	Query []string
+	// A value of the type expected as the JSON request body, if any
+	RequestBody interface{}
+	// Whether an admin token is required
+	Admin     bool
+	Responses gin.H
+}
+
+// apiOperations documents every route registered in v1Router. TestOpenAPISpec
+// fails if a route is added without being documented here.
+var apiOperations = []apiOperation{
+	{Method: "GET", Path: "/v1/", Tag: "misc", Summary: "Asks which version of the API you want", Responses: stringResponse()},
+	{Method: "GET", Path: "/v1/ping", Tag: "misc", Summary: "Checks the API is up", Responses: stringResponse()},
+	{Method: "GET", Path: "/v1/brew", Tag: "misc", Summary: "Attempts to brew coffee", Responses: errorResponses(http.StatusTeapot)},
+	{Method: "GET", Path: "/v1/openapi.json", Tag: "misc", Summary: "This document", Responses: contentResponse("application/json", "OpenAPI 3 specification")},
+
+	{Method: "GET", Path: "/healthz", Tag: "health", Summary: "Checks the process is up", Responses: stringResponse()},
+	{Method: "GET", Path: "/readyz", Tag: "health", Summary: "Checks the API's dependencies, responding 503 if a critical one is down", Responses: readinessResponse()},
+
+	{Method: "POST", Path: "/v1/auth/register", Tag: "auth", Summary: "Starts registering a CompSoc account for a society member", Responses: notImplementedResponse()},
+	{Method: "GET", Path: "/v1/auth/register/verify", Tag: "auth", Summary: "Finishes registering a CompSoc account from the emailed link", Responses: notImplementedResponse()},
+	{Method: "GET", Path: "/v1/auth/openid", Tag: "auth", Summary: "Redirects to CompSoc SSO", Responses: notImplementedResponse()},
+	{Method: "GET", Path: "/v1/auth/openid/callback", Tag: "auth", Summary: "Completes signing in with CompSoc SSO", Responses: notImplementedResponse()},
+	{Method: "GET", Path: "/v1/auth/google", Tag: "auth", Summary: "Redirects to Google SSO for society accounts", Responses: notImplementedResponse()},
+	{Method: "GET", Path: "/v1/auth/google/callback", Tag: "auth", Summary: "Completes signing in a society with Google SSO", Responses: notImplementedResponse()},
+
+	{Method: "GET", Path: "/v1/events", Tag: "events", Summary: "Lists all events", Query: eventFilterQuery, Responses: eventListResponse()},
+	{Method: "GET", Path: "/v1/events.ics", Tag: "events", Summary: "Subscribable calendar of all events", Responses: calendarResponse()},
+	{Method: "GET", Path: "/v1/events/upcoming", Tag: "events", Summary: "Lists upcoming events, including those which ended in the last hour", Query: eventFilterQuery, Responses: eventListResponse()},
+	{Method: "GET", Path: "/v1/events/upcoming/:id", Tag: "events", Summary: "Lists upcoming events of a society", Query: eventFilterQuery, Responses: eventListResponse()},
+	{Method: "GET", Path: "/v1/events/upcoming.rss", Tag: "feeds", Summary: "RSS feed of upcoming events", Responses: feedResponse("application/rss+xml")},
+	{Method: "GET", Path: "/v1/events/upcoming.atom", Tag: "feeds", Summary: "Atom feed of upcoming events", Responses: feedResponse("application/atom+xml")},
+	{Method: "GET", Path: "/v1/events/upcoming.json", Tag: "feeds", Summary: "JSON Feed of upcoming events", Responses: feedResponse("application/feed+json")},
+	{Method: "GET", Path: "/v1/events/past", Tag: "events", Summary: "Lists past events, most recent first", Query: eventFilterQuery, Responses: eventListResponse()},
+	{Method: "GET", Path: "/v1/events/past/:id", Tag: "events", Summary: "Lists past events of a society, most recent first", Query: eventFilterQuery, Responses: eventListResponse()},
+	{Method: "GET", Path: "/v1/events/search", Tag: "events", Summary: "Searches events, most relevant first", Query: append([]string{"q"}, eventFilterQuery...), Responses: pageResponse(models.EventSearchResult{})},
+	{Method: "GET", Path: "/v1/events/:eventDetailsID", Tag: "events", Summary: "Gets an event, or the next instance of a recurring event", Query: []string{"format"}, Responses: dataResponse(models.DatabaseEvent{}, http.StatusNotFound)},
+	{Method: "GET", Path: "/v1/events/:eventDetailsID/:eventID", Tag: "events", Summary: "Gets a single instance of a recurring event", Query: []string{"format"}, Responses: dataResponse(models.DatabaseEvent{}, http.StatusNotFound)},
+
+	{Method: "GET", Path: "/v1/societies", Tag: "societies", Summary: "Lists the societies whose events we track, with their details", Query: []string{"format"}, Responses: dataResponse([]models.Society{})},
+	{Method: "POST", Path: "/v1/societies", Tag: "societies", Summary: "Starts tracking a society", Admin: true, RequestBody: models.Society{}, Responses: createdResponse(models.Society{}, http.StatusConflict)},
+	{Method: "GET", Path: "/v1/societies/:id", Tag: "societies", Summary: "Gets a society by its societies portal ID", Query: []string{"format"}, Responses: dataResponse(models.Society{}, http.StatusNotFound)},
+	{Method: "PUT", Path: "/v1/societies/:id", Tag: "societies", Summary: "Replaces a society", Admin: true, RequestBody: models.Society{}, Responses: dataResponse(models.Society{}, http.StatusNotFound, http.StatusConflict)},
+	{Method: "DELETE", Path: "/v1/societies/:id", Tag: "societies", Summary: "Stops tracking a society", Admin: true, Responses: noContentResponse(http.StatusNotFound)},
+	{Method: "GET", Path: "/v1/societies/:id/audit", Tag: "societies", Summary: "Lists the changes made to a society and who made them, newest first", Admin: true, Query: []string{"format"}, Responses: dataResponse([]models.SocietyAuditEntry{}, http.StatusNotFound)},
+	{Method: "GET", Path: "/v1/societies/:id/stats", Tag: "stats", Summary: "Sums up how active a society is from its events, leaving out cancelled ones", Query: statsFilterQuery, Responses: dataResponse(models.SocietyStats{}, http.StatusNotFound)},
+	{Method: "GET", Path: "/v1/societies/leaderboard", Tag: "stats", Summary: "Ranks societies by how many events they ran, leaving out cancelled ones", Query: append([]string{"rank_limit", "society_id"}, statsFilterQuery...), Responses: dataResponse([]models.SocietyRanking{})},
+	{Method: "GET", Path: "/v1/society-proposals", Tag: "societies", Summary: "Lists societies found on the societies portal that we don't track", Admin: true, Query: []string{"status", "format"}, Responses: dataResponse([]models.SocietyProposal{})},
+	{Method: "POST", Path: "/v1/society-proposals", Tag: "societies", Summary: "Looks for societies on the societies portal now, listing those awaiting a decision", Admin: true, Responses: dataResponse([]models.SocietyProposal{})},
+	{Method: "POST", Path: "/v1/society-proposals/:id/approve", Tag: "societies", Summary: "Starts tracking a proposed society", Admin: true, Responses: approvedResponse()},
+	{Method: "POST", Path: "/v1/society-proposals/:id/reject", Tag: "societies", Summary: "Declines to track a proposed society", Admin: true, Responses: dataResponse(models.SocietyProposal{}, http.StatusNotFound)},
+	{Method: "GET", Path: "/v1/admin/jobs", Tag: "admin", Summary: "Lists the scheduler's jobs, whether they're running and their recent runs", Admin: true, Query: []string{"format"}, Responses: dataResponse([]models.JobStatus{})},
+	{Method: "POST", Path: "/v1/admin/jobs/:name/run", Tag: "admin", Summary: "Runs a job in the background now, unless it's already running", Admin: true, Responses: acceptedResponse(models.JobStatus{}, http.StatusNotFound, http.StatusConflict)},
+	{Method: "GET", Path: "/v1/societies/:id/events.ics", Tag: "societies", Summary: "Subscribable calendar of a society's events", Responses: calendarResponse()},
+	{Method: "GET", Path: "/v1/societies/:id/events/upcoming.rss", Tag: "feeds", Summary: "RSS feed of a society's upcoming events", Responses: feedResponse("application/rss+xml")},
+	{Method: "GET", Path: "/v1/societies/:id/events/upcoming.atom", Tag: "feeds", Summary: "Atom feed of a society's upcoming events", Responses: feedResponse("application/atom+xml")},
+	{Method: "GET", Path: "/v1/societies/:id/events/upcoming.json", Tag: "feeds", Summary: "JSON Feed of a society's upcoming events", Responses: feedResponse("application/feed+json")},
+}
+
+var eventFilterQuery = []string{"from", "to", "society_id", "location_type", "event_type", "sort", "limit", "cursor", "format"}
+
+var statsFilterQuery = []string{"from", "to", "location_type", "event_type", "format"}
+
+// openAPIParameters describes every query parameter operations can take
+var openAPIParameters = gin.H{
+	"from":          queryParameter("from", "Only events ending after this RFC 3339 datetime or date", gin.H{"type": "string"}),
+	"to":            queryParameter("to", "Only events starting before this RFC 3339 datetime or date", gin.H{"type": "string"}),
+	"society_id":    listQueryParameter("society_id", "Only events of these societies", gin.H{"type": "integer"}),
+	"location_type": listQueryParameter("location_type", "Only events with these location types, e.g. On Campus", gin.H{"type": "string"}),
+	"event_type":    listQueryParameter("event_type", "Only events of these types, e.g. Other", gin.H{"type": "string"}),
+	"sort":          queryParameter("sort", "Order by start datetime", gin.H{"type": "string", "enum": []string{"asc", "desc"}}),
+	"limit":         queryParameter("limit", "Page size, event lists aren't paged unless limit or cursor is given", gin.H{"type": "integer", "minimum": 1, "maximum": maxEventsLimit, "default": defaultEventsLimit}),
+	"rank_limit":    queryParameter("limit", "How many societies to rank, all of them by default", gin.H{"type": "integer", "minimum": 1, "maximum": maxLeaderboardLimit}),
+	"cursor":        queryParameter("cursor", "next_cursor of the previous page", gin.H{"type": "string"}),
+	"q":             requiredQueryParameter("q", "Search terms, quote phrases and prefix terms with - to exclude them", gin.H{"type": "string"}),
+	"status":        queryParameter("status", "Only proposals with this status", gin.H{"type": "string", "enum": []string{models.ProposalPending, models.ProposalApproved, models.ProposalRejected, "all"}, "default": models.ProposalPending}),
+	"format":        queryParameter("format", "Response format, overrides the Accept header", gin.H{"type": "string", "enum": h.Formats}),
+}
+
+// The OpenAPI document served at /v1/openapi.json
+var openAPISpec = buildOpenAPISpec()
+
+func buildOpenAPISpec() gin.H {
+	schemas := gin.H{
+		"Error": gin.H{
+			"type":     "object",
+			"required": []string{"status", "error"},
+			"properties": gin.H{
+				"status": gin.H{"type": "integer"},
+				"error": gin.H{
+					"type":     "object",
+					"required": []string{"code", "message"},
+					"properties": gin.H{
+						"code":       gin.H{"type": "string", "description": "Stable, machine readable error code"},
+						"message":    gin.H{"type": "string"},
+						"details":    gin.H{"description": "Extra information about the error, depending on its code"},
+						"request_id": gin.H{"type": "string"},
+					},
+				},
+			},
+		},
+	}
+	builder := schemaBuilder{schemas: schemas}
+
+	paths := gin.H{}
+	for _, op := range apiOperations {
+		path := openAPIPath(op.Path)
+		item, ok := paths[path].(gin.H)
+		if !ok {
+			item = gin.H{}
+			paths[path] = item
+		}
+
+		parameters := []gin.H{}
+		for _, name := range pathParameterPattern.FindAllStringSubmatch(op.Path, -1) {
+			schema := gin.H{"type": "integer"}
+			// Jobs are the only thing identified by name rather than ID
+			if name[1] == "name" {
+				schema = gin.H{"type": "string"}
+			}
+			parameters = append(parameters, gin.H{
+				"name":     name[1],
+				"in":       "path",
+				"required": true,
+				"schema":   schema,
+			})
+		}
+		for _, name := range op.Query {
+			parameters = append(parameters, gin.H{"$ref": "#/components/parameters/" + name})
+		}
+
+		responses := gin.H{}
+		for code, response := range op.Responses {
+			responses[code] = builder.resolve(response)
+		}
+
+		operation := gin.H{
+			"tags":        []string{op.Tag},
+			"summary":     op.Summary,
+			"operationId": strings.ToLower(op.Method) + operationName(op.Path),
+			"parameters":  parameters,
+			"responses":   responses,
+		}
+		if op.RequestBody != nil {
+			operation["requestBody"] = gin.H{
+				"required": true,
+				"content":  gin.H{"application/json": gin.H{"schema": builder.resolve(schemaOf{op.RequestBody})}},
+			}
+		}
+		if op.Admin {
+			operation["security"] = []gin.H{{"admin": []string{}}}
+			responses["401"] = builder.resolve(errorResponses(http.StatusUnauthorized)["401"])
+		}
+		item[strings.ToLower(op.Method)] = operation
+	}
+
+	return gin.H{
+		"openapi": "3.0.3",
+		"info": gin.H{
+			"title":       "CompSoc API",
+			"description": "REST API for the Computer Society and societies of the University of Galway",
+			"license":     gin.H{"name": "MIT", "url": "https://github.com/ugcompsoc/api/blob/main/LICENSE"},
+			"version":     "1",
+		},
+		"servers": []gin.H{{"url": "/"}},
+		"tags": []gin.H{
+			{"name": "events", "description": "Events synced from the societies portal"},
+			{"name": "feeds", "description": "Syndication feeds of events"},
+			{"name": "societies", "description": "Societies whose events we track"},
+			{"name": "stats", "description": "How active societies are"},
+			{"name": "auth", "description": "Signing in and registering, visited in a browser. Not built yet, so every route responds 501."},
+			{"name": "admin", "description": "Running the API"},
+			{"name": "misc"},
+		},
+		"paths": paths,
+		"components": gin.H{
+			"schemas":    schemas,
+			"parameters": openAPIParameters,
+			"securitySchemes": gin.H{
+				"admin": gin.H{"type": "http", "scheme": "bearer", "description": "One of the tokens in admin.tokens"},
+			},
+		},
+	}
+}
+
+var pathParameterPattern = regexp.MustCompile(`[:*]([A-Za-z0-9_]+)`)
+
+// Converts a gin path into an OpenAPI one, /events/:id -> /events/{id}
+func openAPIPath(path string) string {
+	return pathParameterPattern.ReplaceAllString(path, "{$1}")
+}
+
+// Makes an operationId out of a path, /v1/events/:id -> V1EventsId
+func operationName(path string) string {
+	name := ""
+	for _, part := range regexp.MustCompile(`[^A-Za-z0-9]+`).Split(path, -1) {
+		if part != "" {
+			name += strings.ToUpper(part[:1]) + part[1:]
+		}
+	}
+	return name
+}
+
+func queryParameter(name string, description string, schema gin.H) gin.H {
+	return gin.H{"name": name, "in": "query", "description": description, "schema": schema}
+}
+
+func requiredQueryParameter(name string, description string, schema gin.H) gin.H {
+	parameter := queryParameter(name, description, schema)
+	parameter["required"] = true
+	return parameter
+}
+
+func listQueryParameter(name string, description string, items gin.H) gin.H {
+	parameter := queryParameter(name, description+", comma separated or repeated", gin.H{"type": "array", "items": items})
+	parameter["explode"] = true
+	return parameter
+}
+
+/*
+ * Responses
+ *
+ * Response schemas can refer to Go types with a schemaOf, which are turned
+ * into JSON schemas once every operation is known.
+ */
+
+type schemaOf struct {
+	value interface{}
+}
+
+// The media types JSON responses can be negotiated into
+func negotiatedContent(schema interface{}) gin.H {
+	content := gin.H{}
+	for _, format := range h.Formats {
+		content[strings.Split(format.MediaType(), ";")[0]] = gin.H{"schema": schema}
+	}
+	return content
+}
+
+func envelope(data interface{}, extra gin.H) gin.H {
+	properties := gin.H{
+		"status": gin.H{"type": "integer"},
+		"data":   data,
+	}
+	for key, value := range extra {
+		properties[key] = value
+	}
+	return gin.H{"type": "object", "properties": properties}
+}
+
+func errorResponses(codes ...int) gin.H {
+	responses := gin.H{}
+	for _, code := range append(codes, http.StatusNotAcceptable, http.StatusInternalServerError) {
+		responses[strconv.Itoa(code)] = gin.H{
+			"description": http.StatusText(code),
+			"content":     negotiatedContent(gin.H{"$ref": "#/components/schemas/Error"}),
+		}
+	}
+	return responses
+}
+
+func stringResponse() gin.H {
+	responses := errorResponses()
+	responses["200"] = gin.H{
+		"description": "OK",
+		"content":     negotiatedContent(envelope(gin.H{"type": "string"}, nil)),
+	}
+	return responses
+}
+
+func dataResponse(value interface{}, errorCodes ...int) gin.H {
+	responses := errorResponses(append([]int{http.StatusBadRequest}, errorCodes...)...)
+	responses["200"] = gin.H{
+		"description": "OK",
+		"content":     negotiatedContent(envelope(schemaOf{value}, nil)),
+	}
+	return responses
+}
+
+func createdResponse(value interface{}, errorCodes ...int) gin.H {
+	responses := errorResponses(append([]int{http.StatusBadRequest}, errorCodes...)...)
+	responses["201"] = gin.H{
+		"description": "Created",
+		"content":     negotiatedContent(envelope(schemaOf{value}, nil)),
+	}
+	return responses
+}
+
+// Approving a proposal again only marks it approved, the society is already
+// tracked
+func approvedResponse() gin.H {
+	responses := createdResponse(models.Society{}, http.StatusNotFound, http.StatusConflict)
+	responses["200"] = gin.H{
+		"description": "Already tracked",
+		"content":     negotiatedContent(envelope(schemaOf{models.Society{}}, nil)),
+	}
+	return responses
+}
+
+func acceptedResponse(value interface{}, errorCodes ...int) gin.H {
+	responses := errorResponses(append([]int{http.StatusBadRequest}, errorCodes...)...)
+	responses["202"] = gin.H{
+		"description": "Accepted",
+		"content":     negotiatedContent(envelope(schemaOf{value}, nil)),
+	}
+	return responses
+}
+
+func noContentResponse(errorCodes ...int) gin.H {
+	responses := errorResponses(append([]int{http.StatusBadRequest}, errorCodes...)...)
+	responses["204"] = gin.H{"description": "No Content"}
+	return responses
+}
+
+func pageResponse(value interface{}) gin.H {
+	responses := errorResponses(http.StatusBadRequest)
+	responses["200"] = gin.H{
+		"description": "A page of results, pass next_cursor as cursor to get the next one",
+		"headers": gin.H{
+			"X-Total-Count": gin.H{"schema": gin.H{"type": "integer"}},
+			"X-Next-Cursor": gin.H{"schema": gin.H{"type": "string"}},
+		},
+		"content": negotiatedContent(envelope(
+			gin.H{"type": "array", "items": schemaOf{value}},
+			gin.H{
+				"next_cursor": gin.H{"type": "string", "description": "Empty on the last page"},
+				"total":       gin.H{"type": "integer", "description": "Results across all pages"},
+			},
+		)),
+	}
+	return responses
+}
+
+// Event lists return every event unless they're asked for a page
+func eventListResponse() gin.H {
+	responses := pageResponse(models.DatabaseEvent{})
+	responses["200"].(gin.H)["description"] = "Every matching event, without next_cursor and total, unless limit or cursor is given for a page of them"
+	return responses
+}
+
+func readinessResponse() gin.H {
+	responses := errorResponses()
+	content := negotiatedContent(envelope(schemaOf{Readiness{}}, nil))
+	responses["200"] = gin.H{"description": "Ready, possibly with non critical dependencies down", "content": content}
+	responses["503"] = gin.H{"description": "A critical dependency is down", "content": content}
+	return responses
+}
+
+func contentResponse(mediaType string, description string) gin.H {
+	responses := errorResponses()
+	responses["200"] = gin.H{
+		"description": description,
+		"content":     gin.H{mediaType: gin.H{"schema": gin.H{"type": "string"}}},
+	}
+	return responses
+}
+
+func feedResponse(mediaType string) gin.H {
+	responses := contentResponse(mediaType, "Feed of events, supports If-None-Match")
+	responses["304"] = gin.H{"description": "Not Modified"}
+	return responses
+}
+
+func calendarResponse() gin.H {
+	responses := contentResponse("text/calendar", "RFC 5545 calendar of events, supports If-None-Match")
+	responses["304"] = gin.H{"description": "Not Modified"}
+	return responses
+}
+
+// Auth routes are placeholders until signing in and registering are built
+func notImplementedResponse() gin.H {
+	return errorResponses(http.StatusNotImplemented)
+}
+
+/*
+ * Schemas
+ */
+
+// schemaBuilder derives JSON schemas from Go types, following the same rules
+// as encoding/json so the schemas match what clients actually receive
+type schemaBuilder struct {
+	schemas gin.H
+}
+
+// Replaces every schemaOf within v with a schema
+func (b schemaBuilder) resolve(v interface{}) interface{} {
+	switch value := v.(type) {
+	case schemaOf:
+		return b.schema(reflect.TypeOf(value.value))
+	case gin.H:
+		resolved := gin.H{}
+		for key, child := range value {
+			resolved[key] = b.resolve(child)
+		}
+		return resolved
+	default:
+		return v
+	}
+}
+
+func (b schemaBuilder) schema(t reflect.Type) gin.H {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t == reflect.TypeOf(time.Time{}) {
+		return gin.H{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return gin.H{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return gin.H{"type": "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return gin.H{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return gin.H{"type": "number"}
+	case reflect.String:
+		return gin.H{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return gin.H{"type": "string", "format": "byte"}
+		}
+		return gin.H{"type": "array", "items": b.schema(t.Elem())}
+	case reflect.Map:
+		return gin.H{"type": "object", "additionalProperties": b.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.structSchema(t)
+		}
+		if _, ok := b.schemas[t.Name()]; !ok {
+			// Register first so recursive types refer to themselves
+			b.schemas[t.Name()] = gin.H{}
+			b.schemas[t.Name()] = b.structSchema(t)
+		}
+		return gin.H{"$ref": "#/components/schemas/" + t.Name()}
+	default:
+		return gin.H{}
+	}
+}
+
+func (b schemaBuilder) structSchema(t reflect.Type) gin.H {
+	properties := gin.H{}
+	b.addProperties(t, properties)
+	return gin.H{"type": "object", "properties": properties}
+}
+
+func (b schemaBuilder) addProperties(t reflect.Type, properties gin.H) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name := strings.Split(tag, ",")[0]
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			// Embedded structs have their fields promoted
+			b.addProperties(field.Type, properties)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		properties[name] = b.schema(field.Type)
+	}
+}
+
+/*
+ * Swagger UI
+ */
+
+func (s *Server) MiscV1OpenAPIGet(c *gin.Context) {
+	c.JSON(http.StatusOK, openAPISpec)
+}
+
+// Serves Swagger UI for the OpenAPI document
+func DocsGet(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", docsIndex)
+}
+
+// Serves Swagger UI's scripts and stylesheets, which are embedded in the binary
+func DocsAssetGet(c *gin.Context) {
+	if c.Param("filepath") == "/" || c.Param("filepath") == "/index.html" {
+		DocsGet(c)
+		return
+	}
+	c.FileFromFS(c.Param("filepath"), swaggerFiles.HTTP)
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Routes which aren't part of the API itself
+var undocumentedRoutes = map[string]bool{
+	"/docs":           true,
+	"/docs/*filepath": true,
+	"/metrics":        true,
+}
+
+func TestOpenAPISpecDocumentsEveryRoute(t *testing.T) {
+	s := &Server{}
+	r := SetupRouter()
+	s.routes(r)
+
+	paths := openAPISpec["paths"].(gin.H)
+	for _, route := range r.Routes() {
+		if undocumentedRoutes[route.Path] {
+			continue
+		}
+
+		item, ok := paths[openAPIPath(route.Path)].(gin.H)
+		if !ok || item[strings.ToLower(route.Method)] == nil {
+			t.Errorf("%v %v is registered but missing from the OpenAPI spec", route.Method, route.Path)
+		}
+	}
+}
+
+func TestOpenAPISpecOnlyDocumentsRegisteredRoutes(t *testing.T) {
+	s := &Server{}
+	r := SetupRouter()
+	s.routes(r)
+
+	registered := map[string]bool{}
+	for _, route := range r.Routes() {
+		registered[route.Method+" "+route.Path] = true
+	}
+
+	for _, op := range apiOperations {
+		if !registered[op.Method+" "+op.Path] {
+			t.Errorf("%v %v is in the OpenAPI spec but no route is registered for it", op.Method, op.Path)
+		}
+	}
+}
+
+func TestOpenAPISpecServed(t *testing.T) {
+	s := &Server{}
+	r := SetupRouter()
+	s.routes(r)
+
+	for _, path := range []string{"/v1/openapi.json", "/docs", "/docs/swagger-ui-bundle.js"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("GET %v responded %v", path, w.Code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/openapi.json", nil))
+	var spec map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &spec); err != nil {
+		t.Fatalf("OpenAPI spec is not valid JSON: %v", err)
+	}
+
+	schemas := spec["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+	event, ok := schemas["DatabaseEvent"].(map[string]interface{})
+	if !ok {
+		t.Fatal("DatabaseEvent schema is missing")
+	}
+	properties := event["properties"].(map[string]interface{})
+	if _, ok := properties["ContentHash"]; ok {
+		t.Error("DatabaseEvent schema documents ContentHash, which is never sent to clients")
+	}
+	if start := properties["StartDatetime"].(map[string]interface{}); start["format"] != "date-time" {
+		t.Errorf("StartDatetime should be a date-time, got %v", start)
+	}
+}
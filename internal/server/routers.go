@@ -1,7 +1,13 @@
 package server
 
 import (
+	"io"
+
 	"github.com/gin-gonic/gin"
+	h "github.com/nuigcompsoc/api/internal/helpers"
+	"github.com/nuigcompsoc/api/internal/metrics"
+	"github.com/nuigcompsoc/api/internal/tracing"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
 // Returns the routes associated with /v1
@@ -11,14 +17,81 @@ func (s *Server) v1Router(r *gin.RouterGroup) {
 	r.GET("/", s.RootGet)
 	r.GET("ping", s.MiscV1PingGet)
 	r.GET("brew", s.MiscV1BrewGet)
+	r.GET("openapi.json", s.MiscV1OpenAPIGet)
 	r.GET("events", s.EventsV1Get)
+	r.GET("events.ics", s.EventsV1ICalGet)
 
 	// EVENTS route
 	e := r.Group("/events")
 	e.GET("upcoming", s.EventsV1UpcomingGet)
 	e.GET("upcoming/:id", s.EventsV1UpcomingSocIDGet)
+	e.GET("upcoming.rss", s.EventsV1UpcomingRSSGet)
+	e.GET("upcoming.atom", s.EventsV1UpcomingAtomGet)
+	e.GET("upcoming.json", s.EventsV1UpcomingJSONFeedGet)
 	e.GET("past", s.EventsV1PastGet)
 	e.GET("past/:id", s.EventsV1PastSocIDGet)
+	e.GET("search", s.EventsV1SearchGet)
+	e.GET(":eventDetailsID", s.EventsV1EventDetailsIDGet)
+	e.GET(":eventDetailsID/:eventID", s.EventsV1EventDetailsIDEventIDGet)
+
+	// AUTH route, not built yet so every route responds 501. These are
+	// visited in a browser so panics redirect back to the site.
+	a := r.Group("/auth")
+	a.Use(gin.CustomRecoveryWithWriter(io.Discard, BrowserRecoveryMiddleware))
+	a.POST("register", s.AuthV1RegisterPost)
+	a.GET("register/verify", s.AuthV1RegisterVerifyGet)
+	a.GET("openid", s.AuthV1OpenIDGet)
+	a.GET("openid/callback", s.AuthV1OpenIDCallbackGet)
+	a.GET("google", s.AuthV1GoogleGet)
+	a.GET("google/callback", s.AuthV1GoogleCallbackGet)
+
+	// SOCIETIES route
+	so := r.Group("/societies")
+	so.GET("", s.SocietiesV1Get)
+	so.POST("", s.AdminMiddleware(), s.SocietiesV1Post)
+	so.GET("leaderboard", s.SocietiesV1LeaderboardGet)
+	so.GET(":id", s.SocietiesV1SocIDGet)
+	so.PUT(":id", s.AdminMiddleware(), s.SocietiesV1SocIDPut)
+	so.DELETE(":id", s.AdminMiddleware(), s.SocietiesV1SocIDDelete)
+	so.GET(":id/audit", s.AdminMiddleware(), s.SocietiesV1SocIDAuditGet)
+	so.GET(":id/stats", s.SocietiesV1SocIDStatsGet)
+	so.GET(":id/events.ics", s.SocietiesV1SocIDICalGet)
+	so.GET(":id/events/upcoming.rss", s.SocietiesV1SocIDUpcomingRSSGet)
+	so.GET(":id/events/upcoming.atom", s.SocietiesV1SocIDUpcomingAtomGet)
+	so.GET(":id/events/upcoming.json", s.SocietiesV1SocIDUpcomingJSONFeedGet)
+
+	// SOCIETY PROPOSALS route, societies found on the portal we don't track yet
+	sp := r.Group("/society-proposals")
+	sp.Use(s.AdminMiddleware())
+	sp.GET("", s.SocietyProposalsV1Get)
+	sp.POST("", s.SocietyProposalsV1Post)
+	sp.POST(":id/approve", s.SocietyProposalsV1SocIDApprovePost)
+	sp.POST(":id/reject", s.SocietyProposalsV1SocIDRejectPost)
+
+	// ADMIN route
+	ad := r.Group("/admin")
+	ad.Use(s.AdminMiddleware())
+	ad.GET("jobs", s.AdminV1JobsGet)
+	ad.POST("jobs/:name/run", s.AdminV1JobsNameRunPost)
+}
+
+// Returns the routes serving the API's documentation
+func docsRouter(r *gin.Engine) {
+	r.GET("/docs", DocsGet)
+	r.GET("/docs/*filepath", DocsAssetGet)
+}
+
+// Registers every route the server handles
+func (s *Server) routes(r *gin.Engine) {
+	v1 := r.Group("v1")
+	s.v1Router(v1)
+	docsRouter(r)
+	s.healthRouter(r)
+
+	// Unless metrics have a listener of their own
+	if s.Metrics == nil {
+		r.GET("/metrics", gin.WrapH(metrics.Handler()))
+	}
 }
 
 // SetupRouter function will perform all route operations
@@ -27,11 +100,24 @@ func SetupRouter() *gin.Engine {
 	// We are now relying on our own logging middleware to log all paths accessed to stdout
 	gin.SetMode(gin.ReleaseMode)
 	r := gin.New()
-	r.Use(gin.CustomRecovery(RecoveryMiddlware))
+	r.HandleMethodNotAllowed = true
+	r.NoRoute(func(c *gin.Context) {
+		h.RespondWithError(c, h.ErrRouteNotFound)
+	})
+	r.NoMethod(func(c *gin.Context) {
+		h.RespondWithError(c, h.ErrMethodNotAllowed)
+	})
+	// Starts the request's span, taking over the trace of the caller if any
+	r.Use(otelgin.Middleware(tracing.ServiceName))
+	// Early so that everything after, including recovery, has a request ID
+	r.Use(RequestIDMiddleware())
+	// Outside of recovery so requests that panicked are counted as 500s
+	r.Use(MetricsMiddleware())
+	// Our recovery middlewares do their own logging
+	r.Use(gin.CustomRecoveryWithWriter(io.Discard, RecoveryMiddleware))
 
 	r.Use(func(c *gin.Context) {
 		// add header Access-Control-Allow-Origin
-		c.Writer.Header().Set("Content-Type", "application/json")
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, GET, PUT, DELETE, UPDATE")
 		c.Writer.Header().Set("Access-Control-Allow-Headers", "*")
@@ -7,16 +7,23 @@ import (
 	"net/http"
 
 	"github.com/rs/cors"
+	log "github.com/sirupsen/logrus"
 
 	"github.com/nuigcompsoc/api/internal/config"
+	h "github.com/nuigcompsoc/api/internal/helpers"
+	"github.com/nuigcompsoc/api/internal/metrics"
 	"github.com/nuigcompsoc/api/internal/services"
+	"github.com/nuigcompsoc/api/internal/tracing"
 )
 
 type Server struct {
 	Config    config.Config
 	HTTP      *http.Server
+	Metrics   *http.Server
 	Scheduler *services.SchedulerService
-	Datastore *services.MongoDatastore
+	Datastore services.Datastore
+
+	shutdownTracing func(context.Context) error
 }
 
 // NewServer returns an initialized Server
@@ -32,6 +39,7 @@ func NewServer(config config.Config) *Server {
 			http.MethodDelete,
 		},
 		AllowedHeaders:   []string{"*"},
+		ExposedHeaders:   []string{h.RequestIDHeader, "X-Total-Count", "X-Next-Cursor"},
 		AllowCredentials: true,
 	})
 
@@ -46,20 +54,48 @@ func NewServer(config config.Config) *Server {
 		HTTP:   httpSrv,
 	}
 
-	s.Datastore = services.NewDatastore(&s.Config)
+	if config.Metrics.ListenAddress != "" {
+		s.Metrics = &http.Server{
+			Addr:    config.Metrics.ListenAddress,
+			Handler: metrics.Handler(),
+		}
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), &s.Config)
+	if err != nil {
+		log.WithError(err).Warn("Failed to set up tracing")
+	}
+	s.shutdownTracing = shutdownTracing
+
+	datastore, err := services.OpenDatastore(context.Background(), &s.Config)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to create Datastore")
+	}
+	if s.Config.Database.MigrateOnStartup {
+		if err := datastore.Migrate(context.Background()); err != nil {
+			log.WithError(err).Fatal("Failed to migrate Datastore")
+		}
+	}
+	s.Datastore = datastore
 
-	s.Scheduler = services.NewSchedulerService(&s.Config)
+	s.Scheduler = services.NewSchedulerService(&s.Config, s.Datastore)
 	s.Scheduler.RunAllServices()
 
-	// v1 route
-	v1 := r.Group("v1")
-	s.v1Router(v1)
+	s.routes(r)
 
 	return s
 }
 
 // Start begins listening
 func (s *Server) Start(ctx context.Context) error {
+	if s.Metrics != nil {
+		go func() {
+			if err := s.Metrics.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				log.WithError(err).Error("Failed to start metrics server")
+			}
+		}()
+	}
+
 	var err error
 	if err = s.HTTP.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
 		return fmt.Errorf("failed to start HTTP server: %w", err)
@@ -73,6 +109,26 @@ func (s *Server) Stop(ctx context.Context) error {
 	if err := s.HTTP.Shutdown(ctx); err != nil {
 		return fmt.Errorf("failed to stop HTTP server: %w", err)
 	}
+	if s.Metrics != nil {
+		if err := s.Metrics.Shutdown(ctx); err != nil {
+			return fmt.Errorf("failed to stop metrics server: %w", err)
+		}
+	}
+	if s.Scheduler != nil {
+		if err := s.Scheduler.Stop(ctx); err != nil {
+			return fmt.Errorf("failed to stop scheduler: %w", err)
+		}
+	}
+	if s.Datastore != nil {
+		if err := s.Datastore.Close(ctx); err != nil {
+			return fmt.Errorf("failed to close datastore: %w", err)
+		}
+	}
+	if s.shutdownTracing != nil {
+		if err := s.shutdownTracing(ctx); err != nil {
+			return fmt.Errorf("failed to flush traces: %w", err)
+		}
+	}
 
 	return nil
 }
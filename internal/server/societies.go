@@ -0,0 +1,375 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	h "github.com/nuigcompsoc/api/internal/helpers"
+	"github.com/nuigcompsoc/api/internal/models"
+	"github.com/nuigcompsoc/api/internal/services"
+)
+
+const (
+	maxSocietyNameLength        = 100
+	maxSocietyDescriptionLength = 5000
+	maxSocietySocialLinks       = 10
+)
+
+var (
+	slugPattern           = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+	slugSeparatorPattern  = regexp.MustCompile(`[^a-z0-9]+`)
+	socialPlatformPattern = regexp.MustCompile(`^[a-z0-9_]{1,32}$`)
+)
+
+/***************************
+ *
+ * = SOCIETIES V1 DIRECTORY =
+ *
+ ***************************/
+
+func (s *Server) SocietiesV1Get(c *gin.Context) {
+	societiesByName, err := s.Datastore.GetAllSocieties(c.Request.Context())
+	if err != nil {
+		h.RespondWithError(c, h.ErrDatabase.Because(err))
+		return
+	}
+
+	societies := []models.Society{}
+	for _, society := range societiesByName {
+		societies = append(societies, society)
+	}
+	sort.Slice(societies, func(i, j int) bool {
+		return strings.ToLower(societies[i].Name) < strings.ToLower(societies[j].Name)
+	})
+
+	h.RespondWithJSON(c, 200, societies)
+	return
+}
+
+func (s *Server) SocietiesV1SocIDGet(c *gin.Context) {
+	socID, err := parseSocietiesPortalID(c)
+	if err != nil {
+		h.RespondWithError(c, err)
+		return
+	}
+
+	society, err := s.Datastore.GetSocietyBySocietiesPortalID(c.Request.Context(), socID)
+	if errors.Is(err, models.ErrNotFound) {
+		h.RespondWithError(c, h.ErrNotFound.WithMessage("there is no society with id "+c.Param("id")+" in the directory"))
+		return
+	}
+	if err != nil {
+		h.RespondWithError(c, h.ErrDatabase.Because(err))
+		return
+	}
+
+	h.RespondWithJSON(c, 200, society)
+	return
+}
+
+func (s *Server) SocietiesV1Post(c *gin.Context) {
+	society, err := bindSociety(c)
+	if err != nil {
+		h.RespondWithError(c, err)
+		return
+	}
+
+	err = s.Datastore.CreateSociety(c.Request.Context(), society, c.GetString(h.AdminKey))
+	if errors.Is(err, models.ErrConflict) {
+		h.RespondWithError(c, h.ErrConflict.WithMessage("a society with that Name or SocietiesPortalID is already in the directory"))
+		return
+	}
+	if err != nil {
+		h.RespondWithError(c, h.ErrDatabase.Because(err))
+		return
+	}
+
+	h.RespondWithJSON(c, 201, society)
+	return
+}
+
+func (s *Server) SocietiesV1SocIDPut(c *gin.Context) {
+	socID, err := parseSocietiesPortalID(c)
+	if err != nil {
+		h.RespondWithError(c, err)
+		return
+	}
+
+	society, err := bindSociety(c, socID)
+	if err != nil {
+		h.RespondWithError(c, err)
+		return
+	}
+
+	// Replacing a society with what's stored changes nothing, and isn't audited
+	_, err = s.Datastore.UpdateSociety(c.Request.Context(), socID, society, c.GetString(h.AdminKey))
+	if errors.Is(err, models.ErrNotFound) {
+		h.RespondWithError(c, h.ErrNotFound.WithMessage("there is no society with id "+c.Param("id")+" in the directory"))
+		return
+	}
+	if errors.Is(err, models.ErrConflict) {
+		h.RespondWithError(c, h.ErrConflict.WithMessage("another society with that Name or SocietiesPortalID is already in the directory"))
+		return
+	}
+	if err != nil {
+		h.RespondWithError(c, h.ErrDatabase.Because(err))
+		return
+	}
+
+	h.RespondWithJSON(c, 200, society)
+	return
+}
+
+func (s *Server) SocietiesV1SocIDDelete(c *gin.Context) {
+	socID, err := parseSocietiesPortalID(c)
+	if err != nil {
+		h.RespondWithError(c, err)
+		return
+	}
+
+	err = s.Datastore.DeleteSociety(c.Request.Context(), socID, c.GetString(h.AdminKey))
+	if errors.Is(err, models.ErrNotFound) {
+		h.RespondWithError(c, h.ErrNotFound.WithMessage("there is no society with id "+c.Param("id")+" in the directory"))
+		return
+	}
+	if err != nil {
+		h.RespondWithError(c, h.ErrDatabase.Because(err))
+		return
+	}
+
+	h.Respond(c, 204)
+	return
+}
+
+// Lists who changed the society and how, newest first. Deleted societies
+// keep their audit log.
+func (s *Server) SocietiesV1SocIDAuditGet(c *gin.Context) {
+	socID, err := parseSocietiesPortalID(c)
+	if err != nil {
+		h.RespondWithError(c, err)
+		return
+	}
+
+	entries, err := s.Datastore.GetSocietyAudit(c.Request.Context(), socID)
+	if err != nil {
+		h.RespondWithError(c, h.ErrDatabase.Because(err))
+		return
+	}
+	// Societies from before the audit log have no entries yet
+	if len(entries) == 0 {
+		_, err := s.Datastore.GetSocietyBySocietiesPortalID(c.Request.Context(), socID)
+		if errors.Is(err, models.ErrNotFound) {
+			h.RespondWithError(c, h.ErrNotFound.WithMessage("there is no society with id "+c.Param("id")+" in the directory or its audit log"))
+			return
+		}
+		if err != nil {
+			h.RespondWithError(c, h.ErrDatabase.Because(err))
+			return
+		}
+	}
+
+	h.RespondWithJSON(c, 200, entries)
+	return
+}
+
+func parseSocietiesPortalID(c *gin.Context) (int32, error) {
+	socID, err := strconv.ParseInt(c.Param("id"), 10, 32)
+	if err != nil || socID <= 0 {
+		return 0, h.InvalidParameter("id", "could not convert socID into a positive integer")
+	}
+	return int32(socID), nil
+}
+
+// Decodes and validates the society in the request body. When replacing a
+// society its portal ID may be left out of the body, defaulting to socID.
+func bindSociety(c *gin.Context, socID ...int32) (models.Society, error) {
+	var society models.Society
+	dec := json.NewDecoder(c.Request.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&society); err != nil {
+		return society, h.ErrBadRequest.WithMessage("the body must be a society as JSON: " + err.Error())
+	}
+
+	if society.SocietiesPortalID == 0 && len(socID) > 0 {
+		society.SocietiesPortalID = socID[0]
+	}
+	if err := validateSociety(&society); err != nil {
+		return society, err
+	}
+	return society, nil
+}
+
+// Checks a society given to us by an admin, tidying it up on the way. Its
+// slug is made from its name if left out.
+func validateSociety(society *models.Society) error {
+	society.Name = strings.TrimSpace(society.Name)
+	if society.Name == "" {
+		return h.InvalidField("Name", "Name must not be empty")
+	}
+	if len(society.Name) > maxSocietyNameLength {
+		return h.InvalidField("Name", "Name must be at most "+strconv.Itoa(maxSocietyNameLength)+" bytes")
+	}
+
+	if society.SocietiesPortalID <= 0 {
+		return h.InvalidField("SocietiesPortalID", "SocietiesPortalID must be the society's positive ownerID on the societies portal")
+	}
+
+	if society.Slug == "" {
+		society.Slug = strings.Trim(slugSeparatorPattern.ReplaceAllString(strings.ToLower(society.Name), "-"), "-")
+	}
+	if !slugPattern.MatchString(society.Slug) {
+		return h.InvalidField("Slug", "Slug must be lowercase letters and digits separated by single hyphens")
+	}
+
+	society.Description = strings.TrimSpace(society.Description)
+	if len(society.Description) > maxSocietyDescriptionLength {
+		return h.InvalidField("Description", "Description must be at most "+strconv.Itoa(maxSocietyDescriptionLength)+" bytes")
+	}
+
+	if society.Website != "" && !isWebURL(society.Website) {
+		return h.InvalidField("Website", "Website must be an http or https URL")
+	}
+	if society.LogoURL != "" && !isWebURL(society.LogoURL) {
+		return h.InvalidField("LogoURL", "LogoURL must be an http or https URL")
+	}
+
+	if len(society.SocialLinks) > maxSocietySocialLinks {
+		return h.InvalidField("SocialLinks", "SocialLinks may have at most "+strconv.Itoa(maxSocietySocialLinks)+" links")
+	}
+	for platform, link := range society.SocialLinks {
+		if !socialPlatformPattern.MatchString(platform) {
+			return h.InvalidField("SocialLinks", "SocialLinks must be keyed by lowercase platform names, like instagram")
+		}
+		if !isWebURL(link) {
+			return h.InvalidField("SocialLinks."+platform, "SocialLinks."+platform+" must be an http or https URL")
+		}
+	}
+
+	return nil
+}
+
+func isWebURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+/***************************
+ *
+ * = SOCIETY PROPOSALS V1 =
+ *
+ ***************************/
+
+func (s *Server) SocietyProposalsV1Get(c *gin.Context) {
+	status := c.DefaultQuery("status", models.ProposalPending)
+	switch status {
+	case models.ProposalPending, models.ProposalApproved, models.ProposalRejected:
+	case "all":
+		status = ""
+	default:
+		h.RespondWithError(c, h.InvalidParameter("status", "status must be pending, approved, rejected or all"))
+		return
+	}
+
+	proposals, err := s.Datastore.GetSocietyProposals(c.Request.Context(), status)
+	if err != nil {
+		h.RespondWithError(c, h.ErrDatabase.Because(err))
+		return
+	}
+
+	h.RespondWithJSON(c, 200, proposals)
+	return
+}
+
+// Looks for new societies on the portal now, rather than waiting for the job
+func (s *Server) SocietyProposalsV1Post(c *gin.Context) {
+	proposals, err := services.NewSocietiesPortalService(&s.Config, s.Datastore).DiscoverSocieties(c.Request.Context())
+	if err != nil {
+		h.RespondWithError(c, h.ErrInternal.WithMessage("failed to discover societies on the societies portal").Because(err))
+		return
+	}
+
+	h.RespondWithJSON(c, 200, proposals)
+	return
+}
+
+// Starts tracking the proposed society, under the name the portal gave it.
+// If the society is already in the directory, say because an earlier approval
+// failed after creating it, the proposal is just marked approved.
+func (s *Server) SocietyProposalsV1SocIDApprovePost(c *gin.Context) {
+	socID, err := parseSocietiesPortalID(c)
+	if err != nil {
+		h.RespondWithError(c, err)
+		return
+	}
+
+	proposal, err := s.Datastore.GetSocietyProposal(c.Request.Context(), socID)
+	if errors.Is(err, models.ErrNotFound) {
+		h.RespondWithError(c, h.ErrNotFound.WithMessage("there is no proposal for the society with id "+c.Param("id")))
+		return
+	}
+	if err != nil {
+		h.RespondWithError(c, h.ErrDatabase.Because(err))
+		return
+	}
+
+	society := &models.Society{Name: proposal.Name, SocietiesPortalID: proposal.SocietiesPortalID}
+	if err := validateSociety(society); err != nil {
+		h.RespondWithError(c, err)
+		return
+	}
+	status := 201
+	err = s.Datastore.CreateSociety(c.Request.Context(), *society, c.GetString(h.AdminKey))
+	if errors.Is(err, models.ErrConflict) {
+		society, err = s.Datastore.GetSocietyBySocietiesPortalID(c.Request.Context(), socID)
+		if errors.Is(err, models.ErrNotFound) {
+			h.RespondWithError(c, h.ErrConflict.WithMessage("another society called "+proposal.Name+" is already in the directory, add this one under another name with POST /v1/societies"))
+			return
+		}
+		status = 200
+	}
+	if err != nil {
+		h.RespondWithError(c, h.ErrDatabase.Because(err))
+		return
+	}
+
+	if err := s.Datastore.DecideSocietyProposal(c.Request.Context(), socID, models.ProposalApproved, c.GetString(h.AdminKey)); err != nil {
+		h.RespondWithError(c, h.ErrDatabase.Because(err))
+		return
+	}
+
+	h.RespondWithJSON(c, status, society)
+	return
+}
+
+func (s *Server) SocietyProposalsV1SocIDRejectPost(c *gin.Context) {
+	socID, err := parseSocietiesPortalID(c)
+	if err != nil {
+		h.RespondWithError(c, err)
+		return
+	}
+
+	err = s.Datastore.DecideSocietyProposal(c.Request.Context(), socID, models.ProposalRejected, c.GetString(h.AdminKey))
+	if errors.Is(err, models.ErrNotFound) {
+		h.RespondWithError(c, h.ErrNotFound.WithMessage("there is no proposal for the society with id "+c.Param("id")))
+		return
+	}
+	if err != nil {
+		h.RespondWithError(c, h.ErrDatabase.Because(err))
+		return
+	}
+
+	proposal, err := s.Datastore.GetSocietyProposal(c.Request.Context(), socID)
+	if err != nil {
+		h.RespondWithError(c, h.ErrDatabase.Because(err))
+		return
+	}
+
+	h.RespondWithJSON(c, 200, proposal)
+	return
+}
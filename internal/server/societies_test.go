@@ -0,0 +1,234 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nuigcompsoc/api/internal/models"
+	"github.com/nuigcompsoc/api/internal/services"
+)
+
+const testAdminToken = "let-me-in"
+
+func TestSocietiesEndpoints(t *testing.T) {
+	s := &Server{Datastore: services.NewMemoryDatastore()}
+	s.Config.Admin.Tokens = map[string]string{"tester": testAdminToken}
+	r := SetupRouter()
+	s.routes(r)
+
+	// Each step builds on the ones before it
+	steps := []struct {
+		name      string
+		method    string
+		path      string
+		token     string
+		body      string
+		status    int
+		errorCode string
+		// Names of the societies listed afterwards
+		societies []string
+	}{
+		{name: "no societies", method: "GET", path: "/v1/societies", status: 200, societies: []string{}},
+		{name: "create without a token", method: "POST", path: "/v1/societies", body: `{"Name": "CompSoc", "SocietiesPortalID": 30}`, status: 401, errorCode: "unauthorized"},
+		{name: "create with a bad token", method: "POST", path: "/v1/societies", token: "let-me-in-please", body: `{"Name": "CompSoc", "SocietiesPortalID": 30}`, status: 401, errorCode: "unauthorized"},
+		{name: "create", method: "POST", path: "/v1/societies", token: testAdminToken, body: `{"Name": "CompSoc", "SocietiesPortalID": 30, "Website": "https://compsoc.ie", "SocialLinks": {"instagram": "https://instagram.com/ugcompsoc"}}`, status: 201, societies: []string{"CompSoc"}},
+		{name: "create another", method: "POST", path: "/v1/societies", token: testAdminToken, body: `{"Name": "Chess Society", "SocietiesPortalID": 31}`, status: 201, societies: []string{"Chess Society", "CompSoc"}},
+		{name: "create with a taken name", method: "POST", path: "/v1/societies", token: testAdminToken, body: `{"Name": "CompSoc", "SocietiesPortalID": 32}`, status: 409, errorCode: "conflict"},
+		{name: "create with a taken ID", method: "POST", path: "/v1/societies", token: testAdminToken, body: `{"Name": "DramaSoc", "SocietiesPortalID": 31}`, status: 409, errorCode: "conflict"},
+		{name: "create without a name", method: "POST", path: "/v1/societies", token: testAdminToken, body: `{"Name": " ", "SocietiesPortalID": 33}`, status: 400, errorCode: "invalid_field"},
+		{name: "create without an ID", method: "POST", path: "/v1/societies", token: testAdminToken, body: `{"Name": "DramaSoc"}`, status: 400, errorCode: "invalid_field"},
+		{name: "create with a bad website", method: "POST", path: "/v1/societies", token: testAdminToken, body: `{"Name": "DramaSoc", "SocietiesPortalID": 33, "Website": "javascript:alert(1)"}`, status: 400, errorCode: "invalid_field"},
+		{name: "create with a bad slug", method: "POST", path: "/v1/societies", token: testAdminToken, body: `{"Name": "DramaSoc", "SocietiesPortalID": 33, "Slug": "Drama Soc"}`, status: 400, errorCode: "invalid_field"},
+		{name: "create with an unknown field", method: "POST", path: "/v1/societies", token: testAdminToken, body: `{"Name": "DramaSoc", "SocietiesPortalID": 33, "Colour": "red"}`, status: 400, errorCode: "bad_request"},
+		{name: "create with a malformed body", method: "POST", path: "/v1/societies", token: testAdminToken, body: `{"Name": `, status: 400, errorCode: "bad_request"},
+
+		{name: "get", method: "GET", path: "/v1/societies/31", status: 200},
+		{name: "get missing", method: "GET", path: "/v1/societies/99", status: 404, errorCode: "not_found"},
+		{name: "get bad ID", method: "GET", path: "/v1/societies/chess", status: 400, errorCode: "invalid_parameter"},
+
+		{name: "rename", method: "PUT", path: "/v1/societies/31", token: testAdminToken, body: `{"Name": "ChessSoc"}`, status: 200, societies: []string{"ChessSoc", "CompSoc"}},
+		{name: "rename to a taken name", method: "PUT", path: "/v1/societies/31", token: testAdminToken, body: `{"Name": "CompSoc"}`, status: 409, errorCode: "conflict"},
+		{name: "replace missing", method: "PUT", path: "/v1/societies/99", token: testAdminToken, body: `{"Name": "DramaSoc"}`, status: 404, errorCode: "not_found"},
+		{name: "replace without a token", method: "PUT", path: "/v1/societies/31", body: `{"Name": "Chess"}`, status: 401, errorCode: "unauthorized"},
+
+		{name: "replace unchanged", method: "PUT", path: "/v1/societies/31", token: testAdminToken, body: `{"Name": "ChessSoc"}`, status: 200, societies: []string{"ChessSoc", "CompSoc"}},
+		{name: "audit without a token", method: "GET", path: "/v1/societies/31/audit", status: 401, errorCode: "unauthorized"},
+		{name: "audit", method: "GET", path: "/v1/societies/31/audit", token: testAdminToken, status: 200},
+		{name: "audit of an unknown society", method: "GET", path: "/v1/societies/99/audit", token: testAdminToken, status: 404, errorCode: "not_found"},
+
+		{name: "delete without a token", method: "DELETE", path: "/v1/societies/31", status: 401, errorCode: "unauthorized"},
+		{name: "delete", method: "DELETE", path: "/v1/societies/31", token: testAdminToken, status: 204, societies: []string{"CompSoc"}},
+		{name: "delete missing", method: "DELETE", path: "/v1/societies/31", token: testAdminToken, status: 404, errorCode: "not_found"},
+	}
+
+	for _, step := range steps {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(step.method, step.path, strings.NewReader(step.body))
+		if step.token != "" {
+			req.Header.Set("Authorization", "Bearer "+step.token)
+		}
+		r.ServeHTTP(w, req)
+
+		if w.Code != step.status {
+			t.Fatalf("%v: responded %v, want %v: %s", step.name, w.Code, step.status, w.Body.String())
+		}
+		if step.errorCode != "" {
+			var body eventsResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Error.Code != step.errorCode {
+				t.Errorf("%v: error code is %q, want %q", step.name, body.Error.Code, step.errorCode)
+			}
+		}
+
+		if step.societies == nil {
+			continue
+		}
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/societies", nil))
+		var body struct {
+			Data []models.Society `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%v: listing is not JSON: %v", step.name, err)
+		}
+		names := []string{}
+		for _, society := range body.Data {
+			names = append(names, society.Name)
+		}
+		if !reflect.DeepEqual(names, step.societies) {
+			t.Errorf("%v: societies are %v, want %v", step.name, names, step.societies)
+		}
+	}
+
+	society, err := s.Datastore.GetSocietyBySocietiesPortalID(context.Background(), 30)
+	if err != nil || society.Slug != "compsoc" || society.SocialLinks["instagram"] != "https://instagram.com/ugcompsoc" {
+		t.Errorf("stored society is %+v, %v", society, err)
+	}
+
+	// Created, renamed and deleted, the unchanged replacement isn't recorded
+	entries, err := s.Datastore.GetSocietyAudit(context.Background(), 31)
+	actions := []string{}
+	for _, entry := range entries {
+		actions = append(actions, entry.Actor+" "+entry.Action)
+	}
+	if want := []string{"tester deleted", "tester updated", "tester created"}; err != nil || !reflect.DeepEqual(actions, want) {
+		t.Errorf("audit is %v, %v, want %v", actions, err, want)
+	}
+}
+
+func TestSocietyProposalsEndpoints(t *testing.T) {
+	portal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]models.Event{
+			{EventID: 1, OwnerID: 30, OwnerTitle: "CompSoc"},
+			{EventID: 2, OwnerID: 40, OwnerTitle: "Drama &amp; Theatre"},
+			{EventID: 3, OwnerID: 40, OwnerTitle: "Drama &amp; Theatre"},
+			{EventID: 4, OwnerID: 41, OwnerTitle: "ChessSoc"},
+			{EventID: 5, OwnerID: 42, OwnerTitle: "CompSoc"},
+		})
+	}))
+	defer portal.Close()
+
+	s := &Server{Datastore: services.NewMemoryDatastore()}
+	s.Config.Admin.Tokens = map[string]string{"tester": testAdminToken}
+	s.Config.SocsPortal.AjaxEndpoint = portal.URL
+	if err := s.Datastore.CreateSociety(context.Background(), models.Society{Name: "CompSoc", SocietiesPortalID: 30}, "tester"); err != nil {
+		t.Fatal(err)
+	}
+	r := SetupRouter()
+	s.routes(r)
+
+	// Each step builds on the ones before it
+	steps := []struct {
+		name      string
+		method    string
+		path      string
+		token     string
+		status    int
+		errorCode string
+		// Portal IDs of the proposals responded with
+		proposals []int32
+	}{
+		{name: "list without a token", method: "GET", path: "/v1/society-proposals", status: 401, errorCode: "unauthorized"},
+		{name: "nothing discovered", method: "GET", path: "/v1/society-proposals", token: testAdminToken, status: 200, proposals: []int32{}},
+		{name: "discover without a token", method: "POST", path: "/v1/society-proposals", status: 401, errorCode: "unauthorized"},
+		{name: "discover", method: "POST", path: "/v1/society-proposals", token: testAdminToken, status: 200, proposals: []int32{41, 42, 40}},
+		{name: "approve without a token", method: "POST", path: "/v1/society-proposals/40/approve", status: 401, errorCode: "unauthorized"},
+		{name: "approve", method: "POST", path: "/v1/society-proposals/40/approve", token: testAdminToken, status: 201},
+		{name: "approve again", method: "POST", path: "/v1/society-proposals/40/approve", token: testAdminToken, status: 200},
+		{name: "approve a taken name", method: "POST", path: "/v1/society-proposals/42/approve", token: testAdminToken, status: 409, errorCode: "conflict"},
+		{name: "approve missing", method: "POST", path: "/v1/society-proposals/99/approve", token: testAdminToken, status: 404, errorCode: "not_found"},
+		{name: "reject", method: "POST", path: "/v1/society-proposals/42/reject", token: testAdminToken, status: 200},
+		{name: "reject missing", method: "POST", path: "/v1/society-proposals/99/reject", token: testAdminToken, status: 404, errorCode: "not_found"},
+		{name: "pending", method: "GET", path: "/v1/society-proposals", token: testAdminToken, status: 200, proposals: []int32{41}},
+		{name: "approved", method: "GET", path: "/v1/society-proposals?status=approved", token: testAdminToken, status: 200, proposals: []int32{40}},
+		{name: "all", method: "GET", path: "/v1/society-proposals?status=all", token: testAdminToken, status: 200, proposals: []int32{41, 42, 40}},
+		{name: "bad status", method: "GET", path: "/v1/society-proposals?status=maybe", token: testAdminToken, status: 400, errorCode: "invalid_parameter"},
+		{name: "discover again", method: "POST", path: "/v1/society-proposals", token: testAdminToken, status: 200, proposals: []int32{41}},
+	}
+
+	for _, step := range steps {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(step.method, step.path, nil)
+		if step.token != "" {
+			req.Header.Set("Authorization", "Bearer "+step.token)
+		}
+		r.ServeHTTP(w, req)
+
+		if w.Code != step.status {
+			t.Fatalf("%v: responded %v, want %v: %s", step.name, w.Code, step.status, w.Body.String())
+		}
+		if step.errorCode != "" {
+			var body eventsResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Error.Code != step.errorCode {
+				t.Errorf("%v: error code is %q, want %q", step.name, body.Error.Code, step.errorCode)
+			}
+		}
+
+		if step.proposals == nil {
+			continue
+		}
+		var body struct {
+			Data []models.SocietyProposal `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%v: proposals are not JSON: %v", step.name, err)
+		}
+		ids := []int32{}
+		for _, proposal := range body.Data {
+			ids = append(ids, proposal.SocietiesPortalID)
+		}
+		if !reflect.DeepEqual(ids, step.proposals) {
+			t.Errorf("%v: proposals are %v, want %v", step.name, ids, step.proposals)
+		}
+	}
+
+	society, err := s.Datastore.GetSocietyBySocietiesPortalID(context.Background(), 40)
+	if err != nil || society.Name != "Drama & Theatre" || society.Slug != "drama-theatre" {
+		t.Errorf("approved society is %+v, %v", society, err)
+	}
+	proposal, err := s.Datastore.GetSocietyProposal(context.Background(), 42)
+	if err != nil || proposal.DecidedBy != "tester" {
+		t.Errorf("rejected proposal is %+v, %v", proposal, err)
+	}
+
+	// An approval that created the society but failed to decide the proposal
+	// can be retried
+	if err := s.Datastore.CreateSociety(context.Background(), models.Society{Name: "ChessSoc", SocietiesPortalID: 41}, "tester"); err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/v1/society-proposals/41/approve", nil)
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+	r.ServeHTTP(w, req)
+	if w.Code != 200 {
+		t.Fatalf("retried approval responded %v: %s", w.Code, w.Body.String())
+	}
+	proposal, err = s.Datastore.GetSocietyProposal(context.Background(), 41)
+	if err != nil || proposal.Status != models.ProposalApproved {
+		t.Errorf("retried proposal is %+v, %v", proposal, err)
+	}
+}
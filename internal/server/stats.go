@@ -0,0 +1,78 @@
+package server
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	h "github.com/nuigcompsoc/api/internal/helpers"
+	"github.com/nuigcompsoc/api/internal/models"
+)
+
+// The most societies the leaderboard lists at once
+const maxLeaderboardLimit = 500
+
+/***************************
+ *
+ * = STATS V1 ENDPOINTS =
+ *
+ ***************************/
+
+// Sums up how active a society is, over the events between from and to if
+// given. Only societies in the directory have stats.
+func (s *Server) SocietiesV1SocIDStatsGet(c *gin.Context) {
+	socID, err := parseSocietiesPortalID(c)
+	if err != nil {
+		h.RespondWithError(c, err)
+		return
+	}
+
+	filter := models.EventFilter{}
+	if err := parseEventConditions(c, &filter); err != nil {
+		h.RespondWithError(c, err)
+		return
+	}
+
+	society, err := s.Datastore.GetSocietyBySocietiesPortalID(c.Request.Context(), socID)
+	if err != nil {
+		h.RespondWithError(c, h.ErrDatabase.Because(err))
+		return
+	}
+
+	stats, err := s.Datastore.GetSocietyStats(c.Request.Context(), int(socID), filter)
+	if err != nil {
+		h.RespondWithError(c, h.ErrDatabase.Because(err))
+		return
+	}
+	stats.SocietyName = society.Name
+
+	h.RespondWithJSON(c, 200, stats)
+	return
+}
+
+// Ranks societies by how many events they ran, all of them unless limit is
+// given
+func (s *Server) SocietiesV1LeaderboardGet(c *gin.Context) {
+	filter := models.EventFilter{}
+	if err := parseEventConditions(c, &filter); err != nil {
+		h.RespondWithError(c, err)
+		return
+	}
+
+	if limit := c.Query("limit"); limit != "" {
+		var err error
+		filter.Limit, err = strconv.ParseInt(limit, 10, 64)
+		if err != nil || filter.Limit < 1 || filter.Limit > maxLeaderboardLimit {
+			h.RespondWithError(c, h.InvalidParameter("limit", "limit must be an integer between 1 and "+strconv.Itoa(maxLeaderboardLimit)))
+			return
+		}
+	}
+
+	rankings, err := s.Datastore.GetSocietyLeaderboard(c.Request.Context(), filter)
+	if err != nil {
+		h.RespondWithError(c, h.ErrDatabase.Because(err))
+		return
+	}
+
+	h.RespondWithJSON(c, 200, rankings)
+	return
+}
@@ -2,21 +2,35 @@ package services
 
 import (
 	"context"
+	"errors"
 	"sync"
 	"time"
 
 	"github.com/nuigcompsoc/api/internal/config"
+	"github.com/nuigcompsoc/api/internal/logging"
+	"github.com/nuigcompsoc/api/internal/metrics"
 	"github.com/nuigcompsoc/api/internal/models"
 
 	log "github.com/sirupsen/logrus"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/event"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.opentelemetry.io/contrib/instrumentation/go.mongodb.org/mongo-driver/mongo/otelmongo"
 )
 
+// How long queries get when database.query_timeout isn't set
+const defaultQueryTimeout = 30 * time.Second
+
 type MongoDatastore struct {
 	db      *mongo.Database
 	Session *mongo.Client
+
+	// How long a single datastore method may take, on top of any deadline
+	// the caller's context already has
+	queryTimeout time.Duration
 }
 
 /*
@@ -32,6 +46,10 @@ func NewDatastore(config *config.Config) *MongoDatastore {
 		mongoDataStore = new(MongoDatastore)
 		mongoDataStore.db = db
 		mongoDataStore.Session = session
+		mongoDataStore.queryTimeout = config.Database.QueryTimeout
+		if mongoDataStore.queryTimeout <= 0 {
+			mongoDataStore.queryTimeout = defaultQueryTimeout
+		}
 		return mongoDataStore
 	}
 
@@ -58,13 +76,13 @@ func connectToMongo(config *config.Config) (a *mongo.Database, b *mongo.Client)
 		Username: config.Database.Username,
 		Password: config.Database.Password,
 	}
-	session, err := mongo.NewClient(options.Client().ApplyURI(config.Database.Host).SetAuth(credential))
+	session, err := mongo.NewClient(options.Client().ApplyURI(config.Database.Host).SetAuth(credential).SetMonitor(combineMonitors(metrics.MongoMonitor(), otelmongo.NewMonitor())))
 	if err != nil {
 		log.WithField("error", err).Warn("Failed to connect to Database Host")
 		return nil, nil
 	}
 
-	var ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
+	var ctx, cancel = context.WithTimeout(context.Background(), config.Timeouts.Startup)
 	defer cancel()
 	err = session.Connect(ctx)
 	if err != nil {
@@ -84,43 +102,104 @@ func connectToMongo(config *config.Config) (a *mongo.Database, b *mongo.Client)
 	return DB, session
 }
 
+// Ping checks the database is reachable
+func (ds *MongoDatastore) Ping(ctx context.Context) error {
+	if ds == nil || ds.Session == nil {
+		return errors.New("not connected to the database")
+	}
+	return ds.Session.Ping(ctx, readpref.Primary())
+}
+
+// Close disconnects from the database, waiting for operations in progress
+// until ctx is done
+func (ds *MongoDatastore) Close(ctx context.Context) error {
+	if ds == nil || ds.Session == nil {
+		return nil
+	}
+	return ds.Session.Disconnect(ctx)
+}
+
+// The Mongo client only takes a single monitor, so this one passes every
+// event on to each of monitors
+func combineMonitors(monitors ...*event.CommandMonitor) *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			for _, m := range monitors {
+				if m.Started != nil {
+					m.Started(ctx, e)
+				}
+			}
+		},
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			for _, m := range monitors {
+				if m.Succeeded != nil {
+					m.Succeeded(ctx, e)
+				}
+			}
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			for _, m := range monitors {
+				if m.Failed != nil {
+					m.Failed(ctx, e)
+				}
+			}
+		},
+	}
+}
+
 /*
  *	Society Database Helpers
  */
-func (ds *MongoDatastore) UpsertSociety(society models.Society) error {
-
-	var ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
+func (ds *MongoDatastore) UpsertSociety(ctx context.Context, society models.Society, actor string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, ds.queryTimeout)
 	defer cancel()
 
-	filter := bson.D{{Key: "name", Value: society.Name}}
-	update := bson.D{{Key: "$set", Value: society}}
-	opts := options.Update().SetUpsert(true)
-
-	result, err := ds.db.Collection("societies").UpdateOne(ctx, filter, update, opts)
+	stored, err := ds.GetSocietyBySocietyName(ctx, society.Name)
+	if errors.Is(err, models.ErrNotFound) {
+		if err := ds.CreateSociety(ctx, society, actor); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
 	if err != nil {
-		log.WithField("error", err).Warn("Failed to update Society %v", society.Name)
+		return false, err
+	}
+
+	society = mergeSocietyMetadata(society, *stored)
+	if len(stored.ChangedFields(society)) == 0 {
+		logging.FromContext(ctx).WithField("society", society.Name).Debug("Society is unchanged")
+		return false, nil
+	}
+	if err := ds.checkSocietyUnique(ctx, society, &stored.SocietiesPortalID); err != nil {
+		return false, err
 	}
 
-	log.Debug("Number of documents updated: %v\n", result.ModifiedCount)
-	log.Debug("Number of documents upserted: %v\n", result.UpsertedCount)
+	_, err = ds.db.Collection("societies").ReplaceOne(ctx, bson.D{{Key: "name", Value: society.Name}}, society)
+	if mongo.IsDuplicateKeyError(err) {
+		return false, models.ErrConflict
+	}
+	if err != nil {
+		logging.FromContext(ctx).WithFields(log.Fields{"error": err, "society": society.Name}).Warn("Failed to update Society")
+		return false, err
+	}
 
-	return nil
+	return true, ds.recordSocietyAudit(ctx, newSocietyAuditEntry(actor, stored, &society, time.Now().UTC()))
 }
 
-func (ds *MongoDatastore) GetAllSocieties() (map[string]models.Society, error) {
-	var ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
+func (ds *MongoDatastore) GetAllSocieties(ctx context.Context) (map[string]models.Society, error) {
+	ctx, cancel := context.WithTimeout(ctx, ds.queryTimeout)
 	defer cancel()
 
 	cursor, err := ds.db.Collection("societies").Find(ctx, bson.D{})
 	if err != nil {
-		log.WithField("error", err).Debug("Failed to return cursor to find all documents in societies collection")
+		logging.FromContext(ctx).WithField("error", err).Debug("Failed to return cursor to find all documents in societies collection")
 		return nil, err
 	}
 
 	societies := []models.Society{}
 	err = cursor.All(ctx, &societies)
 	if err != nil {
-		log.WithField("error", err).Debug("Failed to use cursor to find all documents in societies collection")
+		logging.FromContext(ctx).WithField("error", err).Debug("Failed to use cursor to find all documents in societies collection")
 		return nil, err
 	}
 
@@ -132,28 +211,415 @@ func (ds *MongoDatastore) GetAllSocieties() (map[string]models.Society, error) {
 	return societiesMap, nil
 }
 
-func (ds *MongoDatastore) GetSocietyBySocietyName(societyName string) (*models.Society, error) {
-	var ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
+func (ds *MongoDatastore) GetSocietyBySocietyName(ctx context.Context, societyName string) (*models.Society, error) {
+	ctx, cancel := context.WithTimeout(ctx, ds.queryTimeout)
 	defer cancel()
 
 	var society models.Society
 	err := ds.db.Collection("societies").FindOne(ctx, bson.D{{Key: "name", Value: societyName}}).Decode(&society)
+	if err == mongo.ErrNoDocuments {
+		logging.FromContext(ctx).Infof("Society %v not found", societyName)
+		return nil, models.ErrNotFound
+	}
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			log.Info("Society %v not found", societyName)
-		} else {
-			log.WithField("error", err).Warn("Failed to return single society from societies collection")
-			return nil, err
-		}
+		logging.FromContext(ctx).WithField("error", err).Warn("Failed to return single society from societies collection")
+		return nil, err
+	}
+
+	return &society, nil
+}
+
+func (ds *MongoDatastore) GetSocietyBySocietiesPortalID(ctx context.Context, societiesPortalID int32) (*models.Society, error) {
+	ctx, cancel := context.WithTimeout(ctx, ds.queryTimeout)
+	defer cancel()
+
+	var society models.Society
+	err := ds.db.Collection("societies").FindOne(ctx, bson.D{{Key: "societiesportalid", Value: societiesPortalID}}).Decode(&society)
+	if err == mongo.ErrNoDocuments {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		logging.FromContext(ctx).WithFields(log.Fields{"error": err, "societiesPortalID": societiesPortalID}).Warn("Failed to return single society from societies collection")
+		return nil, err
 	}
 
 	return &society, nil
 }
 
+func (ds *MongoDatastore) CreateSociety(ctx context.Context, society models.Society, actor string) error {
+	ctx, cancel := context.WithTimeout(ctx, ds.queryTimeout)
+	defer cancel()
+
+	if err := ds.checkSocietyUnique(ctx, society, nil); err != nil {
+		return err
+	}
+
+	// The unique indexes catch societies created since we checked
+	_, err := ds.db.Collection("societies").InsertOne(ctx, society)
+	if mongo.IsDuplicateKeyError(err) {
+		return models.ErrConflict
+	}
+	if err != nil {
+		logging.FromContext(ctx).WithFields(log.Fields{"error": err, "society": society.Name}).Warn("Failed to insert Society")
+		return err
+	}
+
+	return ds.recordSocietyAudit(ctx, newSocietyAuditEntry(actor, nil, &society, time.Now().UTC()))
+}
+
+func (ds *MongoDatastore) UpdateSociety(ctx context.Context, societiesPortalID int32, society models.Society, actor string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, ds.queryTimeout)
+	defer cancel()
+
+	stored, err := ds.GetSocietyBySocietiesPortalID(ctx, societiesPortalID)
+	if err != nil {
+		return false, err
+	}
+	if len(stored.ChangedFields(society)) == 0 {
+		return false, nil
+	}
+	if err := ds.checkSocietyUnique(ctx, society, &societiesPortalID); err != nil {
+		return false, err
+	}
+
+	result, err := ds.db.Collection("societies").ReplaceOne(ctx, bson.D{{Key: "societiesportalid", Value: societiesPortalID}}, society)
+	if mongo.IsDuplicateKeyError(err) {
+		return false, models.ErrConflict
+	}
+	if err != nil {
+		logging.FromContext(ctx).WithFields(log.Fields{"error": err, "society": society.Name}).Warn("Failed to replace Society")
+		return false, err
+	}
+	if result.MatchedCount == 0 {
+		// Deleted since we found it
+		return false, models.ErrNotFound
+	}
+
+	return true, ds.recordSocietyAudit(ctx, newSocietyAuditEntry(actor, stored, &society, time.Now().UTC()))
+}
+
+func (ds *MongoDatastore) DeleteSociety(ctx context.Context, societiesPortalID int32, actor string) error {
+	ctx, cancel := context.WithTimeout(ctx, ds.queryTimeout)
+	defer cancel()
+
+	stored, err := ds.GetSocietyBySocietiesPortalID(ctx, societiesPortalID)
+	if err != nil {
+		return err
+	}
+
+	result, err := ds.db.Collection("societies").DeleteOne(ctx, bson.D{{Key: "societiesportalid", Value: societiesPortalID}})
+	if err != nil {
+		logging.FromContext(ctx).WithFields(log.Fields{"error": err, "societiesPortalID": societiesPortalID}).Warn("Failed to delete Society")
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return models.ErrNotFound
+	}
+
+	return ds.recordSocietyAudit(ctx, newSocietyAuditEntry(actor, stored, nil, time.Now().UTC()))
+}
+
+func (ds *MongoDatastore) GetSocietyAudit(ctx context.Context, societiesPortalID int32) ([]models.SocietyAuditEntry, error) {
+	ctx, cancel := context.WithTimeout(ctx, ds.queryTimeout)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "at", Value: -1}, {Key: "_id", Value: -1}})
+	cursor, err := ds.db.Collection("society_audit").Find(ctx, bson.D{{Key: "societies_portal_id", Value: societiesPortalID}}, opts)
+	if err != nil {
+		logging.FromContext(ctx).WithField("error", err).Warn("Failed to return cursor to find society audit entries")
+		return nil, err
+	}
+
+	entries := []models.SocietyAuditEntry{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		logging.FromContext(ctx).WithField("error", err).Warn("Failed to use cursor to find society audit entries")
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (ds *MongoDatastore) recordSocietyAudit(ctx context.Context, entry models.SocietyAuditEntry) error {
+	_, err := ds.db.Collection("society_audit").InsertOne(ctx, entry)
+	if err != nil {
+		logging.FromContext(ctx).WithFields(log.Fields{"error": err, "societiesPortalID": entry.SocietiesPortalID}).Warn("Failed to record society audit entry")
+	}
+	return err
+}
+
+func (ds *MongoDatastore) checkSocietyUnique(ctx context.Context, society models.Society, existing *int32) error {
+	filter := bson.M{"$or": bson.A{
+		bson.M{"name": society.Name},
+		bson.M{"societiesportalid": society.SocietiesPortalID},
+	}}
+	if existing != nil {
+		filter = bson.M{"$and": bson.A{filter, bson.M{"societiesportalid": bson.M{"$ne": *existing}}}}
+	}
+
+	count, err := ds.db.Collection("societies").CountDocuments(ctx, filter)
+	if err != nil {
+		logging.FromContext(ctx).WithField("error", err).Warn("Failed to count conflicting societies")
+		return err
+	}
+	if count > 0 {
+		return models.ErrConflict
+	}
+
+	return nil
+}
+
+/*
+ *	Society Proposal Database Helpers
+ */
+
+func (ds *MongoDatastore) UpsertSocietyProposals(ctx context.Context, proposals []models.SocietyProposal) error {
+	ctx, cancel := context.WithTimeout(ctx, ds.queryTimeout)
+	defer cancel()
+
+	if len(proposals) == 0 {
+		return nil
+	}
+
+	writeModels := []mongo.WriteModel{}
+	for _, proposal := range proposals {
+		writeModels = append(writeModels, mongo.NewUpdateOneModel().
+			SetFilter(bson.D{{Key: "societies_portal_id", Value: proposal.SocietiesPortalID}}).
+			SetUpdate(bson.D{
+				{Key: "$set", Value: bson.D{
+					{Key: "name", Value: proposal.Name},
+					{Key: "event_count", Value: proposal.EventCount},
+					{Key: "last_seen", Value: proposal.LastSeen},
+				}},
+				{Key: "$setOnInsert", Value: bson.D{
+					{Key: "first_seen", Value: proposal.FirstSeen},
+					{Key: "status", Value: models.ProposalPending},
+				}},
+			}).
+			SetUpsert(true))
+	}
+
+	results, err := ds.db.Collection("society_proposals").BulkWrite(ctx, writeModels, options.BulkWrite().SetOrdered(false))
+	if err != nil {
+		logging.FromContext(ctx).WithField("error", err).Warn("Failed to BulkWrite society proposals")
+		return err
+	}
+
+	logging.FromContext(ctx).Info("Number of new society proposals: ", results.UpsertedCount)
+	return nil
+}
+
+func (ds *MongoDatastore) GetSocietyProposals(ctx context.Context, status string) ([]models.SocietyProposal, error) {
+	ctx, cancel := context.WithTimeout(ctx, ds.queryTimeout)
+	defer cancel()
+
+	filter := bson.D{}
+	if status != "" {
+		filter = bson.D{{Key: "status", Value: status}}
+	}
+	cursor, err := ds.db.Collection("society_proposals").Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "name", Value: 1}}))
+	if err != nil {
+		logging.FromContext(ctx).WithField("error", err).Warn("Failed to return cursor to find society proposals")
+		return nil, err
+	}
+
+	proposals := []models.SocietyProposal{}
+	if err := cursor.All(ctx, &proposals); err != nil {
+		logging.FromContext(ctx).WithField("error", err).Warn("Failed to use cursor to find society proposals")
+		return nil, err
+	}
+
+	return proposals, nil
+}
+
+func (ds *MongoDatastore) GetSocietyProposal(ctx context.Context, societiesPortalID int32) (*models.SocietyProposal, error) {
+	ctx, cancel := context.WithTimeout(ctx, ds.queryTimeout)
+	defer cancel()
+
+	var proposal models.SocietyProposal
+	err := ds.db.Collection("society_proposals").FindOne(ctx, bson.D{{Key: "societies_portal_id", Value: societiesPortalID}}).Decode(&proposal)
+	if err == mongo.ErrNoDocuments {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		logging.FromContext(ctx).WithFields(log.Fields{"error": err, "societiesPortalID": societiesPortalID}).Warn("Failed to return single society proposal")
+		return nil, err
+	}
+
+	return &proposal, nil
+}
+
+func (ds *MongoDatastore) DecideSocietyProposal(ctx context.Context, societiesPortalID int32, status string, decidedBy string) error {
+	ctx, cancel := context.WithTimeout(ctx, ds.queryTimeout)
+	defer cancel()
+
+	result, err := ds.db.Collection("society_proposals").UpdateOne(ctx,
+		bson.D{{Key: "societies_portal_id", Value: societiesPortalID}},
+		bson.D{{Key: "$set", Value: bson.D{
+			{Key: "status", Value: status},
+			{Key: "decided_by", Value: decidedBy},
+			{Key: "decided_at", Value: time.Now().UTC()},
+		}}})
+	if err != nil {
+		logging.FromContext(ctx).WithFields(log.Fields{"error": err, "societiesPortalID": societiesPortalID}).Warn("Failed to decide society proposal")
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return models.ErrNotFound
+	}
+
+	return nil
+}
+
+/*
+ *	Job Run Database Helpers
+ */
+
+func (ds *MongoDatastore) RecordJobRun(ctx context.Context, run models.JobRun) error {
+	ctx, cancel := context.WithTimeout(ctx, ds.queryTimeout)
+	defer cancel()
+
+	_, err := ds.db.Collection("job_runs").InsertOne(ctx, run)
+	if err != nil {
+		logging.FromContext(ctx).WithFields(log.Fields{"error": err, "job": run.Job}).Warn("Failed to record job run")
+	}
+	return err
+}
+
+func (ds *MongoDatastore) GetJobRuns(ctx context.Context, job string, limit int64) ([]models.JobRun, error) {
+	ctx, cancel := context.WithTimeout(ctx, ds.queryTimeout)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "started_at", Value: -1}, {Key: "_id", Value: -1}}).SetLimit(limit)
+	cursor, err := ds.db.Collection("job_runs").Find(ctx, bson.D{{Key: "job", Value: job}}, opts)
+	if err != nil {
+		logging.FromContext(ctx).WithFields(log.Fields{"error": err, "job": job}).Warn("Failed to return cursor to find job runs")
+		return nil, err
+	}
+
+	runs := []models.JobRun{}
+	if err := cursor.All(ctx, &runs); err != nil {
+		logging.FromContext(ctx).WithFields(log.Fields{"error": err, "job": job}).Warn("Failed to use cursor to find job runs")
+		return nil, err
+	}
+	return runs, nil
+}
+
+func (ds *MongoDatastore) GetLastJobRun(ctx context.Context, job string, outcome string) (*models.JobRun, error) {
+	ctx, cancel := context.WithTimeout(ctx, ds.queryTimeout)
+	defer cancel()
+
+	var run models.JobRun
+	opts := options.FindOne().SetSort(bson.D{{Key: "started_at", Value: -1}, {Key: "_id", Value: -1}})
+	err := ds.db.Collection("job_runs").FindOne(ctx, bson.D{{Key: "job", Value: job}, {Key: "outcome", Value: outcome}}, opts).Decode(&run)
+	if err == mongo.ErrNoDocuments {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		logging.FromContext(ctx).WithFields(log.Fields{"error": err, "job": job}).Warn("Failed to return last job run")
+		return nil, err
+	}
+
+	return &run, nil
+}
+
+/*
+ *	Lock Database Helpers
+ */
+
+// Leases are timed by the clock of the replica taking them, so replicas'
+// clocks should agree to well within a lease
+func (ds *MongoDatastore) AcquireLock(ctx context.Context, name string, holder string, ttl time.Duration) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, ds.queryTimeout)
+	defer cancel()
+
+	// Matches the lock only if it's free to take, when it isn't the upsert
+	// collides with it instead
+	now := time.Now().UTC()
+	filter := bson.D{
+		{Key: "_id", Value: name},
+		{Key: "$or", Value: bson.A{
+			bson.D{{Key: "holder", Value: holder}},
+			bson.D{{Key: "expires_at", Value: bson.D{{Key: "$lte", Value: now}}}},
+		}},
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "holder", Value: holder},
+		{Key: "acquired_at", Value: now},
+		{Key: "expires_at", Value: now.Add(ttl)},
+	}}}
+	_, err := ds.db.Collection("locks").UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	if err != nil {
+		logging.FromContext(ctx).WithFields(log.Fields{"error": err, "lock": name}).Warn("Failed to acquire lock")
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (ds *MongoDatastore) RenewLock(ctx context.Context, name string, holder string, ttl time.Duration) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, ds.queryTimeout)
+	defer cancel()
+
+	result, err := ds.db.Collection("locks").UpdateOne(ctx,
+		bson.D{{Key: "_id", Value: name}, {Key: "holder", Value: holder}},
+		bson.D{{Key: "$set", Value: bson.D{{Key: "expires_at", Value: time.Now().UTC().Add(ttl)}}}})
+	if err != nil {
+		logging.FromContext(ctx).WithFields(log.Fields{"error": err, "lock": name}).Warn("Failed to renew lock")
+		return false, err
+	}
+
+	return result.MatchedCount > 0, nil
+}
+
+func (ds *MongoDatastore) ReleaseLock(ctx context.Context, name string, holder string) error {
+	ctx, cancel := context.WithTimeout(ctx, ds.queryTimeout)
+	defer cancel()
+
+	_, err := ds.db.Collection("locks").DeleteOne(ctx, bson.D{{Key: "_id", Value: name}, {Key: "holder", Value: holder}})
+	if err != nil {
+		logging.FromContext(ctx).WithFields(log.Fields{"error": err, "lock": name}).Warn("Failed to release lock")
+	}
+	return err
+}
+
+func (ds *MongoDatastore) GetLock(ctx context.Context, name string) (*models.Lock, error) {
+	ctx, cancel := context.WithTimeout(ctx, ds.queryTimeout)
+	defer cancel()
+
+	var lock models.Lock
+	err := ds.db.Collection("locks").FindOne(ctx, bson.D{
+		{Key: "_id", Value: name},
+		{Key: "expires_at", Value: bson.D{{Key: "$gt", Value: time.Now().UTC()}}},
+	}).Decode(&lock)
+	if err == mongo.ErrNoDocuments {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		logging.FromContext(ctx).WithFields(log.Fields{"error": err, "lock": name}).Warn("Failed to return lock")
+		return nil, err
+	}
+
+	return &lock, nil
+}
+
 /*
  *	Event Database Helpers
  */
-func (ds *MongoDatastore) UpsertEvents(events []models.DatabaseEvent) error {
+func (ds *MongoDatastore) UpsertEvents(ctx context.Context, events []models.DatabaseEvent) error {
+
+	ctx, cancel := context.WithTimeout(ctx, ds.queryTimeout)
+	defer cancel()
+
+	if len(events) == 0 {
+		return nil
+	}
+
+	err := ds.versionEvents(ctx, events)
+	if err != nil {
+		return err
+	}
 
 	writeModels := []mongo.WriteModel{}
 	for _, event := range events {
@@ -164,140 +630,524 @@ func (ds *MongoDatastore) UpsertEvents(events []models.DatabaseEvent) error {
 	}
 	opts := options.BulkWrite().SetOrdered(false)
 
-	var ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
 	results, err := ds.db.Collection("events").BulkWrite(ctx, writeModels, opts)
 	if err != nil {
-		log.WithField("error", err).Warn("Failed to BulkWrite events to collection")
+		logging.FromContext(ctx).WithField("error", err).Warn("Failed to BulkWrite events to collection")
 		return err
 	}
 
-	log.Info("Inserted/Updated events to events collection")
-	log.Info("Number of documents upserted: ", results.UpsertedCount)
-	log.Info("Number of documents inserted: ", results.InsertedCount)
-	log.Info("Number of documents modified: ", results.ModifiedCount)
-	log.Info("Number of documents matched: ", results.MatchedCount)
+	logging.FromContext(ctx).Info("Inserted/Updated events to events collection")
+	logging.FromContext(ctx).Info("Number of documents upserted: ", results.UpsertedCount)
+	logging.FromContext(ctx).Info("Number of documents inserted: ", results.InsertedCount)
+	logging.FromContext(ctx).Info("Number of documents modified: ", results.ModifiedCount)
+	logging.FromContext(ctx).Info("Number of documents matched: ", results.MatchedCount)
 
 	return nil
 }
 
-func (ds *MongoDatastore) GetAllEvents() ([]models.EventDetails, error) {
-	var ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+// versionEvents versions events about to be upserted against the copies
+// already stored, see DatabaseEvent.Version
+func (ds *MongoDatastore) versionEvents(ctx context.Context, events []models.DatabaseEvent) error {
+	eventDetailsIDs := []int{}
+	for _, event := range events {
+		eventDetailsIDs = append(eventDetailsIDs, event.EventDetailsID)
+	}
+
+	cursor, err := ds.db.Collection("events").Find(ctx,
+		bson.M{"event_details_id": bson.M{"$in": eventDetailsIDs}},
+		options.Find().SetProjection(bson.M{
+			"event_id":         1,
+			"event_details_id": 1,
+			"sequence":         1,
+			"updated_at":       1,
+			"content_hash":     1,
+		}))
+	if err != nil {
+		logging.FromContext(ctx).WithField("error", err).Warn("Failed to return cursor to find existing versions of events")
+		return err
+	}
+
+	stored := []models.DatabaseEvent{}
+	err = cursor.All(ctx, &stored)
+	if err != nil {
+		logging.FromContext(ctx).WithField("error", err).Warn("Failed to use cursor to find existing versions of events")
+		return err
+	}
+
+	type eventKey struct{ eventID, eventDetailsID int }
+	existing := map[eventKey]models.DatabaseEvent{}
+	for _, event := range stored {
+		existing[eventKey{event.EventID, event.EventDetailsID}] = event
+	}
+
+	now := time.Now().UTC()
+	for i, event := range events {
+		var previous *models.DatabaseEvent
+		if stored, ok := existing[eventKey{event.EventID, event.EventDetailsID}]; ok {
+			previous = &stored
+		}
+		events[i].Version(previous, now)
+	}
+
+	return nil
+}
 
-	cursor, err := ds.db.Collection("events").Find(ctx, bson.D{})
+func (ds *MongoDatastore) GetAllEvents(ctx context.Context, filter models.EventFilter) (*models.EventPage, error) {
+	page, err := ds.findEvents(ctx, bson.M{}, filter)
 	if err != nil {
-		log.WithField("error", err).Warn("Failed to return cursor to find all documents in events collection")
+		logging.FromContext(ctx).WithField("error", err).Warn("Failed to find all documents in events collection")
 		return nil, err
 	}
 
-	events := []models.EventDetails{}
-	err = cursor.All(ctx, &events)
+	return page, nil
+}
+
+func (ds *MongoDatastore) GetAllUpcomingEvents(ctx context.Context, filter models.EventFilter) (*models.EventPage, error) {
+	// Find upcoming events, but also include events that ended at most an hour ago
+	page, err := ds.findEvents(ctx, bson.M{"end_datetime": bson.M{
+		"$gte": upcomingCutoff(),
+	}}, filter)
+	if err != nil {
+		logging.FromContext(ctx).WithField("error", err).Warn("Failed to find all documents that are upcoming in events collection")
+		return nil, err
+	}
+
+	return page, nil
+}
+
+func (ds *MongoDatastore) GetAllPastEvents(ctx context.Context, filter models.EventFilter) (*models.EventPage, error) {
+	// Find past events, but also not including events that ended at most an hour ago
+	page, err := ds.findEvents(ctx, bson.M{"end_datetime": bson.M{
+		"$lt": upcomingCutoff(),
+	}}, filter)
+	if err != nil {
+		logging.FromContext(ctx).WithField("error", err).Warn("Failed to find all documents that are past in events collection")
+		return nil, err
+	}
+
+	return page, nil
+}
+
+func (ds *MongoDatastore) GetAllUpcomingEventsForSocID(ctx context.Context, socID int, filter models.EventFilter) (*models.EventPage, error) {
+	// Find upcoming events for society, but also include events that ended at most an hour ago
+	page, err := ds.findEvents(ctx,
+		bson.M{
+			"end_datetime": bson.M{
+				"$gte": upcomingCutoff(),
+			},
+			"society_id": socID,
+		}, filter)
+	if err != nil {
+		logging.FromContext(ctx).WithFields(log.Fields{"error": err, "socID": socID}).Warn("Failed to find all documents for society that are upcoming in events collection")
+		return nil, err
+	}
+
+	return page, nil
+}
+
+func (ds *MongoDatastore) GetAllPastEventsForSocID(ctx context.Context, socID int, filter models.EventFilter) (*models.EventPage, error) {
+	// Find past events for society, but also not including events that ended at most an hour ago
+	page, err := ds.findEvents(ctx,
+		bson.M{
+			"end_datetime": bson.M{
+				"$lt": upcomingCutoff(),
+			},
+			"society_id": socID,
+		}, filter)
 	if err != nil {
-		log.WithField("error", err).Warn("Failed to use cursor to find all documents in events collection")
+		logging.FromContext(ctx).WithFields(log.Fields{"error": err, "socID": socID}).Warn("Failed to find all documents for society that are passed in events collection")
 		return nil, err
 	}
 
-	return events, nil
+	return page, nil
+}
+
+// eventFilterConditions translates filter into conditions on the events
+// collection, not including the pagination cursor
+func eventFilterConditions(filter models.EventFilter) bson.A {
+	conditions := bson.A{}
+	if !filter.From.IsZero() {
+		conditions = append(conditions, bson.M{"end_datetime": bson.M{"$gte": filter.From}})
+	}
+	if !filter.To.IsZero() {
+		conditions = append(conditions, bson.M{"start_datetime": bson.M{"$lte": filter.To}})
+	}
+	if len(filter.SocietyIDs) > 0 {
+		conditions = append(conditions, bson.M{"society_id": bson.M{"$in": filter.SocietyIDs}})
+	}
+	if len(filter.LocationTypes) > 0 {
+		conditions = append(conditions, bson.M{"location_type": bson.M{"$in": filter.LocationTypes}})
+	}
+	if len(filter.EventTypes) > 0 {
+		conditions = append(conditions, bson.M{"event_type": bson.M{"$in": filter.EventTypes}})
+	}
+	return conditions
+}
+
+// eventCursorCondition matches events ordered strictly after the cursor
+func eventCursorCondition(cursor models.EventCursor, descending bool) bson.M {
+	return afterCondition(bson.D{
+		{Key: "start_datetime", Value: cursor.StartDatetime},
+		{Key: "event_details_id", Value: cursor.EventDetailsID},
+		{Key: "event_id", Value: cursor.EventID},
+	}, descending)
 }
 
-func (ds *MongoDatastore) GetAllUpcomingEvents() ([]models.DatabaseEvent, error) {
-	var ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
+// afterCondition matches documents ordered strictly after the one described
+// by keys, which are the fields sorted on in order with that document's values
+func afterCondition(keys bson.D, descending bool) bson.M {
+	op := "$gt"
+	if descending {
+		op = "$lt"
+	}
+
+	clauses := bson.A{}
+	for i, key := range keys {
+		clause := bson.M{}
+		for _, equal := range keys[:i] {
+			clause[equal.Key] = equal.Value
+		}
+		clause[key.Key] = bson.M{op: key.Value}
+		clauses = append(clauses, clause)
+	}
+
+	return bson.M{"$or": clauses}
+}
+
+// findEvents returns a page of events matching both condition and filter,
+// along with the total number of matching events across all pages
+func (ds *MongoDatastore) findEvents(ctx context.Context, condition bson.M, filter models.EventFilter) (*models.EventPage, error) {
+	ctx, cancel := context.WithTimeout(ctx, ds.queryTimeout)
 	defer cancel()
 
-	// Find upcoming events, but also include events that ended at most an hour ago
-	cursor, err := ds.db.Collection("events").Find(ctx, bson.M{"end_datetime": bson.M{
-		"$gte": time.Now().UTC().Add(time.Hour).Format(time.RFC3339),
-	}})
+	conditions := append(bson.A{condition}, eventFilterConditions(filter)...)
+	total, err := ds.db.Collection("events").CountDocuments(ctx, bson.M{"$and": conditions})
+	if err != nil {
+		return nil, err
+	}
+
+	if filter.After != nil {
+		conditions = append(conditions, eventCursorCondition(*filter.After, filter.Descending))
+	}
+
+	order := 1
+	if filter.Descending {
+		order = -1
+	}
+	opts := options.Find().SetSort(bson.D{
+		{Key: "start_datetime", Value: order},
+		{Key: "event_details_id", Value: order},
+		{Key: "event_id", Value: order},
+	})
+	if filter.Limit > 0 {
+		// Fetch one extra so we know whether there's another page
+		opts.SetLimit(filter.Limit + 1)
+	}
+
+	cursor, err := ds.db.Collection("events").Find(ctx, bson.M{"$and": conditions}, opts)
 	if err != nil {
-		log.WithField("error", err).Warn("Failed to return cursor to find all documents that are upcoming in events collection")
 		return nil, err
 	}
 
 	events := []models.DatabaseEvent{}
 	err = cursor.All(ctx, &events)
 	if err != nil {
-		log.WithField("error", err).Warn("Failed to use cursor to find all documents that are upcoming in events collection")
 		return nil, err
 	}
 
-	return events, nil
+	page := &models.EventPage{Total: total}
+	if filter.Limit > 0 && int64(len(events)) > filter.Limit {
+		events = events[:filter.Limit]
+		page.NextCursor = events[len(events)-1].CursorAfter().Encode()
+	}
+	page.Events = inEventLocation(events)
+
+	return page, nil
 }
 
-func (ds *MongoDatastore) GetAllPastEvents() ([]models.DatabaseEvent, error) {
-	var ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
+// SearchEvents runs a full-text search over events, narrowed down by filter.
+// Results are ranked by relevance, most relevant first, with ties going to
+// the most recent event.
+func (ds *MongoDatastore) SearchEvents(ctx context.Context, query string, filter models.EventFilter) (*models.EventSearchPage, error) {
+	ctx, cancel := context.WithTimeout(ctx, ds.queryTimeout)
 	defer cancel()
 
-	// Find past events, but also not including events that ended at most an hour ago
-	cursor, err := ds.db.Collection("events").Find(ctx, bson.M{"end_datetime": bson.M{
-		"$lt": time.Now().UTC().Add(-time.Hour).Format(time.RFC3339),
+	match := bson.M{"$text": bson.M{"$search": query}}
+	if conditions := eventFilterConditions(filter); len(conditions) > 0 {
+		match["$and"] = conditions
+	}
+
+	// Counted on its own, funnelling every result into a single document to
+	// count them alongside the page could outgrow Mongo's document size limit
+	total, err := ds.db.Collection("events").CountDocuments(ctx, match)
+	if err != nil {
+		logging.FromContext(ctx).WithFields(log.Fields{"error": err, "query": query}).Warn("Failed to count search results in events collection")
+		return nil, err
+	}
+
+	pipeline := bson.A{
+		bson.M{"$match": match},
+		bson.M{"$addFields": bson.M{"score": bson.M{"$meta": "textScore"}}},
+	}
+	if filter.After != nil {
+		pipeline = append(pipeline, bson.M{"$match": afterCondition(bson.D{
+			{Key: "score", Value: filter.After.Score},
+			{Key: "start_datetime", Value: filter.After.StartDatetime},
+			{Key: "event_details_id", Value: filter.After.EventDetailsID},
+			{Key: "event_id", Value: filter.After.EventID},
+		}, true)})
+	}
+	pipeline = append(pipeline, bson.M{"$sort": bson.D{
+		{Key: "score", Value: -1},
+		{Key: "start_datetime", Value: -1},
+		{Key: "event_details_id", Value: -1},
+		{Key: "event_id", Value: -1},
 	}})
+	if filter.Limit > 0 {
+		// Fetch one extra so we know whether there's another page
+		pipeline = append(pipeline, bson.M{"$limit": filter.Limit + 1})
+	}
+
+	cursor, err := ds.db.Collection("events").Aggregate(ctx, pipeline)
 	if err != nil {
-		log.WithField("error", err).Warn("Failed to return cursor to find all documents that are past in events collection")
+		logging.FromContext(ctx).WithFields(log.Fields{"error": err, "query": query}).Warn("Failed to search events collection")
 		return nil, err
 	}
 
-	events := []models.DatabaseEvent{}
-	err = cursor.All(ctx, &events)
+	results := []models.EventSearchResult{}
+	err = cursor.All(ctx, &results)
 	if err != nil {
-		log.WithField("error", err).Warn("Failed to use cursor to find all documents that are past in events collection")
+		logging.FromContext(ctx).WithFields(log.Fields{"error": err, "query": query}).Warn("Failed to use cursor to search events collection")
 		return nil, err
 	}
 
-	return events, nil
+	page := &models.EventSearchPage{Results: results, Total: total}
+	if filter.Limit > 0 && int64(len(page.Results)) > filter.Limit {
+		page.Results = page.Results[:filter.Limit]
+		page.NextCursor = page.Results[len(page.Results)-1].CursorAfter().Encode()
+	}
+
+	pattern := models.SearchTermsPattern(query)
+	for i := range page.Results {
+		page.Results[i].DatabaseEvent = page.Results[i].InEventLocation()
+		page.Results[i].Highlight(pattern)
+	}
+
+	return page, nil
 }
 
-// TODO Theres a bug in here somewhere relating to recent (within an hour) events not showing up
-func (ds *MongoDatastore) GetAllUpcomingEventsForSocID(socID int) ([]models.DatabaseEvent, error) {
-	var ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
+// GetEventByEventDetailsID returns the event with the given eventDetailsID.
+// Recurring events share their details between instances, so we prefer the
+// next instance that hasn't finished yet and fall back to the most recent one.
+func (ds *MongoDatastore) GetEventByEventDetailsID(ctx context.Context, eventDetailsID int) (*models.DatabaseEvent, error) {
+	ctx, cancel := context.WithTimeout(ctx, ds.queryTimeout)
 	defer cancel()
 
-	// Find upcoming events for society, but also include events that ended at most an hour ago
-	cursor, err := ds.db.Collection("events").Find(ctx,
+	var event models.DatabaseEvent
+	err := ds.db.Collection("events").FindOne(ctx,
 		bson.M{
+			"event_details_id": eventDetailsID,
 			"end_datetime": bson.M{
-				"$gte": time.Now().UTC().Add(time.Hour).Format(time.RFC3339),
+				"$gte": upcomingCutoff(),
 			},
-			"society_id": socID,
-		})
+		},
+		options.FindOne().SetSort(bson.D{{Key: "start_datetime", Value: 1}}),
+	).Decode(&event)
+	if err == mongo.ErrNoDocuments {
+		err = ds.db.Collection("events").FindOne(ctx,
+			bson.M{"event_details_id": eventDetailsID},
+			options.FindOne().SetSort(bson.D{{Key: "start_datetime", Value: -1}}),
+		).Decode(&event)
+	}
+	if err == mongo.ErrNoDocuments {
+		return nil, models.ErrNotFound
+	}
 	if err != nil {
-		log.WithFields(log.Fields{"error": err, "socID": socID}).Warn("Failed to return cursor to find all documents for society that are upcoming in events collection")
+		logging.FromContext(ctx).WithFields(log.Fields{"error": err, "eventDetailsID": eventDetailsID}).Warn("Failed to return single event from events collection")
 		return nil, err
 	}
 
-	events := []models.DatabaseEvent{}
-	err = cursor.All(ctx, &events)
+	event = event.InEventLocation()
+	return &event, nil
+}
+
+// GetEventByEventID returns a single instance of a (possibly recurring) event
+func (ds *MongoDatastore) GetEventByEventID(ctx context.Context, eventDetailsID int, eventID int) (*models.DatabaseEvent, error) {
+	ctx, cancel := context.WithTimeout(ctx, ds.queryTimeout)
+	defer cancel()
+
+	var event models.DatabaseEvent
+	err := ds.db.Collection("events").FindOne(ctx,
+		bson.M{"event_details_id": eventDetailsID, "event_id": eventID}).Decode(&event)
+	if err == mongo.ErrNoDocuments {
+		return nil, models.ErrNotFound
+	}
 	if err != nil {
-		log.WithFields(log.Fields{"error": err, "socID": socID}).Warn("Failed to use cursor to find all documents for society that are upcoming in events collection")
+		logging.FromContext(ctx).WithFields(log.Fields{"error": err, "eventDetailsID": eventDetailsID, "eventID": eventID}).Warn("Failed to return single event from events collection")
 		return nil, err
 	}
 
-	return events, nil
+	event = event.InEventLocation()
+	return &event, nil
+}
+
+// inEventLocation converts the datetimes of events read from the database,
+// which Mongo always gives back in UTC, into the portal's timezone
+func inEventLocation(events []models.DatabaseEvent) []models.DatabaseEvent {
+	for i := range events {
+		events[i] = events[i].InEventLocation()
+	}
+	return events
 }
 
-func (ds *MongoDatastore) GetAllPastEventsForSocID(socID int) ([]models.DatabaseEvent, error) {
-	var ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
+/*
+ *	Stats
+ */
+
+// A group in a stats aggregation, keyed by _id
+type statsGroup struct {
+	Key      string  `bson:"_id"`
+	Events   int     `bson:"events"`
+	Upcoming int     `bson:"upcoming"`
+	Duration float64 `bson:"duration"`
+}
+
+// Matches the events stats are taken from, leaving out cancelled ones as
+// models.DatabaseEvent.Cancelled does
+func statsMatch(filter models.EventFilter) bson.M {
+	conditions := append(eventFilterConditions(filter),
+		bson.M{"status": bson.M{"$not": primitive.Regex{Pattern: "cancel", Options: "i"}}})
+	return bson.M{"$and": conditions}
+}
+
+// Accumulators every stats group has: how many events there are, how many of
+// them are upcoming, and their average duration in milliseconds
+func statsAccumulators(cutoff time.Time, extra bson.M) bson.M {
+	accumulators := bson.M{
+		"events":   bson.M{"$sum": 1},
+		"upcoming": bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$gte": bson.A{"$end_datetime", cutoff}}, 1, 0}}},
+		"duration": bson.M{"$avg": bson.M{"$subtract": bson.A{"$end_datetime", "$start_datetime"}}},
+	}
+	for key, value := range extra {
+		accumulators[key] = value
+	}
+	return accumulators
+}
+
+func (ds *MongoDatastore) GetSocietyStats(ctx context.Context, socID int, filter models.EventFilter) (*models.SocietyStats, error) {
+	ctx, cancel := context.WithTimeout(ctx, ds.queryTimeout)
 	defer cancel()
 
-	// Find past events for society, but also not including events that ended at most an hour ago
-	cursor, err := ds.db.Collection("events").Find(ctx,
-		bson.M{
-			"end_datetime": bson.M{
-				"$lt": time.Now().UTC().Add(-time.Hour).Format(time.RFC3339),
-			},
-			"society_id": socID,
-		})
+	filter.SocietyIDs = []int{socID}
+	cutoff := upcomingCutoff()
+	timezone := models.EventLocation.String()
+	groupBy := func(key interface{}) bson.A {
+		return bson.A{bson.M{"$group": statsAccumulators(cutoff, bson.M{"_id": key})}}
+	}
+
+	cursor, err := ds.db.Collection("events").Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: statsMatch(filter)}},
+		{{Key: "$facet", Value: bson.M{
+			"totals": groupBy(nil),
+			"months": groupBy(bson.M{"$dateToString": bson.M{"format": "%Y-%m", "date": "$start_datetime", "timezone": timezone}}),
+			// $dayOfWeek counts from 1 for Sunday
+			"weekdays":       groupBy(bson.M{"$dayOfWeek": bson.M{"date": "$start_datetime", "timezone": timezone}}),
+			"types":          groupBy("$event_type"),
+			"location_types": groupBy("$location_type"),
+		}}},
+	})
 	if err != nil {
-		log.WithFields(log.Fields{"error": err, "socID": socID}).Warn("Failed to return cursor to find all documents for society that are passed in events collection")
+		logging.FromContext(ctx).WithFields(log.Fields{"error": err, "socID": socID}).Warn("Failed to aggregate society stats in events collection")
 		return nil, err
 	}
 
-	events := []models.DatabaseEvent{}
-	err = cursor.All(ctx, &events)
+	facets := []struct {
+		Totals   []statsGroup `bson:"totals"`
+		Months   []statsGroup `bson:"months"`
+		Weekdays []struct {
+			Day    int `bson:"_id"`
+			Events int `bson:"events"`
+		} `bson:"weekdays"`
+		Types         []statsGroup `bson:"types"`
+		LocationTypes []statsGroup `bson:"location_types"`
+	}{}
+	if err := cursor.All(ctx, &facets); err != nil {
+		logging.FromContext(ctx).WithFields(log.Fields{"error": err, "socID": socID}).Warn("Failed to decode society stats")
+		return nil, err
+	}
+
+	stats := newSocietyStats(socID)
+	if len(facets) == 0 || len(facets[0].Totals) == 0 {
+		return stats, nil
+	}
+	result := facets[0]
+
+	stats.Events = result.Totals[0].Events
+	stats.UpcomingEvents = result.Totals[0].Upcoming
+	stats.AverageDurationMinutes = result.Totals[0].Duration / float64(time.Minute/time.Millisecond)
+
+	months := map[string]int{}
+	for _, group := range result.Months {
+		months[group.Key] = group.Events
+	}
+	stats.EventsPerMonth = monthCounts(months)
+
+	weekdays := map[time.Weekday]int{}
+	for _, group := range result.Weekdays {
+		weekdays[time.Weekday(group.Day-1)] = group.Events
+	}
+	stats.BusiestWeekday = busiestWeekday(weekdays)
+
+	for _, group := range result.Types {
+		stats.EventsPerType[group.Key] = group.Events
+	}
+	for _, group := range result.LocationTypes {
+		stats.EventsPerLocationType[group.Key] = group.Events
+	}
+
+	return stats, nil
+}
+
+func (ds *MongoDatastore) GetSocietyLeaderboard(ctx context.Context, filter models.EventFilter) ([]models.SocietyRanking, error) {
+	ctx, cancel := context.WithTimeout(ctx, ds.queryTimeout)
+	defer cancel()
+
+	cursor, err := ds.db.Collection("events").Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: statsMatch(filter)}},
+		// Societies are named as they were on their most recent event
+		{{Key: "$sort", Value: bson.D{{Key: "start_datetime", Value: 1}}}},
+		{{Key: "$group", Value: statsAccumulators(upcomingCutoff(), bson.M{
+			"_id":  "$society_id",
+			"name": bson.M{"$last": "$society_name"},
+		})}},
+	})
 	if err != nil {
-		log.WithFields(log.Fields{"error": err, "socID": socID}).Warn("Failed to use cursor to find all documents for society that are passed in events collection")
+		logging.FromContext(ctx).WithField("error", err).Warn("Failed to aggregate the society leaderboard in events collection")
 		return nil, err
 	}
 
-	return events, nil
+	groups := []struct {
+		SocietyID int     `bson:"_id"`
+		Name      string  `bson:"name"`
+		Events    int     `bson:"events"`
+		Upcoming  int     `bson:"upcoming"`
+		Duration  float64 `bson:"duration"`
+	}{}
+	if err := cursor.All(ctx, &groups); err != nil {
+		logging.FromContext(ctx).WithField("error", err).Warn("Failed to decode the society leaderboard")
+		return nil, err
+	}
+
+	rankings := []models.SocietyRanking{}
+	for _, group := range groups {
+		rankings = append(rankings, models.SocietyRanking{
+			SocietyID:              group.SocietyID,
+			SocietyName:            group.Name,
+			Events:                 group.Events,
+			UpcomingEvents:         group.Upcoming,
+			AverageDurationMinutes: group.Duration / float64(time.Minute/time.Millisecond),
+		})
+	}
+
+	return rankSocieties(rankings, filter.Limit), nil
 }
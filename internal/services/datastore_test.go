@@ -0,0 +1,751 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nuigcompsoc/api/internal/config"
+	"github.com/nuigcompsoc/api/internal/models"
+	log "github.com/sirupsen/logrus"
+)
+
+func TestMain(m *testing.M) {
+	// Upsert logs drown out test failures
+	log.SetLevel(log.WarnLevel)
+	os.Exit(m.Run())
+}
+
+// Every Datastore we can reach. Memory and SQLite always run, Mongo and
+// PostgreSQL only when TEST_MONGO_URI or TEST_POSTGRES_DSN point at a
+// database the tests may empty.
+func testDatastores(t *testing.T) map[string]func(t *testing.T) Datastore {
+	t.Helper()
+
+	datastores := map[string]func(t *testing.T) Datastore{
+		"memory": func(t *testing.T) Datastore {
+			return NewMemoryDatastore()
+		},
+		"sqlite": func(t *testing.T) Datastore {
+			ds, err := NewSQLDatastore(context.Background(), DriverSQLite, ":memory:", 0)
+			if err != nil {
+				t.Fatalf("failed to open SQLite: %v", err)
+			}
+			if err := ds.Migrate(context.Background()); err != nil {
+				t.Fatalf("failed to migrate SQLite: %v", err)
+			}
+			t.Cleanup(func() { ds.Close(context.Background()) })
+			return ds
+		},
+	}
+
+	if dsn := os.Getenv("TEST_POSTGRES_DSN"); dsn != "" {
+		datastores["postgres"] = func(t *testing.T) Datastore {
+			ds, err := NewSQLDatastore(context.Background(), DriverPostgres, dsn, 0)
+			if err != nil {
+				t.Fatalf("failed to open PostgreSQL: %v", err)
+			}
+			if err := ds.Migrate(context.Background()); err != nil {
+				t.Fatalf("failed to migrate PostgreSQL: %v", err)
+			}
+			if _, err := ds.db.Exec(`DELETE FROM events; DELETE FROM societies; DELETE FROM society_proposals; DELETE FROM society_audit; DELETE FROM job_runs; DELETE FROM locks`); err != nil {
+				t.Fatalf("failed to empty PostgreSQL: %v", err)
+			}
+			t.Cleanup(func() { ds.Close(context.Background()) })
+			return ds
+		}
+	}
+
+	if uri := os.Getenv("TEST_MONGO_URI"); uri != "" {
+		datastores["mongo"] = func(t *testing.T) Datastore {
+			cfg := &config.Config{}
+			cfg.Database.Host = uri
+			cfg.Database.Name = "api_test"
+			cfg.Timeouts.Startup = 10 * time.Second
+			ds := NewDatastore(cfg)
+			ctx := context.Background()
+			if err := ds.db.Drop(ctx); err != nil {
+				t.Fatalf("failed to empty Mongo: %v", err)
+			}
+			if err := ds.Migrate(ctx); err != nil {
+				t.Fatalf("failed to migrate Mongo: %v", err)
+			}
+			t.Cleanup(func() { ds.Session.Disconnect(ctx) })
+			return ds
+		}
+	}
+
+	return datastores
+}
+
+// Events relative to now, so the upcoming/past split is the same whenever the
+// tests run. Weekly Talks (104) recurs, with one instance either side of now.
+func testEvents(now time.Time) []models.DatabaseEvent {
+	event := func(eventID int, eventDetailsID int, socID int, title string, eventType string, start time.Duration, end time.Duration) models.DatabaseEvent {
+		return models.DatabaseEvent{
+			EventID:             eventID,
+			EventDetailsID:      eventDetailsID,
+			Title:               title,
+			SocietyID:           socID,
+			EventType:           eventType,
+			LocationType:        "On Campus",
+			DescriptionMarkdown: title,
+			StartDatetime:       now.Add(start),
+			EndDatetime:         now.Add(end),
+			Status:              "Active",
+		}
+	}
+
+	return []models.DatabaseEvent{
+		event(1, 101, 30, "Intro to Go Workshop", "Workshop", -72*time.Hour, -70*time.Hour),
+		event(2, 102, 30, "Game Night", "Social", 48*time.Hour, 52*time.Hour),
+		event(3, 103, 31, "Chess Tournament", "Social", 24*time.Hour, 28*time.Hour),
+		event(4, 104, 30, "Weekly Talks", "Talk", -168*time.Hour, -167*time.Hour),
+		event(5, 104, 30, "Weekly Talks", "Talk", 168*time.Hour, 169*time.Hour),
+		// Ended half an hour ago, so still upcoming
+		event(6, 105, 31, "Chess Lessons", "Other", -90*time.Minute, -30*time.Minute),
+	}
+}
+
+func eventIDs(events []models.DatabaseEvent) []int {
+	ids := []int{}
+	for _, event := range events {
+		ids = append(ids, event.EventID)
+	}
+	return ids
+}
+
+func TestDatastoreEvents(t *testing.T) {
+	for name, open := range testDatastores(t) {
+		t.Run(name, func(t *testing.T) {
+			ds := open(t)
+			ctx := context.Background()
+			if err := ds.UpsertEvents(ctx, testEvents(time.Now().Truncate(time.Second))); err != nil {
+				t.Fatalf("failed to store test events: %v", err)
+			}
+
+			queries := []struct {
+				name  string
+				query func(filter models.EventFilter) (*models.EventPage, error)
+				// The events expected in order, ascending
+				eventIDs []int
+			}{
+				{"all", func(f models.EventFilter) (*models.EventPage, error) { return ds.GetAllEvents(ctx, f) }, []int{4, 1, 6, 3, 2, 5}},
+				{"upcoming", func(f models.EventFilter) (*models.EventPage, error) { return ds.GetAllUpcomingEvents(ctx, f) }, []int{6, 3, 2, 5}},
+				{"past", func(f models.EventFilter) (*models.EventPage, error) { return ds.GetAllPastEvents(ctx, f) }, []int{4, 1}},
+				{"upcoming for society", func(f models.EventFilter) (*models.EventPage, error) {
+					return ds.GetAllUpcomingEventsForSocID(ctx, 30, f)
+				}, []int{2, 5}},
+				{"past for society", func(f models.EventFilter) (*models.EventPage, error) { return ds.GetAllPastEventsForSocID(ctx, 31, f) }, []int{}},
+			}
+			for _, q := range queries {
+				page, err := q.query(models.EventFilter{})
+				if err != nil {
+					t.Fatalf("%v: %v", q.name, err)
+				}
+				if ids := eventIDs(page.Events); !reflect.DeepEqual(ids, q.eventIDs) || page.Total != int64(len(q.eventIDs)) {
+					t.Errorf("%v: got events %v of %v, want %v", q.name, ids, page.Total, q.eventIDs)
+				}
+
+				// Walking the pages backwards gives the same events reversed
+				ids := []int{}
+				filter := models.EventFilter{Descending: true, Limit: 2}
+				for {
+					page, err := q.query(filter)
+					if err != nil {
+						t.Fatalf("%v: %v", q.name, err)
+					}
+					ids = append(ids, eventIDs(page.Events)...)
+					if page.NextCursor == "" {
+						break
+					}
+					cursor, err := models.ParseEventCursor(page.NextCursor)
+					if err != nil {
+						t.Fatalf("%v: bad cursor: %v", q.name, err)
+					}
+					filter.After = cursor
+				}
+				for i, j := 0, len(ids)-1; i < j; i, j = i+1, j-1 {
+					ids[i], ids[j] = ids[j], ids[i]
+				}
+				if !reflect.DeepEqual(ids, q.eventIDs) {
+					t.Errorf("%v: got pages of %v, want %v", q.name, ids, q.eventIDs)
+				}
+			}
+
+			page, err := ds.GetAllEvents(ctx, models.EventFilter{
+				From:       time.Now().Add(time.Hour),
+				To:         time.Now().Add(72 * time.Hour),
+				EventTypes: []string{"Social", "Talk"},
+				SocietyIDs: []int{30, 31},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ids := eventIDs(page.Events); !reflect.DeepEqual(ids, []int{3, 2}) {
+				t.Errorf("filtered events: got %v, want [3 2]", ids)
+			}
+
+			search, err := ds.SearchEvents(ctx, "chess", models.EventFilter{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			found := map[int]bool{}
+			for _, result := range search.Results {
+				found[result.EventID] = true
+			}
+			if !reflect.DeepEqual(found, map[int]bool{3: true, 6: true}) || search.Total != 2 {
+				t.Errorf("search for chess: got %v of %v, want 3 and 6", found, search.Total)
+			}
+		})
+	}
+}
+
+func TestDatastoreEvent(t *testing.T) {
+	for name, open := range testDatastores(t) {
+		t.Run(name, func(t *testing.T) {
+			ds := open(t)
+			ctx := context.Background()
+			now := time.Now().Truncate(time.Second)
+			if err := ds.UpsertEvents(ctx, testEvents(now)); err != nil {
+				t.Fatalf("failed to store test events: %v", err)
+			}
+
+			event, err := ds.GetEventByEventDetailsID(ctx, 104)
+			if err != nil || event.EventID != 5 {
+				t.Errorf("recurring event: got %+v, %v, want the upcoming instance 5", event, err)
+			}
+			event, err = ds.GetEventByEventID(ctx, 104, 4)
+			if err != nil || event.EventID != 4 || !event.StartDatetime.Equal(now.Add(-168*time.Hour)) {
+				t.Errorf("event by ID: got %+v, %v", event, err)
+			}
+			if event != nil && event.StartDatetime.Location() != models.EventLocation {
+				t.Errorf("event datetimes are in %v, want %v", event.StartDatetime.Location(), models.EventLocation)
+			}
+
+			if _, err := ds.GetEventByEventDetailsID(ctx, 999); !errors.Is(err, models.ErrNotFound) {
+				t.Errorf("missing event: got %v, want ErrNotFound", err)
+			}
+			if _, err := ds.GetEventByEventID(ctx, 104, 999); !errors.Is(err, models.ErrNotFound) {
+				t.Errorf("missing event instance: got %v, want ErrNotFound", err)
+			}
+
+			// Syncing an event again only bumps its sequence if it changed
+			events := testEvents(now)
+			if err := ds.UpsertEvents(ctx, events); err != nil {
+				t.Fatal(err)
+			}
+			event, _ = ds.GetEventByEventID(ctx, 102, 2)
+			if event == nil || event.Sequence != 0 {
+				t.Errorf("unchanged event: got %+v, want sequence 0", event)
+			}
+			events[1].Title = "Board Game Night"
+			if err := ds.UpsertEvents(ctx, events); err != nil {
+				t.Fatal(err)
+			}
+			event, _ = ds.GetEventByEventID(ctx, 102, 2)
+			if event == nil || event.Sequence != 1 || event.Title != "Board Game Night" {
+				t.Errorf("changed event: got %+v, want sequence 1", event)
+			}
+		})
+	}
+}
+
+func TestDatastoreSocieties(t *testing.T) {
+	for name, open := range testDatastores(t) {
+		t.Run(name, func(t *testing.T) {
+			ds := open(t)
+			ctx := context.Background()
+
+			for _, upsert := range []struct {
+				society models.Society
+				changed bool
+			}{
+				{models.Society{Name: "CompSoc", SocietiesPortalID: 30}, true},
+				{models.Society{Name: "ChessSoc", SocietiesPortalID: 31}, true},
+				{models.Society{Name: "CompSoc", SocietiesPortalID: 32}, true},
+				{models.Society{Name: "CompSoc", SocietiesPortalID: 32}, false},
+			} {
+				changed, err := ds.UpsertSociety(ctx, upsert.society, "sync")
+				if err != nil {
+					t.Fatalf("failed to store %v: %v", upsert.society.Name, err)
+				}
+				if changed != upsert.changed {
+					t.Errorf("storing %+v: changed is %v, want %v", upsert.society, changed, upsert.changed)
+				}
+			}
+			if _, err := ds.UpsertSociety(ctx, models.Society{Name: "Chess", SocietiesPortalID: 31}, "sync"); !errors.Is(err, models.ErrConflict) {
+				t.Errorf("upsert with a taken ID: got %v, want ErrConflict", err)
+			}
+
+			societies, err := ds.GetAllSocieties(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := map[string]models.Society{
+				"CompSoc":  {Name: "CompSoc", SocietiesPortalID: 32},
+				"ChessSoc": {Name: "ChessSoc", SocietiesPortalID: 31},
+			}
+			if !reflect.DeepEqual(societies, want) {
+				t.Errorf("got societies %+v, want %+v", societies, want)
+			}
+
+			society, err := ds.GetSocietyBySocietyName(ctx, "ChessSoc")
+			if err != nil || society.SocietiesPortalID != 31 {
+				t.Errorf("society by name: got %+v, %v", society, err)
+			}
+			if _, err := ds.GetSocietyBySocietyName(ctx, "NoSoc"); !errors.Is(err, models.ErrNotFound) {
+				t.Errorf("missing society: got %v, want ErrNotFound", err)
+			}
+
+			// Syncing from the portal leaves the directory's metadata alone
+			dramaSoc := models.Society{
+				Name:              "DramaSoc",
+				SocietiesPortalID: 33,
+				Slug:              "dramasoc",
+				SocialLinks:       map[string]string{"instagram": "https://instagram.com/dramasoc"},
+			}
+			if err := ds.CreateSociety(ctx, dramaSoc, "tester"); err != nil {
+				t.Fatalf("create: %v", err)
+			}
+			if changed, err := ds.UpsertSociety(ctx, models.Society{Name: "DramaSoc", SocietiesPortalID: 33}, "sync"); err != nil || changed {
+				t.Errorf("syncing an unchanged society: got %v, %v", changed, err)
+			}
+			society, err = ds.GetSocietyBySocietiesPortalID(ctx, 33)
+			if err != nil || !reflect.DeepEqual(*society, dramaSoc) {
+				t.Errorf("society by portal ID: got %+v, %v, want %+v", society, err, dramaSoc)
+			}
+
+			for _, conflicting := range []models.Society{
+				{Name: "DramaSoc", SocietiesPortalID: 34},
+				{Name: "Drama", SocietiesPortalID: 31},
+			} {
+				if err := ds.CreateSociety(ctx, conflicting, "tester"); !errors.Is(err, models.ErrConflict) {
+					t.Errorf("create %+v: got %v, want ErrConflict", conflicting, err)
+				}
+			}
+			if _, err := ds.UpdateSociety(ctx, 33, models.Society{Name: "ChessSoc", SocietiesPortalID: 33}, "tester"); !errors.Is(err, models.ErrConflict) {
+				t.Errorf("rename to a taken name: got %v, want ErrConflict", err)
+			}
+			if _, err := ds.UpdateSociety(ctx, 99, models.Society{Name: "NoSoc", SocietiesPortalID: 99}, "tester"); !errors.Is(err, models.ErrNotFound) {
+				t.Errorf("update missing: got %v, want ErrNotFound", err)
+			}
+			if changed, err := ds.UpdateSociety(ctx, 33, dramaSoc, "tester"); err != nil || changed {
+				t.Errorf("update with what's stored: got %v, %v", changed, err)
+			}
+
+			changed, err := ds.UpdateSociety(ctx, 33, models.Society{Name: "Drama Society", SocietiesPortalID: 35}, "tester")
+			if err != nil || !changed {
+				t.Fatalf("update: got %v, %v", changed, err)
+			}
+			if _, err := ds.GetSocietyBySocietyName(ctx, "DramaSoc"); !errors.Is(err, models.ErrNotFound) {
+				t.Errorf("renamed society still found by its old name: %v", err)
+			}
+			society, err = ds.GetSocietyBySocietiesPortalID(ctx, 35)
+			if err != nil || society.Name != "Drama Society" || society.Slug != "" {
+				t.Errorf("updated society: got %+v, %v", society, err)
+			}
+
+			if err := ds.DeleteSociety(ctx, 35, "tester"); err != nil {
+				t.Fatalf("delete: %v", err)
+			}
+			if err := ds.DeleteSociety(ctx, 35, "tester"); !errors.Is(err, models.ErrNotFound) {
+				t.Errorf("delete missing: got %v, want ErrNotFound", err)
+			}
+			if societies, _ := ds.GetAllSocieties(ctx); len(societies) != 2 {
+				t.Errorf("got %v societies after deleting, want 2", len(societies))
+			}
+
+			// Entries are kept under the portal ID after each change
+			for socID, want := range map[int32][]string{
+				30: {"sync created Name,SocietiesPortalID"},
+				32: {"sync updated SocietiesPortalID"},
+				33: {"tester created Name,SocietiesPortalID,Slug,SocialLinks"},
+				35: {
+					"tester deleted Name,SocietiesPortalID",
+					"tester updated Name,SocietiesPortalID,Slug,SocialLinks",
+				},
+				99: {},
+			} {
+				entries, err := ds.GetSocietyAudit(ctx, socID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got := []string{}
+				for _, entry := range entries {
+					got = append(got, entry.Actor+" "+entry.Action+" "+strings.Join(entry.Changes, ","))
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("audit of %v: got %q, want %q", socID, got, want)
+				}
+			}
+
+			entries, _ := ds.GetSocietyAudit(ctx, 35)
+			if len(entries) == 2 && (entries[1].Before == nil || !reflect.DeepEqual(*entries[1].Before, dramaSoc) || entries[1].After == nil || entries[0].After != nil) {
+				t.Errorf("audit of the update and deletion: got %+v", entries)
+			}
+		})
+	}
+}
+
+func TestDatastoreSocietyProposals(t *testing.T) {
+	for name, open := range testDatastores(t) {
+		t.Run(name, func(t *testing.T) {
+			ds := open(t)
+			ctx := context.Background()
+			firstSeen := time.Date(2022, 9, 7, 12, 0, 0, 0, time.UTC)
+			lastSeen := firstSeen.AddDate(0, 0, 1)
+
+			if err := ds.UpsertSocietyProposals(ctx, []models.SocietyProposal{
+				{SocietiesPortalID: 40, Name: "Drama", EventCount: 1, FirstSeen: firstSeen, LastSeen: firstSeen, Status: models.ProposalPending},
+				{SocietiesPortalID: 41, Name: "Chess", EventCount: 2, FirstSeen: firstSeen, LastSeen: firstSeen, Status: models.ProposalPending},
+			}); err != nil {
+				t.Fatal(err)
+			}
+			if err := ds.DecideSocietyProposal(ctx, 41, models.ProposalRejected, "tester"); err != nil {
+				t.Fatal(err)
+			}
+
+			// Seeing a proposal again refreshes it without undoing its decision
+			if err := ds.UpsertSocietyProposals(ctx, []models.SocietyProposal{
+				{SocietiesPortalID: 40, Name: "DramaSoc", EventCount: 3, FirstSeen: lastSeen, LastSeen: lastSeen, Status: models.ProposalPending},
+				{SocietiesPortalID: 41, Name: "ChessSoc", EventCount: 4, FirstSeen: lastSeen, LastSeen: lastSeen, Status: models.ProposalPending},
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			proposal, err := ds.GetSocietyProposal(ctx, 40)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if proposal.Name != "DramaSoc" || proposal.EventCount != 3 || !proposal.FirstSeen.Equal(firstSeen) || !proposal.LastSeen.Equal(lastSeen) || proposal.Status != models.ProposalPending {
+				t.Errorf("refreshed proposal is %+v", proposal)
+			}
+
+			proposal, err = ds.GetSocietyProposal(ctx, 41)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if proposal.Name != "ChessSoc" || proposal.Status != models.ProposalRejected || proposal.DecidedBy != "tester" || proposal.DecidedAt == nil {
+				t.Errorf("decided proposal is %+v", proposal)
+			}
+
+			for status, want := range map[string][]int32{
+				"":                      {41, 40},
+				models.ProposalPending:  {40},
+				models.ProposalRejected: {41},
+				models.ProposalApproved: {},
+			} {
+				proposals, err := ds.GetSocietyProposals(ctx, status)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got := []int32{}
+				for _, proposal := range proposals {
+					got = append(got, proposal.SocietiesPortalID)
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("proposals with status %q: got %v, want %v", status, got, want)
+				}
+			}
+
+			if _, err := ds.GetSocietyProposal(ctx, 99); !errors.Is(err, models.ErrNotFound) {
+				t.Errorf("missing proposal: got %v, want ErrNotFound", err)
+			}
+			if err := ds.DecideSocietyProposal(ctx, 99, models.ProposalApproved, "tester"); !errors.Is(err, models.ErrNotFound) {
+				t.Errorf("deciding a missing proposal: got %v, want ErrNotFound", err)
+			}
+		})
+	}
+}
+
+func TestDatastoreStats(t *testing.T) {
+	at := func(datetime string) time.Time {
+		t, err := time.ParseInLocation("2006-01-02 15:04", datetime, models.EventLocation)
+		if err != nil {
+			panic(err)
+		}
+		return t
+	}
+	event := func(eventID int, socID int, societyName string, eventType string, locationType string, start string, minutes int) models.DatabaseEvent {
+		return models.DatabaseEvent{
+			EventID:        eventID,
+			EventDetailsID: 200 + eventID,
+			SocietyID:      socID,
+			SocietyName:    societyName,
+			EventType:      eventType,
+			LocationType:   locationType,
+			StartDatetime:  at(start),
+			EndDatetime:    at(start).Add(time.Duration(minutes) * time.Minute),
+			Status:         "Active",
+		}
+	}
+	cancelled := event(5, 30, "CompSoc", "Talk", "On Campus", "2022-10-04 18:00", 60)
+	cancelled.Status = "Cancelled"
+
+	events := []models.DatabaseEvent{
+		event(1, 30, "CompSoc", "Workshop", "On Campus", "2022-09-05 18:00", 120),
+		event(2, 30, "CompSoc", "Talk", "On Campus", "2022-09-12 18:00", 60),
+		// A Thursday in October in Dublin, but still a Wednesday in UTC
+		event(3, 30, "CompSoc", "Social", "Off Campus", "2022-10-06 00:30", 60),
+		event(4, 30, "CompSoc", "Talk", "On Campus", "2099-01-05 18:00", 60),
+		cancelled,
+		event(6, 31, "ChessSoc", "Social", "On Campus", "2022-09-10 14:00", 180),
+		event(7, 31, "Chess Society", "Social", "On Campus", "2022-09-11 14:00", 180),
+		event(8, 32, "DramaSoc", "Other", "On Campus", "2022-09-07 19:00", 90),
+		event(9, 32, "DramaSoc", "Other", "On Campus", "2022-09-08 19:00", 90),
+	}
+
+	for name, open := range testDatastores(t) {
+		t.Run(name, func(t *testing.T) {
+			ds := open(t)
+			ctx := context.Background()
+			if err := ds.UpsertEvents(ctx, events); err != nil {
+				t.Fatal(err)
+			}
+
+			stats, err := ds.GetSocietyStats(ctx, 30, models.EventFilter{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := &models.SocietyStats{
+				SocietyID:      30,
+				Events:         4,
+				UpcomingEvents: 1,
+				EventsPerMonth: []models.MonthCount{
+					{Month: "2022-09", Events: 2},
+					{Month: "2022-10", Events: 1},
+					{Month: "2099-01", Events: 1},
+				},
+				EventsPerType:          map[string]int{"Workshop": 1, "Talk": 2, "Social": 1},
+				EventsPerLocationType:  map[string]int{"On Campus": 3, "Off Campus": 1},
+				AverageDurationMinutes: 75,
+				BusiestWeekday:         "Monday",
+			}
+			if !reflect.DeepEqual(stats, want) {
+				t.Errorf("got stats %+v, want %+v", stats, want)
+			}
+
+			stats, err = ds.GetSocietyStats(ctx, 30, models.EventFilter{From: at("2022-10-01 00:00"), EventTypes: []string{"Social"}})
+			if err != nil || stats.Events != 1 || stats.BusiestWeekday != "Thursday" {
+				t.Errorf("filtered stats: got %+v, %v", stats, err)
+			}
+
+			stats, err = ds.GetSocietyStats(ctx, 99, models.EventFilter{})
+			if err != nil || !reflect.DeepEqual(stats, &models.SocietyStats{
+				SocietyID:             99,
+				EventsPerMonth:        []models.MonthCount{},
+				EventsPerType:         map[string]int{},
+				EventsPerLocationType: map[string]int{},
+			}) {
+				t.Errorf("stats without events: got %+v, %v", stats, err)
+			}
+
+			rankings, err := ds.GetSocietyLeaderboard(ctx, models.EventFilter{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			wantRankings := []models.SocietyRanking{
+				{Rank: 1, SocietyID: 30, SocietyName: "CompSoc", Events: 4, UpcomingEvents: 1, AverageDurationMinutes: 75},
+				{Rank: 2, SocietyID: 31, SocietyName: "Chess Society", Events: 2, AverageDurationMinutes: 180},
+				{Rank: 2, SocietyID: 32, SocietyName: "DramaSoc", Events: 2, AverageDurationMinutes: 90},
+			}
+			if !reflect.DeepEqual(rankings, wantRankings) {
+				t.Errorf("got leaderboard %+v, want %+v", rankings, wantRankings)
+			}
+
+			rankings, err = ds.GetSocietyLeaderboard(ctx, models.EventFilter{To: at("2022-09-09 00:00"), Limit: 1})
+			if err != nil || len(rankings) != 1 || rankings[0].SocietyID != 32 || rankings[0].Rank != 1 {
+				t.Errorf("filtered leaderboard: got %+v, %v", rankings, err)
+			}
+		})
+	}
+}
+
+func TestDatastoreJobRuns(t *testing.T) {
+	for name, open := range testDatastores(t) {
+		t.Run(name, func(t *testing.T) {
+			ds := open(t)
+			ctx := context.Background()
+			start := time.Date(2022, 9, 7, 12, 0, 0, 0, time.UTC)
+
+			for i, run := range []models.JobRun{
+				{Job: "sync", Trigger: models.JobTriggerSchedule, Outcome: models.JobSucceeded, Counts: map[string]int{"events": 3}},
+				{Job: "sync", Trigger: models.JobTriggerManual, TriggeredBy: "tester", Outcome: models.JobFailed, Error: "portal is down"},
+				{Job: "discover", Trigger: models.JobTriggerSchedule, Outcome: models.JobSucceeded},
+				{Job: "sync", Trigger: models.JobTriggerSchedule, Outcome: models.JobSucceeded, Counts: map[string]int{"events": 4}},
+			} {
+				run.StartedAt = start.Add(time.Duration(i) * time.Minute)
+				run.FinishedAt = run.StartedAt.Add(time.Second)
+				if err := ds.RecordJobRun(ctx, run); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			runs, err := ds.GetJobRuns(ctx, "sync", 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(runs) != 2 {
+				t.Fatalf("got %v runs, want 2", len(runs))
+			}
+			if runs[0].Counts["events"] != 4 || !runs[0].StartedAt.Equal(start.Add(3*time.Minute)) || !runs[0].FinishedAt.Equal(start.Add(3*time.Minute+time.Second)) {
+				t.Errorf("newest run is %+v", runs[0])
+			}
+			if runs[1].Trigger != models.JobTriggerManual || runs[1].TriggeredBy != "tester" || runs[1].Outcome != models.JobFailed || runs[1].Error != "portal is down" {
+				t.Errorf("failed run is %+v", runs[1])
+			}
+
+			last, err := ds.GetLastJobRun(ctx, "sync", models.JobFailed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !last.StartedAt.Equal(start.Add(time.Minute)) || last.Error != "portal is down" {
+				t.Errorf("last failed run is %+v", last)
+			}
+			if _, err := ds.GetLastJobRun(ctx, "discover", models.JobFailed); !errors.Is(err, models.ErrNotFound) {
+				t.Errorf("finding a failed run of a job that never failed returned %v, want not found", err)
+			}
+
+			runs, err = ds.GetJobRuns(ctx, "missing", 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(runs) != 0 {
+				t.Errorf("got runs of a job that never ran: %+v", runs)
+			}
+		})
+	}
+}
+
+func TestDatastoreLocks(t *testing.T) {
+	for name, open := range testDatastores(t) {
+		t.Run(name, func(t *testing.T) {
+			ds := open(t)
+			ctx := context.Background()
+			ttl := 100 * time.Millisecond
+
+			expect := func(description string, got bool, err error, want bool) {
+				t.Helper()
+				if err != nil {
+					t.Fatalf("%v: %v", description, err)
+				}
+				if got != want {
+					t.Errorf("%v reported %v, want %v", description, got, want)
+				}
+			}
+
+			acquired, err := ds.AcquireLock(ctx, "sync", "first", ttl)
+			expect("acquiring a free lock", acquired, err, true)
+			acquired, err = ds.AcquireLock(ctx, "sync", "second", ttl)
+			expect("acquiring a held lock", acquired, err, false)
+			acquired, err = ds.AcquireLock(ctx, "discover", "second", ttl)
+			expect("acquiring another lock", acquired, err, true)
+			renewed, err := ds.RenewLock(ctx, "sync", "first", ttl)
+			expect("renewing a held lock", renewed, err, true)
+			renewed, err = ds.RenewLock(ctx, "sync", "second", ttl)
+			expect("renewing someone else's lock", renewed, err, false)
+
+			lock, err := ds.GetLock(ctx, "sync")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if lock.Holder != "first" || !lock.ExpiresAt.After(lock.AcquiredAt) {
+				t.Errorf("lock is %+v", lock)
+			}
+
+			// The first holder dies and its lease lapses
+			time.Sleep(2 * ttl)
+			if _, err := ds.GetLock(ctx, "sync"); !errors.Is(err, models.ErrNotFound) {
+				t.Errorf("getting a lapsed lock failed with %v, want not found", err)
+			}
+			acquired, err = ds.AcquireLock(ctx, "sync", "second", time.Minute)
+			expect("taking over a lapsed lock", acquired, err, true)
+			renewed, err = ds.RenewLock(ctx, "sync", "first", ttl)
+			expect("renewing a lock taken over", renewed, err, false)
+
+			// Releasing someone else's lock does nothing
+			if err := ds.ReleaseLock(ctx, "sync", "first"); err != nil {
+				t.Fatal(err)
+			}
+			if lock, err := ds.GetLock(ctx, "sync"); err != nil || lock.Holder != "second" {
+				t.Errorf("lock is %+v, %v after someone else released it", lock, err)
+			}
+			if err := ds.ReleaseLock(ctx, "sync", "second"); err != nil {
+				t.Fatal(err)
+			}
+			acquired, err = ds.AcquireLock(ctx, "sync", "first", ttl)
+			expect("acquiring a released lock", acquired, err, true)
+		})
+	}
+}
+
+func TestSQLMigrationsAreIdempotent(t *testing.T) {
+	dsn := t.TempDir() + "/api.db"
+	for i := 0; i < 2; i++ {
+		ds, err := NewSQLDatastore(context.Background(), DriverSQLite, dsn, 0)
+		if err != nil {
+			t.Fatalf("open %v: %v", i, err)
+		}
+		if err := ds.Migrate(context.Background()); err != nil {
+			t.Fatalf("migrate %v: %v", i, err)
+		}
+		var version int
+		if err := ds.db.QueryRow(`SELECT MAX(version) FROM schema_migrations`).Scan(&version); err != nil || version != len(sqlMigrations) {
+			t.Errorf("open %v: at version %v, %v, want %v", i, version, err, len(sqlMigrations))
+		}
+		ds.Close(context.Background())
+	}
+}
+
+func TestSQLMigrationsStopAtDuplicateSocieties(t *testing.T) {
+	ctx := context.Background()
+	ds, err := NewSQLDatastore(ctx, DriverSQLite, ":memory:", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ds.Close(context.Background())
+
+	// A database from before society portal IDs were unique
+	unique := 0
+	for i, migration := range sqlMigrations {
+		if migration == sqlUniqueSocietyPortalIDs {
+			unique = i
+		}
+	}
+	if _, err := ds.db.Exec(`CREATE TABLE schema_migrations (version INTEGER PRIMARY KEY, applied_at BIGINT NOT NULL)`); err != nil {
+		t.Fatal(err)
+	}
+	for i, migration := range sqlMigrations[:unique] {
+		if _, err := ds.db.Exec(migration); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ds.db.Exec(`INSERT INTO schema_migrations (version, applied_at) VALUES (?, 0)`, i+1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := ds.db.Exec(`INSERT INTO societies (name, societies_portal_id) VALUES ('CompSoc', 30), ('Computer Society', 30), ('ChessSoc', 31)`); err != nil {
+		t.Fatal(err)
+	}
+
+	err = ds.Migrate(ctx)
+	if err == nil || !strings.Contains(err.Error(), "30 (CompSoc, Computer Society)") || strings.Contains(err.Error(), "ChessSoc") {
+		t.Fatalf("migrating with duplicate societies failed with %v", err)
+	}
+	var societies int
+	if err := ds.db.QueryRow(`SELECT COUNT(*) FROM societies`).Scan(&societies); err != nil || societies != 3 {
+		t.Errorf("%v societies are left, %v, want all 3", societies, err)
+	}
+
+	// Once an admin removes the duplicate, the migrations carry on
+	if _, err := ds.db.Exec(`DELETE FROM societies WHERE name = 'Computer Society'`); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
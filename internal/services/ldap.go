@@ -1,7 +1,11 @@
 package services
 
 import (
+	"context"
 	"crypto/tls"
+	"net"
+	"strings"
+	"time"
 
 	ldap "github.com/go-ldap/ldap/v3"
 	"github.com/nuigcompsoc/api/internal/config"
@@ -40,3 +44,32 @@ func NewLdap(config *config.Config) *LdapService {
 		SearchBase:        config.LDAP.SearchBase,
 	}
 }
+
+// CheckLdapBind dials LDAP and binds with the configured credentials on a
+// connection of its own, so it can be used to check LDAP is usable without
+// taking down the process like NewLdap does
+func CheckLdapBind(ctx context.Context, config *config.Config) error {
+	dialer := &net.Dialer{}
+	if deadline, ok := ctx.Deadline(); ok {
+		dialer.Deadline = deadline
+	}
+
+	l, err := ldap.DialURL(config.LDAP.URL, ldap.DialWithDialer(dialer))
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		l.SetTimeout(time.Until(deadline))
+	}
+
+	// ldaps:// URLs are already encrypted
+	if !strings.HasPrefix(config.LDAP.URL, "ldaps://") {
+		if err := l.StartTLS(&tls.Config{}); err != nil {
+			return err
+		}
+	}
+
+	return l.Bind(config.LDAP.Bind, config.LDAP.Password)
+}
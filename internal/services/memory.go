@@ -0,0 +1,781 @@
+package services
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nuigcompsoc/api/internal/models"
+	"golang.org/x/exp/slices"
+)
+
+// MemoryDatastore keeps everything in memory, behaving as MongoDatastore does.
+// It's meant for tests and for running the API without a database.
+type MemoryDatastore struct {
+	mu        sync.RWMutex
+	events    []models.DatabaseEvent
+	societies map[string]models.Society
+	proposals map[int32]models.SocietyProposal
+	// Oldest first
+	audit   []models.SocietyAuditEntry
+	jobRuns []models.JobRun
+	locks   map[string]models.Lock
+}
+
+func NewMemoryDatastore() *MemoryDatastore {
+	return &MemoryDatastore{
+		societies: map[string]models.Society{},
+		proposals: map[int32]models.SocietyProposal{},
+		locks:     map[string]models.Lock{},
+	}
+}
+
+func (ds *MemoryDatastore) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// Close has nothing to disconnect from
+func (ds *MemoryDatastore) Close(ctx context.Context) error {
+	return nil
+}
+
+// Migrate has nothing to do, there's no schema
+func (ds *MemoryDatastore) Migrate(ctx context.Context) error {
+	return ctx.Err()
+}
+
+/*
+ *	Societies
+ */
+
+func (ds *MemoryDatastore) UpsertSociety(ctx context.Context, society models.Society, actor string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	stored, ok := ds.societies[society.Name]
+	if !ok {
+		if ds.conflicts(society, nil) {
+			return false, models.ErrConflict
+		}
+		ds.writeSociety(actor, nil, &society)
+		return true, nil
+	}
+
+	society = mergeSocietyMetadata(society, stored)
+	if len(stored.ChangedFields(society)) == 0 {
+		return false, nil
+	}
+	if ds.conflicts(society, &stored.SocietiesPortalID) {
+		return false, models.ErrConflict
+	}
+	ds.writeSociety(actor, &stored, &society)
+	return true, nil
+}
+
+func (ds *MemoryDatastore) GetAllSocieties(ctx context.Context) (map[string]models.Society, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	societies := map[string]models.Society{}
+	for name, society := range ds.societies {
+		societies[name] = society
+	}
+	return societies, nil
+}
+
+func (ds *MemoryDatastore) GetSocietyBySocietyName(ctx context.Context, societyName string) (*models.Society, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	society, ok := ds.societies[societyName]
+	if !ok {
+		return nil, models.ErrNotFound
+	}
+	return &society, nil
+}
+
+func (ds *MemoryDatastore) GetSocietyBySocietiesPortalID(ctx context.Context, societiesPortalID int32) (*models.Society, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	for _, society := range ds.societies {
+		if society.SocietiesPortalID == societiesPortalID {
+			return &society, nil
+		}
+	}
+	return nil, models.ErrNotFound
+}
+
+func (ds *MemoryDatastore) CreateSociety(ctx context.Context, society models.Society, actor string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	if ds.conflicts(society, nil) {
+		return models.ErrConflict
+	}
+	ds.writeSociety(actor, nil, &society)
+	return nil
+}
+
+func (ds *MemoryDatastore) UpdateSociety(ctx context.Context, societiesPortalID int32, society models.Society, actor string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	name, ok := ds.societyName(societiesPortalID)
+	if !ok {
+		return false, models.ErrNotFound
+	}
+	stored := ds.societies[name]
+	if len(stored.ChangedFields(society)) == 0 {
+		return false, nil
+	}
+	if ds.conflicts(society, &societiesPortalID) {
+		return false, models.ErrConflict
+	}
+	ds.writeSociety(actor, &stored, &society)
+	return true, nil
+}
+
+func (ds *MemoryDatastore) DeleteSociety(ctx context.Context, societiesPortalID int32, actor string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	name, ok := ds.societyName(societiesPortalID)
+	if !ok {
+		return models.ErrNotFound
+	}
+	stored := ds.societies[name]
+	ds.writeSociety(actor, &stored, nil)
+	return nil
+}
+
+func (ds *MemoryDatastore) GetSocietyAudit(ctx context.Context, societiesPortalID int32) ([]models.SocietyAuditEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	entries := []models.SocietyAuditEntry{}
+	for i := len(ds.audit) - 1; i >= 0; i-- {
+		if ds.audit[i].SocietiesPortalID == societiesPortalID {
+			entries = append(entries, ds.audit[i])
+		}
+	}
+	return entries, nil
+}
+
+// Replaces before with after, either of which may be nil, and records it in
+// the audit log. Callers must hold ds.mu.
+func (ds *MemoryDatastore) writeSociety(actor string, before *models.Society, after *models.Society) {
+	if before != nil {
+		delete(ds.societies, before.Name)
+	}
+	if after != nil {
+		ds.societies[after.Name] = *after
+	}
+	ds.audit = append(ds.audit, newSocietyAuditEntry(actor, before, after, time.Now().UTC()))
+}
+
+// Callers must hold ds.mu
+func (ds *MemoryDatastore) societyName(societiesPortalID int32) (string, bool) {
+	for name, society := range ds.societies {
+		if society.SocietiesPortalID == societiesPortalID {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// Mirrors MongoDatastore.checkSocietyUnique, callers must hold ds.mu
+func (ds *MemoryDatastore) conflicts(society models.Society, existing *int32) bool {
+	for _, other := range ds.societies {
+		if existing != nil && other.SocietiesPortalID == *existing {
+			continue
+		}
+		if other.Name == society.Name || other.SocietiesPortalID == society.SocietiesPortalID {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+ *	Society Proposals
+ */
+
+func (ds *MemoryDatastore) UpsertSocietyProposals(ctx context.Context, proposals []models.SocietyProposal) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	for _, proposal := range proposals {
+		if stored, ok := ds.proposals[proposal.SocietiesPortalID]; ok {
+			stored.Name = proposal.Name
+			stored.EventCount = proposal.EventCount
+			stored.LastSeen = proposal.LastSeen
+			ds.proposals[proposal.SocietiesPortalID] = stored
+			continue
+		}
+
+		proposal.Status = models.ProposalPending
+		proposal.DecidedBy = ""
+		proposal.DecidedAt = nil
+		ds.proposals[proposal.SocietiesPortalID] = proposal
+	}
+	return nil
+}
+
+func (ds *MemoryDatastore) GetSocietyProposals(ctx context.Context, status string) ([]models.SocietyProposal, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	proposals := []models.SocietyProposal{}
+	for _, proposal := range ds.proposals {
+		if status == "" || proposal.Status == status {
+			proposals = append(proposals, proposal)
+		}
+	}
+	sort.Slice(proposals, func(i, j int) bool {
+		return proposals[i].Name < proposals[j].Name
+	})
+	return proposals, nil
+}
+
+func (ds *MemoryDatastore) GetSocietyProposal(ctx context.Context, societiesPortalID int32) (*models.SocietyProposal, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	proposal, ok := ds.proposals[societiesPortalID]
+	if !ok {
+		return nil, models.ErrNotFound
+	}
+	return &proposal, nil
+}
+
+func (ds *MemoryDatastore) DecideSocietyProposal(ctx context.Context, societiesPortalID int32, status string, decidedBy string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	proposal, ok := ds.proposals[societiesPortalID]
+	if !ok {
+		return models.ErrNotFound
+	}
+	now := time.Now().UTC()
+	proposal.Status = status
+	proposal.DecidedBy = decidedBy
+	proposal.DecidedAt = &now
+	ds.proposals[societiesPortalID] = proposal
+	return nil
+}
+
+/*
+ *	Job Runs
+ */
+
+func (ds *MemoryDatastore) RecordJobRun(ctx context.Context, run models.JobRun) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	ds.jobRuns = append(ds.jobRuns, run)
+	return nil
+}
+
+func (ds *MemoryDatastore) GetJobRuns(ctx context.Context, job string, limit int64) ([]models.JobRun, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	runs := []models.JobRun{}
+	for i := len(ds.jobRuns) - 1; i >= 0; i-- {
+		if ds.jobRuns[i].Job == job {
+			runs = append(runs, ds.jobRuns[i])
+		}
+	}
+	sort.SliceStable(runs, func(i, j int) bool {
+		return runs[i].StartedAt.After(runs[j].StartedAt)
+	})
+	if int64(len(runs)) > limit {
+		runs = runs[:limit]
+	}
+	return runs, nil
+}
+
+func (ds *MemoryDatastore) GetLastJobRun(ctx context.Context, job string, outcome string) (*models.JobRun, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	var last *models.JobRun
+	for i := range ds.jobRuns {
+		run := ds.jobRuns[i]
+		if run.Job == job && run.Outcome == outcome && (last == nil || !run.StartedAt.Before(last.StartedAt)) {
+			last = &run
+		}
+	}
+	if last == nil {
+		return nil, models.ErrNotFound
+	}
+	return last, nil
+}
+
+/*
+ *	Locks
+ */
+
+func (ds *MemoryDatastore) AcquireLock(ctx context.Context, name string, holder string, ttl time.Duration) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	now := time.Now().UTC()
+	lock, ok := ds.locks[name]
+	if ok && lock.Holder != holder && lock.ExpiresAt.After(now) {
+		return false, nil
+	}
+	ds.locks[name] = models.Lock{Name: name, Holder: holder, AcquiredAt: now, ExpiresAt: now.Add(ttl)}
+	return true, nil
+}
+
+func (ds *MemoryDatastore) RenewLock(ctx context.Context, name string, holder string, ttl time.Duration) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	lock, ok := ds.locks[name]
+	if !ok || lock.Holder != holder {
+		return false, nil
+	}
+	lock.ExpiresAt = time.Now().UTC().Add(ttl)
+	ds.locks[name] = lock
+	return true, nil
+}
+
+func (ds *MemoryDatastore) ReleaseLock(ctx context.Context, name string, holder string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	if lock, ok := ds.locks[name]; ok && lock.Holder == holder {
+		delete(ds.locks, name)
+	}
+	return nil
+}
+
+func (ds *MemoryDatastore) GetLock(ctx context.Context, name string) (*models.Lock, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	lock, ok := ds.locks[name]
+	if !ok || !lock.ExpiresAt.After(time.Now()) {
+		return nil, models.ErrNotFound
+	}
+	return &lock, nil
+}
+
+/*
+ *	Events
+ */
+
+func (ds *MemoryDatastore) UpsertEvents(ctx context.Context, events []models.DatabaseEvent) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	now := time.Now().UTC()
+	for _, event := range events {
+		i := ds.indexOf(event.EventDetailsID, event.EventID)
+		if i < 0 {
+			event.Version(nil, now)
+			ds.events = append(ds.events, event)
+			continue
+		}
+		event.Version(&ds.events[i], now)
+		ds.events[i] = event
+	}
+	return nil
+}
+
+// Must be called with mu held
+func (ds *MemoryDatastore) indexOf(eventDetailsID int, eventID int) int {
+	for i, event := range ds.events {
+		if event.EventDetailsID == eventDetailsID && event.EventID == eventID {
+			return i
+		}
+	}
+	return -1
+}
+
+func (ds *MemoryDatastore) GetAllEvents(ctx context.Context, filter models.EventFilter) (*models.EventPage, error) {
+	return ds.findEvents(ctx, func(models.DatabaseEvent) bool { return true }, filter)
+}
+
+func (ds *MemoryDatastore) GetAllUpcomingEvents(ctx context.Context, filter models.EventFilter) (*models.EventPage, error) {
+	cutoff := upcomingCutoff()
+	return ds.findEvents(ctx, func(e models.DatabaseEvent) bool {
+		return !e.EndDatetime.Before(cutoff)
+	}, filter)
+}
+
+func (ds *MemoryDatastore) GetAllPastEvents(ctx context.Context, filter models.EventFilter) (*models.EventPage, error) {
+	cutoff := upcomingCutoff()
+	return ds.findEvents(ctx, func(e models.DatabaseEvent) bool {
+		return e.EndDatetime.Before(cutoff)
+	}, filter)
+}
+
+func (ds *MemoryDatastore) GetAllUpcomingEventsForSocID(ctx context.Context, socID int, filter models.EventFilter) (*models.EventPage, error) {
+	cutoff := upcomingCutoff()
+	return ds.findEvents(ctx, func(e models.DatabaseEvent) bool {
+		return e.SocietyID == socID && !e.EndDatetime.Before(cutoff)
+	}, filter)
+}
+
+func (ds *MemoryDatastore) GetAllPastEventsForSocID(ctx context.Context, socID int, filter models.EventFilter) (*models.EventPage, error) {
+	cutoff := upcomingCutoff()
+	return ds.findEvents(ctx, func(e models.DatabaseEvent) bool {
+		return e.SocietyID == socID && e.EndDatetime.Before(cutoff)
+	}, filter)
+}
+
+// findEvents returns a page of events matching both condition and filter,
+// along with the total number of matching events across all pages
+func (ds *MemoryDatastore) findEvents(ctx context.Context, condition func(models.DatabaseEvent) bool, filter models.EventFilter) (*models.EventPage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ds.mu.RLock()
+	matched := []models.DatabaseEvent{}
+	for _, event := range ds.events {
+		if condition(event) && matchesEventFilter(event, filter) {
+			matched = append(matched, event)
+		}
+	}
+	ds.mu.RUnlock()
+
+	sort.Slice(matched, func(i, j int) bool {
+		c := compareEventCursors(matched[i].CursorAfter(), matched[j].CursorAfter())
+		if filter.Descending {
+			return c > 0
+		}
+		return c < 0
+	})
+
+	page := &models.EventPage{Total: int64(len(matched))}
+	events := []models.DatabaseEvent{}
+	for _, event := range matched {
+		if filter.After != nil {
+			c := compareEventCursors(event.CursorAfter(), *filter.After)
+			if filter.Descending && c >= 0 || !filter.Descending && c <= 0 {
+				continue
+			}
+		}
+		events = append(events, event)
+	}
+
+	if filter.Limit > 0 && int64(len(events)) > filter.Limit {
+		events = events[:filter.Limit]
+		page.NextCursor = events[len(events)-1].CursorAfter().Encode()
+	}
+	page.Events = inEventLocation(events)
+
+	return page, nil
+}
+
+// Mirrors the conditions eventFilterConditions puts on the events collection
+func matchesEventFilter(event models.DatabaseEvent, filter models.EventFilter) bool {
+	if !filter.From.IsZero() && event.EndDatetime.Before(filter.From) {
+		return false
+	}
+	if !filter.To.IsZero() && event.StartDatetime.After(filter.To) {
+		return false
+	}
+	if len(filter.SocietyIDs) > 0 && !slices.Contains(filter.SocietyIDs, event.SocietyID) {
+		return false
+	}
+	if len(filter.LocationTypes) > 0 && !slices.Contains(filter.LocationTypes, event.LocationType) {
+		return false
+	}
+	if len(filter.EventTypes) > 0 && !slices.Contains(filter.EventTypes, event.EventType) {
+		return false
+	}
+	return true
+}
+
+// Orders cursors by score, then start datetime, then IDs
+func compareEventCursors(a models.EventCursor, b models.EventCursor) int {
+	switch {
+	case a.Score != b.Score:
+		return compareFloats(a.Score, b.Score)
+	case !a.StartDatetime.Equal(b.StartDatetime):
+		if a.StartDatetime.Before(b.StartDatetime) {
+			return -1
+		}
+		return 1
+	case a.EventDetailsID != b.EventDetailsID:
+		return compareFloats(float64(a.EventDetailsID), float64(b.EventDetailsID))
+	default:
+		return compareFloats(float64(a.EventID), float64(b.EventID))
+	}
+}
+
+func compareFloats(a float64, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// The weights of the fields searched, as on the events_text index
+var searchWeights = map[string]float64{
+	"title":                10,
+	"society_name":         5,
+	"location":             2,
+	"description_markdown": 1,
+}
+
+var searchPhrasePattern = regexp.MustCompile(`"([^"]*)"`)
+
+// SearchEvents approximates Mongo's $text search, see rankSearchResults
+func (ds *MemoryDatastore) SearchEvents(ctx context.Context, query string, filter models.EventFilter) (*models.EventSearchPage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ds.mu.RLock()
+	candidates := []models.DatabaseEvent{}
+	for _, event := range ds.events {
+		if matchesEventFilter(event, filter) {
+			candidates = append(candidates, event)
+		}
+	}
+	ds.mu.RUnlock()
+
+	return rankSearchResults(candidates, query, filter), nil
+}
+
+// rankSearchResults searches candidates, which already match filter, the way
+// Mongo's $text search does for datastores without one: events must contain
+// one of the terms and every quoted phrase, and none of the negated terms.
+// Scores weigh the number of matches in each field like the events_text index
+// does. Results are paged like MongoDatastore.SearchEvents.
+func rankSearchResults(candidates []models.DatabaseEvent, query string, filter models.EventFilter) *models.EventSearchPage {
+	phrases := []string{}
+	for _, match := range searchPhrasePattern.FindAllStringSubmatch(query, -1) {
+		if phrase := strings.ToLower(strings.TrimSpace(match[1])); phrase != "" {
+			phrases = append(phrases, phrase)
+		}
+	}
+	negated := []string{}
+	for _, term := range strings.Fields(searchPhrasePattern.ReplaceAllString(query, " ")) {
+		if strings.HasPrefix(term, "-") && len(term) > 1 {
+			negated = append(negated, strings.ToLower(term[1:]))
+		}
+	}
+	pattern := models.SearchTermsPattern(query)
+
+	results := []models.EventSearchResult{}
+	for _, event := range candidates {
+		if score := searchScore(event, pattern, phrases, negated); score > 0 {
+			results = append(results, models.EventSearchResult{DatabaseEvent: event, Score: score})
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return compareEventCursors(results[i].CursorAfter(), results[j].CursorAfter()) > 0
+	})
+
+	page := &models.EventSearchPage{Results: []models.EventSearchResult{}, Total: int64(len(results))}
+	for _, result := range results {
+		if filter.After != nil && compareEventCursors(result.CursorAfter(), *filter.After) >= 0 {
+			continue
+		}
+		page.Results = append(page.Results, result)
+	}
+
+	if filter.Limit > 0 && int64(len(page.Results)) > filter.Limit {
+		page.Results = page.Results[:filter.Limit]
+		page.NextCursor = page.Results[len(page.Results)-1].CursorAfter().Encode()
+	}
+
+	for i := range page.Results {
+		page.Results[i].DatabaseEvent = page.Results[i].InEventLocation()
+		page.Results[i].Highlight(pattern)
+	}
+
+	return page
+}
+
+func searchScore(event models.DatabaseEvent, pattern *regexp.Regexp, phrases []string, negated []string) float64 {
+	if pattern == nil {
+		return 0
+	}
+
+	fields := map[string]string{
+		"title":                event.Title,
+		"society_name":         event.SocietyName,
+		"location":             event.Location,
+		"description_markdown": event.DescriptionMarkdown,
+	}
+	all := strings.ToLower(event.Title + "\n" + event.SocietyName + "\n" + event.Location + "\n" + event.DescriptionMarkdown)
+	for _, phrase := range phrases {
+		if !strings.Contains(all, phrase) {
+			return 0
+		}
+	}
+	for _, term := range negated {
+		if strings.Contains(all, term) {
+			return 0
+		}
+	}
+
+	score := 0.0
+	for name, value := range fields {
+		score += searchWeights[name] * float64(len(pattern.FindAllStringIndex(value, -1)))
+	}
+	return score
+}
+
+// Prefers the next instance of the event that hasn't finished, falling back to
+// the most recent one, like MongoDatastore.GetEventByEventDetailsID
+func (ds *MemoryDatastore) GetEventByEventDetailsID(ctx context.Context, eventDetailsID int) (*models.DatabaseEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+
+	cutoff := upcomingCutoff()
+	var next, latest *models.DatabaseEvent
+	for i, event := range ds.events {
+		if event.EventDetailsID != eventDetailsID {
+			continue
+		}
+		if !event.EndDatetime.Before(cutoff) && (next == nil || event.StartDatetime.Before(next.StartDatetime)) {
+			next = &ds.events[i]
+		}
+		if latest == nil || event.StartDatetime.After(latest.StartDatetime) {
+			latest = &ds.events[i]
+		}
+	}
+
+	if next == nil {
+		next = latest
+	}
+	if next == nil {
+		return nil, models.ErrNotFound
+	}
+
+	event := next.InEventLocation()
+	return &event, nil
+}
+
+func (ds *MemoryDatastore) GetEventByEventID(ctx context.Context, eventDetailsID int, eventID int) (*models.DatabaseEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+
+	i := ds.indexOf(eventDetailsID, eventID)
+	if i < 0 {
+		return nil, models.ErrNotFound
+	}
+
+	event := ds.events[i].InEventLocation()
+	return &event, nil
+}
+
+/*
+ *	Stats
+ */
+
+func (ds *MemoryDatastore) GetSocietyStats(ctx context.Context, socID int, filter models.EventFilter) (*models.SocietyStats, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	filter.SocietyIDs = []int{socID}
+	return societyStatsFromEvents(socID, ds.matchingEvents(filter), upcomingCutoff()), nil
+}
+
+func (ds *MemoryDatastore) GetSocietyLeaderboard(ctx context.Context, filter models.EventFilter) ([]models.SocietyRanking, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return leaderboardFromEvents(ds.matchingEvents(filter), upcomingCutoff(), filter.Limit), nil
+}
+
+func (ds *MemoryDatastore) matchingEvents(filter models.EventFilter) []models.DatabaseEvent {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	events := []models.DatabaseEvent{}
+	for _, event := range ds.events {
+		if matchesEventFilter(event, filter) {
+			events = append(events, event)
+		}
+	}
+	return events
+}
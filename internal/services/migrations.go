@@ -0,0 +1,417 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nuigcompsoc/api/internal/logging"
+	"github.com/nuigcompsoc/api/internal/models"
+
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Mongo error codes for dropping something that isn't there
+const (
+	mongoNamespaceNotFound = 26
+	mongoIndexNotFound     = 27
+)
+
+// mongoMigration changes the shape of the database, creating indexes or
+// transforming existing documents
+type mongoMigration struct {
+	Version     int
+	Description string
+	// Up must be safe to run again, as a migration interrupted before it's
+	// recorded as applied is retried from the start
+	Up func(ctx context.Context, db *mongo.Database) error
+}
+
+// mongoMigrations are applied in order of version, each exactly once. Never
+// edit one that has been released, add another instead.
+var mongoMigrations = []mongoMigration{
+	{
+		Version:     1,
+		Description: "convert event datetimes stored as portal local time strings to dates",
+		Up:          migrateEventDatetimes,
+	},
+	{
+		Version:     2,
+		Description: "remove duplicate events and societies",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			if err := removeDuplicates(ctx, db.Collection("events"), "event_details_id", "event_id"); err != nil {
+				return err
+			}
+			return removeDuplicates(ctx, db.Collection("societies"), "name")
+		},
+	},
+	{
+		Version:     3,
+		Description: "index events and societies",
+		Up:          createIndexes,
+	},
+	{
+		Version:     4,
+		Description: "index society proposals",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("society_proposals").Indexes().CreateMany(ctx, []mongo.IndexModel{
+				{
+					Keys:    bson.D{{Key: "societies_portal_id", Value: 1}},
+					Options: options.Index().SetName("society_proposals_id").SetUnique(true),
+				},
+				{
+					Keys:    bson.D{{Key: "status", Value: 1}, {Key: "name", Value: 1}},
+					Options: options.Index().SetName("society_proposals_status"),
+				},
+			})
+			return err
+		},
+	},
+	{
+		Version:     5,
+		Description: "make society portal IDs unique and index the society audit log",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			societies := db.Collection("societies")
+			if err := checkMongoSocietyPortalIDs(ctx, societies); err != nil {
+				return err
+			}
+			_, err := societies.Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys:    bson.D{{Key: "societiesportalid", Value: 1}},
+				Options: options.Index().SetName("societies_portal_id").SetUnique(true),
+			})
+			if err != nil {
+				return err
+			}
+
+			_, err = db.Collection("society_audit").Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys:    bson.D{{Key: "societies_portal_id", Value: 1}, {Key: "at", Value: -1}},
+				Options: options.Index().SetName("society_audit_society"),
+			})
+			return err
+		},
+	},
+	{
+		Version:     6,
+		Description: "index job runs",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("job_runs").Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys:    bson.D{{Key: "job", Value: 1}, {Key: "started_at", Value: -1}},
+				Options: options.Index().SetName("job_runs_job"),
+			})
+			return err
+		},
+	},
+}
+
+// Migrate applies the migrations the database hasn't had yet, recording each
+// in the schema_migrations collection
+func (ds *MongoDatastore) Migrate(ctx context.Context) error {
+	applied, err := ds.appliedMigrations(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, migration := range mongoMigrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+
+		entry := logging.FromContext(ctx).WithFields(log.Fields{"version": migration.Version, "description": migration.Description})
+		entry.Info("Applying Mongo migration")
+		if err := ds.applyMigration(ctx, migration); err != nil {
+			entry.WithField("error", err).Warn("Failed to apply Mongo migration")
+			return fmt.Errorf("failed to apply migration %v: %w", migration.Version, err)
+		}
+	}
+
+	return nil
+}
+
+func (ds *MongoDatastore) applyMigration(ctx context.Context, migration mongoMigration) error {
+	ctx, cancel := context.WithTimeout(ctx, ds.queryTimeout)
+	defer cancel()
+
+	if err := migration.Up(ctx, ds.db); err != nil {
+		return err
+	}
+
+	_, err := ds.db.Collection("schema_migrations").InsertOne(ctx, bson.D{
+		{Key: "_id", Value: migration.Version},
+		{Key: "description", Value: migration.Description},
+		{Key: "applied_at", Value: time.Now().UTC()},
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		// Another instance of the API got there first
+		return nil
+	}
+	return err
+}
+
+func (ds *MongoDatastore) appliedMigrations(ctx context.Context) (map[int]time.Time, error) {
+	ctx, cancel := context.WithTimeout(ctx, ds.queryTimeout)
+	defer cancel()
+
+	cursor, err := ds.db.Collection("schema_migrations").Find(ctx, bson.D{})
+	if err != nil {
+		logging.FromContext(ctx).WithField("error", err).Warn("Failed to return cursor to find applied migrations")
+		return nil, err
+	}
+
+	documents := []struct {
+		Version   int       `bson:"_id"`
+		AppliedAt time.Time `bson:"applied_at"`
+	}{}
+	if err := cursor.All(ctx, &documents); err != nil {
+		logging.FromContext(ctx).WithField("error", err).Warn("Failed to use cursor to find applied migrations")
+		return nil, err
+	}
+
+	applied := map[int]time.Time{}
+	for _, document := range documents {
+		applied[document.Version] = document.AppliedAt
+	}
+	return applied, nil
+}
+
+/*
+ *	Migrations
+ */
+
+// Events stored while start_datetime and end_datetime were still kept as
+// portal local time strings (e.g. "2022-09-07T12:00") get BSON dates instead
+func migrateEventDatetimes(ctx context.Context, db *mongo.Database) error {
+	cursor, err := db.Collection("events").Find(ctx, bson.M{"$or": bson.A{
+		bson.M{"start_datetime": bson.M{"$type": "string"}},
+		bson.M{"end_datetime": bson.M{"$type": "string"}},
+	}})
+	if err != nil {
+		return err
+	}
+
+	documents := []bson.M{}
+	if err := cursor.All(ctx, &documents); err != nil {
+		return err
+	}
+
+	writeModels := []mongo.WriteModel{}
+	for _, document := range documents {
+		set := bson.M{}
+		for _, field := range []string{"start_datetime", "end_datetime"} {
+			value, ok := document[field].(string)
+			if !ok {
+				continue
+			}
+
+			datetime, err := models.ParsePortalDatetime(value)
+			if err != nil {
+				logging.FromContext(ctx).WithFields(log.Fields{"error": err, "_id": document["_id"]}).Warn("Failed to parse event datetime, leaving it as is")
+				continue
+			}
+			set[field] = datetime
+		}
+
+		if len(set) > 0 {
+			writeModels = append(writeModels,
+				mongo.NewUpdateOneModel().SetFilter(bson.M{"_id": document["_id"]}).SetUpdate(bson.M{"$set": set}))
+		}
+	}
+
+	if len(writeModels) == 0 {
+		return nil
+	}
+
+	results, err := db.Collection("events").BulkWrite(ctx, writeModels, options.BulkWrite().SetOrdered(false))
+	if err != nil {
+		return err
+	}
+
+	logging.FromContext(ctx).Info("Number of events migrated to date datetimes: ", results.ModifiedCount)
+	return nil
+}
+
+// Keeps only the most recently inserted of the documents sharing keys, so a
+// unique index can be created on them
+func removeDuplicates(ctx context.Context, collection *mongo.Collection, keys ...string) error {
+	group := bson.D{}
+	for _, key := range keys {
+		group = append(group, bson.E{Key: key, Value: "$" + key})
+	}
+
+	cursor, err := collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$sort", Value: bson.D{{Key: "_id", Value: -1}}}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: group},
+			{Key: "ids", Value: bson.D{{Key: "$push", Value: "$_id"}}},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+		}}},
+		{{Key: "$match", Value: bson.D{{Key: "count", Value: bson.D{{Key: "$gt", Value: 1}}}}}},
+	}, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return err
+	}
+
+	duplicates := []struct {
+		IDs bson.A `bson:"ids"`
+	}{}
+	if err := cursor.All(ctx, &duplicates); err != nil {
+		return err
+	}
+
+	remove := bson.A{}
+	for _, duplicate := range duplicates {
+		remove = append(remove, duplicate.IDs[1:]...)
+	}
+	if len(remove) == 0 {
+		return nil
+	}
+
+	result, err := collection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": remove}})
+	if err != nil {
+		return err
+	}
+
+	logging.FromContext(ctx).Infof("Number of duplicate documents removed from %v: %v", collection.Name(), result.DeletedCount)
+	return nil
+}
+
+// Fails if societies share a portal ID, which UpsertSociety used to allow,
+// so an admin can pick which of them to keep
+func checkMongoSocietyPortalIDs(ctx context.Context, societies *mongo.Collection) error {
+	cursor, err := societies.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$societiesportalid"},
+			{Key: "names", Value: bson.D{{Key: "$push", Value: "$name"}}},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+		}}},
+		{{Key: "$match", Value: bson.D{{Key: "count", Value: bson.D{{Key: "$gt", Value: 1}}}}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	groups := []struct {
+		SocietiesPortalID int      `bson:"_id"`
+		Names             []string `bson:"names"`
+	}{}
+	if err := cursor.All(ctx, &groups); err != nil {
+		return err
+	}
+
+	duplicates := duplicateSocieties{}
+	for _, group := range groups {
+		duplicates[group.SocietiesPortalID] = group.Names
+	}
+	return duplicates.err(ctx)
+}
+
+// The names of societies sharing a portal ID, keyed by the ID
+type duplicateSocieties map[int][]string
+
+// Logs each set of duplicates and describes them all in an error, or returns
+// nil if there aren't any. We don't pick which society to keep, as events
+// stop syncing for the others.
+func (d duplicateSocieties) err(ctx context.Context) error {
+	if len(d) == 0 {
+		return nil
+	}
+
+	ids := []int{}
+	for id := range d {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	conflicts := []string{}
+	for _, id := range ids {
+		names := d[id]
+		sort.Strings(names)
+		logging.FromContext(ctx).WithFields(log.Fields{"societiesPortalID": id, "names": names}).Warn("Societies share a portal ID")
+		conflicts = append(conflicts, fmt.Sprintf("%v (%v)", id, strings.Join(names, ", ")))
+	}
+	return fmt.Errorf("societies share portal IDs, delete or change all but one of each and migrate again: %v", strings.Join(conflicts, "; "))
+}
+
+// Creates the indexes every query relies on. Creating an index that already
+// exists is a no-op in Mongo.
+func createIndexes(ctx context.Context, db *mongo.Database) error {
+	events := db.Collection("events")
+
+	// Earlier versions of the API made a non unique index on the event IDs,
+	// which would conflict with the unique one
+	_, err := events.Indexes().DropOne(ctx, "event_details_id_1_event_id_1")
+	if err != nil && !isMongoError(err, mongoNamespaceNotFound, mongoIndexNotFound) {
+		return err
+	}
+
+	_, err = events.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "event_details_id", Value: 1},
+				{Key: "event_id", Value: 1},
+			},
+			Options: options.Index().SetName("events_ids").SetUnique(true),
+		},
+		{
+			// Upcoming and past events
+			Keys:    bson.D{{Key: "end_datetime", Value: 1}},
+			Options: options.Index().SetName("events_end"),
+		},
+		{
+			// Events in the order they're listed
+			Keys: bson.D{
+				{Key: "start_datetime", Value: 1},
+				{Key: "event_details_id", Value: 1},
+				{Key: "event_id", Value: 1},
+			},
+			Options: options.Index().SetName("events_start"),
+		},
+		{
+			Keys: bson.D{
+				{Key: "society_id", Value: 1},
+				{Key: "start_datetime", Value: 1},
+			},
+			Options: options.Index().SetName("events_society"),
+		},
+		{
+			Keys: bson.D{
+				{Key: "title", Value: "text"},
+				{Key: "society_name", Value: "text"},
+				{Key: "location", Value: "text"},
+				{Key: "description_markdown", Value: "text"},
+			},
+			Options: options.Index().SetName("events_text").SetWeights(bson.M{
+				"title":                10,
+				"society_name":         5,
+				"location":             2,
+				"description_markdown": 1,
+			}),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Collection("societies").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "name", Value: 1}},
+		Options: options.Index().SetName("societies_name").SetUnique(true),
+	})
+	return err
+}
+
+func isMongoError(err error, codes ...int) bool {
+	commandErr, ok := err.(mongo.CommandError)
+	if !ok {
+		return false
+	}
+	for _, code := range codes {
+		if commandErr.HasErrorCode(code) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,40 +1,480 @@
 package services
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
 	"time"
 
 	"github.com/nuigcompsoc/api/internal/config"
+	"github.com/nuigcompsoc/api/internal/logging"
+	"github.com/nuigcompsoc/api/internal/metrics"
 	"github.com/nuigcompsoc/api/internal/models"
+	"github.com/nuigcompsoc/api/internal/tracing"
 
 	"github.com/go-co-op/gocron"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/codes"
 )
 
+// Names of the scheduler's jobs, as they're configured and shown to admins
+const (
+	JobSyncUpcomingEvents = "sync_upcoming_events"
+	JobSyncAllEvents      = "sync_all_events"
+	JobDiscoverSocieties  = "discover_societies"
+)
+
+// How many of a job's runs are shown with its status
+const recentJobRuns = 10
+
+// How long leases on jobs last when scheduler.lock_ttl isn't set
+const defaultLockTTL = time.Minute
+
+// Sync windows used when scheduler.sync isn't set
+const (
+	defaultUpcomingBehind = 24 * time.Hour
+	defaultUpcomingAhead  = 365 * 24 * time.Hour
+	defaultFullSyncMaxAge = 2 * time.Hour
+)
+
+// JobFunc does a job's work, returning counts of what it got through
+type JobFunc func(ctx context.Context) (map[string]int, error)
+
+// Job is one of the scheduler's jobs. A job never runs twice at once, even
+// across replicas of the API, runs that would overlap are skipped.
+type Job struct {
+	Name     string
+	Schedule string
+	Disabled bool
+	Run      JobFunc
+
+	mu           sync.Mutex
+	runningSince *time.Time
+	scheduled    *gocron.Job
+}
+
 type SchedulerService struct {
 	Config    *config.Config
-	Datastore *MongoDatastore
+	Datastore Datastore
 	Scheduler *gocron.Scheduler
+	// Identifies this replica of the API, which holds the locks of the jobs
+	// it's running
+	Replica string
+
+	// In the order they were registered
+	jobs    []*Job
+	lockTTL time.Duration
+
+	// Runs are cancelled through ctx when the scheduler stops, and mu keeps
+	// runs from starting while it does
+	mu      sync.Mutex
+	ctx     context.Context
+	cancel  context.CancelFunc
+	running sync.WaitGroup
 }
 
-func (s *SchedulerService) DoGetAllEvents() {
-	log.Info("Starting doGetAllEvents Task")
+// Register adds a job to run on schedule, an interval like 5m or a cron
+// expression, unless the config overrides it. Jobs registered after
+// RunAllServices only run when triggered.
+func (s *SchedulerService) Register(name string, schedule string, run JobFunc) *Job {
+	job := &Job{Name: name, Schedule: schedule, Run: run}
+	if override, ok := s.Config.Scheduler.Jobs[name]; ok {
+		if override.Schedule != "" {
+			job.Schedule = override.Schedule
+		}
+		job.Disabled = override.Disabled
+	}
 
-	societiesPortalService := NewSocietiesPortalService(s.Config, s.Datastore)
+	s.jobs = append(s.jobs, job)
+	return job
+}
+
+// Job returns the job called name, or nil if there isn't one
+func (s *SchedulerService) Job(name string) *Job {
+	for _, job := range s.jobs {
+		if job.Name == name {
+			return job
+		}
+	}
+	return nil
+}
+
+// JobStatuses describes every job along with its most recent runs
+func (s *SchedulerService) JobStatuses(ctx context.Context) ([]models.JobStatus, error) {
+	statuses := []models.JobStatus{}
+	for _, job := range s.jobs {
+		status, err := s.JobStatus(ctx, job)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, *status)
+	}
+	return statuses, nil
+}
+
+// JobStatus describes job along with its most recent runs
+func (s *SchedulerService) JobStatus(ctx context.Context, job *Job) (*models.JobStatus, error) {
+	runs, err := s.Datastore.GetJobRuns(ctx, job.Name, recentJobRuns)
+	if err != nil {
+		return nil, err
+	}
+	lock, err := s.Datastore.GetLock(ctx, job.Name)
+	if err != nil && !errors.Is(err, models.ErrNotFound) {
+		return nil, err
+	}
+
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	status := &models.JobStatus{
+		Name:       job.Name,
+		Schedule:   job.Schedule,
+		Disabled:   job.Disabled,
+		RecentRuns: runs,
+	}
+	switch {
+	case lock != nil:
+		status.Running = true
+		status.RunningOn = lock.Holder
+		status.RunningSince = &lock.AcquiredAt
+	// Still finishing up after losing its lock
+	case job.runningSince != nil:
+		status.Running = true
+		status.RunningOn = s.Replica
+		status.RunningSince = job.runningSince
+	}
+	if job.scheduled != nil {
+		if next := job.scheduled.NextRun(); !next.IsZero() {
+			status.NextRun = &next
+		}
+	}
+	return status, nil
+}
+
+// TriggerJob starts a run of the job called name in the background on behalf
+// of admin. It fails with models.ErrNotFound if there's no such job, and with
+// models.ErrConflict if any replica is already running the job.
+func (s *SchedulerService) TriggerJob(ctx context.Context, name string, admin string) error {
+	job := s.Job(name)
+	if job == nil {
+		return models.ErrNotFound
+	}
+	started, err := s.startJob(ctx, job)
+	if err != nil {
+		return err
+	}
+	if !started {
+		return models.ErrConflict
+	}
+
+	go s.runJob(job, models.JobTriggerManual, admin)
+	return nil
+}
+
+// Runs job on its schedule, unless a replica is still running it or ran it
+// so recently that this run would only repeat its work
+func (s *SchedulerService) runScheduledJob(job *Job) {
+	entry := log.WithField("job", job.Name)
+	started, err := s.startJob(context.Background(), job)
+	if err != nil {
+		entry.WithField("error", err).Warn("Failed to lock job, skipping this run")
+		return
+	}
+	if !started {
+		entry.Info("Job is already running, skipping this run")
+		return
+	}
+
+	recent, err := s.ranRecently(context.Background(), job)
+	if err != nil {
+		entry.WithField("error", err).Warn("Failed to find the job's last run, running it anyway")
+	}
+	if recent {
+		entry.Debug("Job ran recently, skipping this run")
+		s.stopJob(job)
+		return
+	}
+
+	s.runJob(job, models.JobTriggerSchedule, "")
+}
+
+// Replicas run jobs at the same interval but not in step, so they take
+// turns rather than each running the job every interval. Cron schedules fire
+// at the same time on every replica, where the lock is enough.
+func (s *SchedulerService) ranRecently(ctx context.Context, job *Job) (bool, error) {
+	interval, err := time.ParseDuration(job.Schedule)
+	if err != nil {
+		return false, nil
+	}
+
+	runs, err := s.Datastore.GetJobRuns(ctx, job.Name, 1)
+	if err != nil || len(runs) == 0 {
+		return false, err
+	}
+	// Leaving some slack for the replica's own runs, which are an interval
+	// apart give or take
+	return time.Since(runs[0].StartedAt) < interval*9/10, nil
+}
+
+// Marks job as running on this replica and takes its lock, reporting false
+// if it's already running here or on another replica
+func (s *SchedulerService) startJob(ctx context.Context, job *Job) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ctx.Err() != nil {
+		return false, errors.New("the scheduler is stopped")
+	}
+	if !job.start() {
+		return false, nil
+	}
+
+	acquired, err := s.Datastore.AcquireLock(ctx, job.Name, s.Replica, s.lockTTL)
+	if err != nil || !acquired {
+		job.finish()
+		return false, err
+	}
+	s.running.Add(1)
+	return true, nil
+}
+
+// Releases job's lock and marks it as no longer running
+func (s *SchedulerService) stopJob(job *Job) {
+	s.releaseLock(job)
+	job.finish()
+	s.running.Done()
+}
+
+func (s *SchedulerService) releaseLock(job *Job) {
+	if err := s.Datastore.ReleaseLock(context.Background(), job.Name, s.Replica); err != nil {
+		log.WithFields(log.Fields{"error": err, "job": job.Name}).Warn("Failed to release the job's lock, it's held until it expires")
+	}
+}
+
+// Renews the lease on job's lock until ctx is done, cancelling the run with
+// cancel if another replica takes the lock over
+func (s *SchedulerService) renewJobLock(ctx context.Context, cancel context.CancelFunc, job *Job) {
+	entry := log.WithField("job", job.Name)
+	ticker := time.NewTicker(s.lockTTL / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		renewed, err := s.Datastore.RenewLock(ctx, job.Name, s.Replica, s.lockTTL)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			// The lease may still last until the next attempt
+			entry.WithField("error", err).Warn("Failed to renew the job's lock")
+			continue
+		}
+		if !renewed {
+			entry.Warn("Lost the job's lock to another replica, cancelling the run")
+			cancel()
+			return
+		}
+	}
+}
+
+// Runs job, which must have been started, and records the run
+func (s *SchedulerService) runJob(job *Job, trigger string, triggeredBy string) models.JobRun {
+	// Cancelled if the lock is lost or the scheduler stops
+	locked, cancel := context.WithCancel(s.ctx)
+	renewing := make(chan struct{})
+	go func() {
+		defer close(renewing)
+		s.renewJobLock(locked, cancel, job)
+	}()
+	defer func() {
+		cancel()
+		<-renewing
+		s.stopJob(job)
+	}()
+
+	entry := log.WithFields(log.Fields{"job": job.Name, "trigger": trigger, "replica": s.Replica})
+	entry.Info("Starting job")
+
+	ctx, span := tracing.Tracer().Start(locked, "scheduler."+job.Name)
+	defer span.End()
+	ctx = logging.WithEntry(ctx, entry)
 
-	var allEvents []models.Event
-	var err error
+	start := time.Now()
+	counts, err := job.Run(ctx)
+	metrics.ObserveJob(job.Name, start, err)
 
-	// Once an hour we want to update all events (past and upcoming)
-	if time.Now().UTC().Minute() > 0 && time.Now().UTC().Minute() <= 5 {
-		allEvents, err = societiesPortalService.GetAllEvents(true)
+	run := models.JobRun{
+		Job:         job.Name,
+		Trigger:     trigger,
+		TriggeredBy: triggeredBy,
+		Replica:     s.Replica,
+		StartedAt:   start.UTC(),
+		FinishedAt:  time.Now().UTC(),
+		Outcome:     models.JobSucceeded,
+		Counts:      counts,
+	}
+	if err != nil {
+		entry.WithField("error", err).Warn("Job failed")
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		run.Outcome = models.JobFailed
+		run.Error = err.Error()
 	} else {
-		allEvents, err = societiesPortalService.GetAllEvents(false)
+		entry.WithField("counts", counts).Info("Job finished")
+	}
+
+	// Recorded even if the run was cancelled
+	if err := s.Datastore.RecordJobRun(context.Background(), run); err != nil {
+		entry.WithField("error", err).Warn("Failed to record job run")
+	}
+	return run
+}
+
+// Marks the job as running, unless it already is
+func (j *Job) start() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.runningSince != nil {
+		return false
+	}
+	now := time.Now().UTC()
+	j.runningSince = &now
+	return true
+}
+
+func (j *Job) isRunning() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.runningSince != nil
+}
+
+func (j *Job) finish() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.runningSince = nil
+}
+
+// Refreshes the events that are about to happen or just have, which are the
+// ones that change most, and catches the full sync up if it's overdue
+func (s *SchedulerService) syncUpcomingEvents(ctx context.Context) (map[string]int, error) {
+	now := time.Now().UTC()
+	counts, err := s.syncEvents(ctx, now.Add(-s.upcomingBehind()), now.Add(s.upcomingAhead()))
+	if err != nil {
+		return counts, err
+	}
+
+	s.catchUpFullSync(ctx)
+	return counts, nil
+}
+
+// Refreshes every event in the history window, picking up changes to past
+// events that the upcoming sync no longer looks at
+func (s *SchedulerService) syncAllEvents(ctx context.Context) (map[string]int, error) {
+	history := s.Config.Scheduler.Sync.History
+	if history <= 0 {
+		return s.syncEvents(ctx, time.Time{}, time.Time{})
+	}
+	now := time.Now().UTC()
+	return s.syncEvents(ctx, now.Add(-history), now.Add(s.upcomingAhead()))
+}
+
+// Starts the full sync in the background if it hasn't succeeded on any
+// replica within scheduler.sync.full_sync_max_age, say because the API was
+// down when it was scheduled or its last runs failed
+func (s *SchedulerService) catchUpFullSync(ctx context.Context) {
+	job := s.Job(JobSyncAllEvents)
+	if job == nil || job.Disabled {
+		return
+	}
+	entry := log.WithField("job", job.Name)
+
+	maxAge := s.Config.Scheduler.Sync.FullSyncMaxAge
+	if maxAge <= 0 {
+		maxAge = defaultFullSyncMaxAge
+	}
+	last, err := s.Datastore.GetLastJobRun(ctx, job.Name, models.JobSucceeded)
+	if err != nil && !errors.Is(err, models.ErrNotFound) {
+		entry.WithField("error", err).Warn("Failed to find the last full sync, not catching it up")
+		return
+	}
+	if last != nil && time.Since(last.StartedAt) < maxAge {
+		return
 	}
 
+	started, err := s.startJob(ctx, job)
 	if err != nil {
-		log.Warn("getAllEvents Function Failed")
+		entry.WithField("error", err).Warn("Failed to lock job, not catching it up")
 		return
 	}
+	if !started {
+		// Whoever is running it is catching it up
+		return
+	}
+	entry.Info("Full sync is overdue, catching it up")
+	go s.runJob(job, models.JobTriggerCatchUp, "")
+}
+
+func (s *SchedulerService) upcomingBehind() time.Duration {
+	if behind := s.Config.Scheduler.Sync.UpcomingBehind; behind > 0 {
+		return behind
+	}
+	return defaultUpcomingBehind
+}
+
+func (s *SchedulerService) upcomingAhead() time.Duration {
+	if ahead := s.Config.Scheduler.Sync.UpcomingAhead; ahead > 0 {
+		return ahead
+	}
+	return defaultUpcomingAhead
+}
+
+func (s *SchedulerService) discoverSocieties(ctx context.Context) (map[string]int, error) {
+	proposals, err := NewSocietiesPortalService(s.Config, s.Datastore).DiscoverSocieties(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	logging.FromContext(ctx).WithField("pending_proposals", len(proposals)).Info("Society proposals are awaiting an admin")
+	return map[string]int{"pending_proposals": len(proposals)}, nil
+}
+
+// LastEventSync returns when either of the event syncs last succeeded on any
+// replica, or the zero time if they never have
+func (s *SchedulerService) LastEventSync(ctx context.Context) (time.Time, error) {
+	var last time.Time
+	for _, name := range []string{JobSyncUpcomingEvents, JobSyncAllEvents} {
+		run, err := s.Datastore.GetLastJobRun(ctx, name, models.JobSucceeded)
+		if errors.Is(err, models.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return time.Time{}, err
+		}
+		if run.FinishedAt.After(last) {
+			last = run.FinishedAt
+		}
+	}
+	return last, nil
+}
+
+// Syncs the events between start and end from the societies portal, or all
+// of them if they're zero
+func (s *SchedulerService) syncEvents(ctx context.Context, start time.Time, end time.Time) (map[string]int, error) {
+
+	societiesPortalService := NewSocietiesPortalService(s.Config, s.Datastore)
+
+	allEvents, err := societiesPortalService.GetAllEvents(ctx, start, end)
+	if err != nil {
+		logging.FromContext(ctx).WithField("error", err).Warn("Failed to get events from the societies portal")
+		return nil, err
+	}
 
 	eventDetailsIDs := []int{}
 	for _, event := range allEvents {
@@ -43,10 +483,10 @@ func (s *SchedulerService) DoGetAllEvents() {
 
 	// Here we're getting all the event details for every event and ingoring
 	// duplicate eventDetailsID, no point duplicating work.
-	allEventDetails, err := societiesPortalService.GetAllEventsDetails(eventDetailsIDs)
+	allEventDetails, err := societiesPortalService.GetAllEventsDetails(ctx, eventDetailsIDs)
 	if err != nil {
-		log.Warn("getAllEventsDetails Function Failed")
-		return
+		logging.FromContext(ctx).WithField("error", err).Warn("Failed to get event details from the societies portal")
+		return nil, err
 	}
 
 	allEventsWithEventDetails := []models.EventDetails{}
@@ -58,29 +498,122 @@ func (s *SchedulerService) DoGetAllEvents() {
 
 	// convert societies portal events to database events
 	allDatabaseEvents := []models.DatabaseEvent{}
+	skipped := 0
 	for _, event := range allEventsWithEventDetails {
-		allDatabaseEvents = append(allDatabaseEvents, event.ToDatabaseEvent())
+		databaseEvent, err := event.ToDatabaseEvent()
+		if err != nil {
+			logging.FromContext(ctx).WithFields(log.Fields{"error": err, "eventDetailsID": event.EventDetailsID}).Warn("Failed to convert event, skipping it")
+			skipped++
+			continue
+		}
+		allDatabaseEvents = append(allDatabaseEvents, databaseEvent)
 	}
 
-	err = s.Datastore.UpsertEvents(allDatabaseEvents)
+	err = s.Datastore.UpsertEvents(ctx, allDatabaseEvents)
 	if err != nil {
-		log.Warn("Datastore.upsertEvents Function Failed")
-		return
+		logging.FromContext(ctx).WithField("error", err).Warn("Failed to store the synced events")
+		return nil, err
 	}
+
+	return map[string]int{"events": len(allDatabaseEvents), "skipped": skipped}, nil
 }
 
-func NewSchedulerService(config *config.Config) *SchedulerService {
-	return &SchedulerService{
+func NewSchedulerService(config *config.Config, datastore Datastore) *SchedulerService {
+	s := &SchedulerService{
 		Config:    config,
-		Datastore: NewDatastore(config),
+		Datastore: datastore,
 		Scheduler: gocron.NewScheduler(time.UTC),
+		Replica:   newReplicaID(),
+		lockTTL:   config.Scheduler.LockTTL,
 	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	if s.lockTTL <= 0 {
+		s.lockTTL = defaultLockTTL
+	}
+	s.Register(JobSyncUpcomingEvents, "5m", s.syncUpcomingEvents)
+	s.Register(JobSyncAllEvents, "1h", s.syncAllEvents)
+	s.Register(JobDiscoverSocieties, "24h", s.discoverSocieties)
+
+	for name := range config.Scheduler.Jobs {
+		if s.Job(name) == nil {
+			log.WithField("job", name).Warn("Config overrides a job that doesn't exist")
+		}
+	}
+	return s
 }
 
-func (s *SchedulerService) RunAllServices() {
-	var doGetAllEventsTask = s.DoGetAllEvents
+// Names this replica after its host, which is its container in Docker, with a
+// random suffix in case the host runs more than one
+func newReplicaID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "api"
+	}
+	b := make([]byte, 4)
+	rand.Read(b)
+	return hostname + "-" + hex.EncodeToString(b)
+}
 
+// RunAllServices schedules every job that isn't disabled and starts the
+// scheduler
+func (s *SchedulerService) RunAllServices() {
 	log.Info("Starting Scheduler")
-	s.Scheduler.Every("5m").Do(doGetAllEventsTask)
+	for _, job := range s.jobs {
+		if job.Disabled {
+			log.WithField("job", job.Name).Info("Job is disabled, it only runs when triggered")
+			continue
+		}
+
+		scheduled, err := s.schedule(job)
+		if err != nil {
+			log.WithFields(log.Fields{"error": err, "job": job.Name, "schedule": job.Schedule}).Error("Failed to schedule job")
+			continue
+		}
+		job.mu.Lock()
+		job.scheduled = scheduled
+		job.mu.Unlock()
+	}
 	s.Scheduler.StartAsync()
 }
+
+// Stop stops scheduling jobs and cancels the runs in progress, waiting until
+// ctx is done for them to finish. Locks still held by then are released, so
+// another replica can take the jobs over straight away.
+func (s *SchedulerService) Stop(ctx context.Context) error {
+	log.Info("Stopping Scheduler")
+	s.mu.Lock()
+	s.cancel()
+	s.mu.Unlock()
+
+	stopped := make(chan struct{})
+	go func() {
+		// Waits for scheduled runs, but triggered and caught up runs aren't
+		// gocron's to wait for
+		s.Scheduler.Stop()
+		s.running.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+	}
+
+	for _, job := range s.jobs {
+		if job.isRunning() {
+			log.WithField("job", job.Name).Warn("Job is still running, releasing its lock")
+			s.releaseLock(job)
+		}
+	}
+	return fmt.Errorf("jobs are still running: %w", ctx.Err())
+}
+
+// Schedules job at an interval, or by cron expression if its schedule isn't
+// a duration
+func (s *SchedulerService) schedule(job *Job) (*gocron.Job, error) {
+	if _, err := time.ParseDuration(job.Schedule); err == nil {
+		return s.Scheduler.Every(job.Schedule).Do(s.runScheduledJob, job)
+	}
+	return s.Scheduler.Cron(job.Schedule).Do(s.runScheduledJob, job)
+}
@@ -0,0 +1,364 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nuigcompsoc/api/internal/config"
+	"github.com/nuigcompsoc/api/internal/models"
+)
+
+// Waits for job to finish running, failing the test if it takes too long
+func waitForJob(t *testing.T, job *Job) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		job.mu.Lock()
+		running := job.runningSince != nil
+		job.mu.Unlock()
+		if !running {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("%v is still running", job.Name)
+}
+
+func TestSchedulerJobConfig(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Scheduler.Jobs = map[string]config.JobConfig{
+		JobSyncUpcomingEvents: {Schedule: "*/10 * * * *"},
+		JobDiscoverSocieties:  {Disabled: true},
+	}
+	s := NewSchedulerService(cfg, NewMemoryDatastore())
+
+	if job := s.Job(JobSyncUpcomingEvents); job.Schedule != "*/10 * * * *" || job.Disabled {
+		t.Errorf("%v has schedule %q and disabled %v", job.Name, job.Schedule, job.Disabled)
+	}
+	if job := s.Job(JobDiscoverSocieties); job.Schedule != "24h" || !job.Disabled {
+		t.Errorf("%v has schedule %q and disabled %v", job.Name, job.Schedule, job.Disabled)
+	}
+	if job := s.Job("missing"); job != nil {
+		t.Errorf("found a job that doesn't exist: %+v", job)
+	}
+}
+
+func TestSchedulerJobRuns(t *testing.T) {
+	datastore := NewMemoryDatastore()
+	s := NewSchedulerService(&config.Config{}, datastore)
+	release := make(chan struct{})
+	runs := 0
+	// On a cron schedule, so the schedule runs it even though it just ran
+	job := s.Register("test", "0 * * * *", func(ctx context.Context) (map[string]int, error) {
+		runs++
+		<-release
+		if runs > 1 {
+			return nil, errors.New("second run failed")
+		}
+		return map[string]int{"things": 2}, nil
+	})
+
+	if err := s.TriggerJob(context.Background(), "test", "tester"); err != nil {
+		t.Fatal(err)
+	}
+	// Neither a trigger nor the schedule may run the job while it's running
+	if err := s.TriggerJob(context.Background(), "test", "tester"); !errors.Is(err, models.ErrConflict) {
+		t.Errorf("triggering a running job failed with %v, want a conflict", err)
+	}
+	s.runScheduledJob(job)
+	if err := s.TriggerJob(context.Background(), "missing", "tester"); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("triggering a missing job failed with %v, want not found", err)
+	}
+
+	status, err := s.JobStatus(context.Background(), job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.Running || status.RunningSince == nil {
+		t.Errorf("running job has status %+v", status)
+	}
+
+	close(release)
+	waitForJob(t, job)
+	s.runScheduledJob(job)
+
+	status, err = s.JobStatus(context.Background(), job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Running || len(status.RecentRuns) != 2 || runs != 2 {
+		t.Fatalf("job ran %v times and has status %+v", runs, status)
+	}
+	failed, succeeded := status.RecentRuns[0], status.RecentRuns[1]
+	if failed.Trigger != models.JobTriggerSchedule || failed.Outcome != models.JobFailed || failed.Error != "second run failed" {
+		t.Errorf("scheduled run is %+v", failed)
+	}
+	if succeeded.Trigger != models.JobTriggerManual || succeeded.TriggeredBy != "tester" || succeeded.Outcome != models.JobSucceeded || succeeded.Counts["things"] != 2 {
+		t.Errorf("triggered run is %+v", succeeded)
+	}
+}
+
+// Replicas of the API each have a scheduler, sharing a datastore
+func TestSchedulerReplicas(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Scheduler.LockTTL = 60 * time.Millisecond
+	datastore := NewMemoryDatastore()
+	release := make(chan struct{})
+	var mu sync.Mutex
+	ranOn := []string{}
+	replicas := []*SchedulerService{}
+	for i := 0; i < 3; i++ {
+		s := NewSchedulerService(cfg, datastore)
+		s.Register("test", "1h", func(ctx context.Context) (map[string]int, error) {
+			mu.Lock()
+			ranOn = append(ranOn, s.Replica)
+			mu.Unlock()
+			select {
+			case <-release:
+				return nil, nil
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		})
+		replicas = append(replicas, s)
+	}
+	first, second, third := replicas[0], replicas[1], replicas[2]
+	if first.Replica == second.Replica {
+		t.Fatalf("replicas share the ID %v", first.Replica)
+	}
+
+	if err := first.TriggerJob(context.Background(), "test", "tester"); err != nil {
+		t.Fatal(err)
+	}
+	// Outlasting the lease, which the first replica keeps renewing
+	time.Sleep(3 * cfg.Scheduler.LockTTL)
+	if err := second.TriggerJob(context.Background(), "test", "tester"); !errors.Is(err, models.ErrConflict) {
+		t.Errorf("triggering a job running on another replica failed with %v, want a conflict", err)
+	}
+	second.runScheduledJob(second.Job("test"))
+
+	status, err := third.JobStatus(context.Background(), third.Job("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.Running || status.RunningOn != first.Replica {
+		t.Errorf("other replicas see the job's status as %+v", status)
+	}
+
+	close(release)
+	waitForJob(t, first.Job("test"))
+	// The first replica only just ran the job, so the others skip their turn
+	second.runScheduledJob(second.Job("test"))
+	third.runScheduledJob(third.Job("test"))
+	if len(ranOn) != 1 || ranOn[0] != first.Replica {
+		t.Errorf("job ran on %v, want only %v", ranOn, first.Replica)
+	}
+
+	runs, err := datastore.GetJobRuns(context.Background(), "test", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 1 || runs[0].Replica != first.Replica {
+		t.Errorf("runs are %+v", runs)
+	}
+}
+
+func TestSchedulerLockTakeover(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Scheduler.LockTTL = 60 * time.Millisecond
+	datastore := NewMemoryDatastore()
+	s := NewSchedulerService(cfg, datastore)
+	runs := 0
+	job := s.Register("test", "0 * * * *", func(ctx context.Context) (map[string]int, error) {
+		runs++
+		return nil, nil
+	})
+
+	// A replica that died while running the job holds it until its lease lapses
+	if _, err := datastore.AcquireLock(context.Background(), "test", "dead", cfg.Scheduler.LockTTL); err != nil {
+		t.Fatal(err)
+	}
+	s.runScheduledJob(job)
+	if runs != 0 {
+		t.Fatal("job ran while another replica held it")
+	}
+
+	time.Sleep(2 * cfg.Scheduler.LockTTL)
+	s.runScheduledJob(job)
+	if runs != 1 {
+		t.Fatal("job didn't run once the dead replica's lease lapsed")
+	}
+	if _, err := datastore.GetLock(context.Background(), "test"); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("lock is still held after the job ran: %v", err)
+	}
+
+	// A replica that loses its lock partway through a run stops it
+	cancelled := make(chan error, 1)
+	s.Register("slow", "0 * * * *", func(ctx context.Context) (map[string]int, error) {
+		<-ctx.Done()
+		cancelled <- ctx.Err()
+		return nil, ctx.Err()
+	})
+	if err := s.TriggerJob(context.Background(), "slow", "tester"); err != nil {
+		t.Fatal(err)
+	}
+	if err := datastore.ReleaseLock(context.Background(), "slow", s.Replica); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := datastore.AcquireLock(context.Background(), "slow", "other", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-cancelled:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("run stopped with %v, want it cancelled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("run carried on after losing its lock")
+	}
+	waitForJob(t, s.Job("slow"))
+	if lock, err := datastore.GetLock(context.Background(), "slow"); err != nil || lock.Holder != "other" {
+		t.Errorf("the replica that took over has lost the lock: %+v, %v", lock, err)
+	}
+}
+
+func TestSchedulerStop(t *testing.T) {
+	datastore := NewMemoryDatastore()
+	s := NewSchedulerService(&config.Config{}, datastore)
+	s.Register("slow", "0 * * * *", func(ctx context.Context) (map[string]int, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	release := make(chan struct{})
+	defer close(release)
+	s.Register("stuck", "0 * * * *", func(ctx context.Context) (map[string]int, error) {
+		<-release
+		return nil, nil
+	})
+	s.RunAllServices()
+
+	for _, name := range []string{"slow", "stuck"} {
+		if err := s.TriggerJob(context.Background(), name, "tester"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The slow run is cancelled, but the stuck one ignores it
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if err := s.Stop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("stopped with %v, want it to give up on the stuck job", err)
+	}
+
+	runs, err := datastore.GetJobRuns(context.Background(), "slow", 1)
+	if err != nil || len(runs) != 1 || runs[0].Outcome != models.JobFailed {
+		t.Errorf("slow run wasn't cancelled: %+v, %v", runs, err)
+	}
+	for _, name := range []string{"slow", "stuck"} {
+		if _, err := datastore.GetLock(context.Background(), name); !errors.Is(err, models.ErrNotFound) {
+			t.Errorf("%v's lock is still held after stopping: %v", name, err)
+		}
+	}
+	if err := s.TriggerJob(context.Background(), "slow", "tester"); err == nil {
+		t.Error("triggered a job after the scheduler stopped")
+	}
+}
+
+func TestSchedulerEventSync(t *testing.T) {
+	// The windows the portal is asked for events in, empty for all of them
+	var mu sync.Mutex
+	windows := [][2]string{}
+	portal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		windows = append(windows, [2]string{r.URL.Query().Get("start"), r.URL.Query().Get("end")})
+		mu.Unlock()
+		w.Write([]byte("[]"))
+	}))
+	defer portal.Close()
+	requested := func() [][2]string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([][2]string{}, windows...)
+	}
+
+	cfg := &config.Config{}
+	cfg.SocsPortal.AjaxEndpoint = portal.URL
+	cfg.Scheduler.Sync.UpcomingBehind = time.Hour
+	cfg.Scheduler.Sync.UpcomingAhead = 48 * time.Hour
+	datastore := NewMemoryDatastore()
+	s := NewSchedulerService(cfg, datastore)
+	upcoming, full := s.Job(JobSyncUpcomingEvents), s.Job(JobSyncAllEvents)
+
+	if last, err := s.LastEventSync(context.Background()); err != nil || !last.IsZero() {
+		t.Errorf("events were last synced at %v, %v before ever syncing", last, err)
+	}
+
+	// The full sync has never run, so the upcoming sync catches it up
+	if err := s.TriggerJob(context.Background(), JobSyncUpcomingEvents, "tester"); err != nil {
+		t.Fatal(err)
+	}
+	waitForJob(t, upcoming)
+	waitForJob(t, full)
+	got := requested()
+	if len(got) != 2 {
+		t.Fatalf("portal was asked for %v, want the upcoming window then everything", got)
+	}
+	start, err := time.Parse(time.RFC3339, got[0][0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	end, err := time.Parse(time.RFC3339, got[0][1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if window := end.Sub(start); window < 48*time.Hour || window > 50*time.Hour {
+		t.Errorf("upcoming window is %v to %v", start, end)
+	}
+	if got[1] != [2]string{} {
+		t.Errorf("full sync asked for the window %v", got[1])
+	}
+	runs, err := datastore.GetJobRuns(context.Background(), JobSyncAllEvents, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 1 || runs[0].Trigger != models.JobTriggerCatchUp || runs[0].Outcome != models.JobSucceeded {
+		t.Errorf("full sync runs are %+v", runs)
+	}
+	if last, err := s.LastEventSync(context.Background()); err != nil || time.Since(last) > time.Minute {
+		t.Errorf("events were last synced at %v, %v just after syncing", last, err)
+	}
+
+	// Until the full sync is overdue again, the upcoming sync is left alone
+	if err := s.TriggerJob(context.Background(), JobSyncUpcomingEvents, "tester"); err != nil {
+		t.Fatal(err)
+	}
+	waitForJob(t, upcoming)
+	waitForJob(t, full)
+	if got := requested(); len(got) != 3 {
+		t.Errorf("portal was asked for %v, want only another upcoming window", got)
+	}
+
+	// The full sync only goes back as far as its history when it's set
+	cfg.Scheduler.Sync.History = 30 * 24 * time.Hour
+	if err := s.TriggerJob(context.Background(), JobSyncAllEvents, "tester"); err != nil {
+		t.Fatal(err)
+	}
+	waitForJob(t, full)
+	got = requested()
+	if len(got) != 4 {
+		t.Fatalf("portal was asked for %v, want a full sync window", got)
+	}
+	start, err = time.Parse(time.RFC3339, got[3][0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if age := time.Since(start); age < 30*24*time.Hour || age > 30*24*time.Hour+time.Minute {
+		t.Errorf("full sync window starts at %v", start)
+	}
+}
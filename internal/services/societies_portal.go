@@ -1,22 +1,30 @@
 package services
 
 import (
+	"context"
 	b64 "encoding/base64"
 	"encoding/json"
 	"errors"
+	"html"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/nuigcompsoc/api/internal/config"
+	"github.com/nuigcompsoc/api/internal/logging"
+	"github.com/nuigcompsoc/api/internal/metrics"
 	"github.com/nuigcompsoc/api/internal/models"
+	"github.com/nuigcompsoc/api/internal/tracing"
 
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/codes"
 	"golang.org/x/exp/slices"
 )
 
 type SocietiesPortalService struct {
-	Datastore                                *MongoDatastore
+	Datastore                                Datastore
 	WebservicesEndpoint                      string
 	AjaxEndpoint                             string
 	WebservicesUsername                      string
@@ -30,7 +38,7 @@ type SocietiesPortalService struct {
 	EventServiceAction                       string
 }
 
-func NewSocietiesPortalService(config *config.Config, datastore *MongoDatastore) *SocietiesPortalService {
+func NewSocietiesPortalService(config *config.Config, datastore Datastore) *SocietiesPortalService {
 	return &SocietiesPortalService{
 		Datastore:                                datastore,
 		WebservicesEndpoint:                      config.SocsPortal.WebservicesEndpoint,
@@ -52,7 +60,7 @@ func NewSocietiesPortalService(config *config.Config, datastore *MongoDatastore)
 // details anyways. So we've to contact the Socs Portal again on a seperate
 // API for every eventID we get. This function just returns an array of
 // eventDetailsIDs as strings.
-func (s *SocietiesPortalService) GetEventsForSocID(socID string) ([]models.Event, error) {
+func (s *SocietiesPortalService) GetEventsForSocID(ctx context.Context, socID string) ([]models.Event, error) {
 	/*
 		A response from the societies portal will look like this:
 		[
@@ -77,9 +85,9 @@ func (s *SocietiesPortalService) GetEventsForSocID(socID string) ([]models.Event
 		]
 	*/
 
-	req, err := http.NewRequest("GET", s.AjaxEndpoint, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", s.AjaxEndpoint, nil)
 	if err != nil {
-		log.WithField("error", err.Error()).Warn("Could not create a request to SocsPortal ajax endpoint")
+		logging.FromContext(ctx).WithField("error", err).Warn("Could not create a request to SocsPortal ajax endpoint")
 		return nil, err
 	}
 
@@ -89,23 +97,23 @@ func (s *SocietiesPortalService) GetEventsForSocID(socID string) ([]models.Event
 	q.Add("action", b64.StdEncoding.EncodeToString([]byte(s.EventServiceAction)))
 	req.URL.RawQuery = q.Encode()
 
-	res, err := http.DefaultClient.Do(req)
+	res, err := s.do(req, "events_for_society")
 	if err != nil {
-		log.WithField("error", err.Error()).Warn("Could not make a request to SocsPortal endpoint")
+		logging.FromContext(ctx).WithField("error", err).Warn("Could not make a request to SocsPortal endpoint")
 		return nil, err
 	}
 	defer res.Body.Close()
 
 	if res.StatusCode != http.StatusOK {
 		err := errors.New("Socs Portal is not returning a status Ok (200)")
-		log.Warn("error: ", err.Error())
+		logging.FromContext(ctx).WithField("status", res.StatusCode).Warn("Socs Portal is not returning a status Ok (200)")
 		return nil, err
 	}
 
 	var data []models.Event
 	err = json.NewDecoder(res.Body).Decode(&data)
 	if err != nil {
-		log.WithField("error", err.Error()).Warn("Could not decode JSON response from Socs Portal into interface")
+		logging.FromContext(ctx).WithField("error", err).Warn("Could not decode JSON response from Socs Portal into interface")
 		return nil, err
 	}
 
@@ -115,7 +123,7 @@ func (s *SocietiesPortalService) GetEventsForSocID(socID string) ([]models.Event
 // Here we're gettings the eventDetailsIDs and contacting the Socs Poral to get
 // details on every event. The idea then is to save them to the database so we're
 // not annoying Socs Portal every time we want to find out about our events.
-func (s *SocietiesPortalService) GetAllEventsDetails(eventDetailIDs []int) (map[int]models.EventDetails, error) {
+func (s *SocietiesPortalService) GetAllEventsDetails(ctx context.Context, eventDetailIDs []int) (map[int]models.EventDetails, error) {
 	/*
 		A response from the societies portal will look like this:
 		[
@@ -150,9 +158,9 @@ func (s *SocietiesPortalService) GetAllEventsDetails(eventDetailIDs []int) (map[
 
 	eventsDetails := map[int]models.EventDetails{}
 	for _, eventDetailsID := range eventDetailIDs {
-		req, err := http.NewRequest("GET", s.AjaxEndpoint, nil)
+		req, err := http.NewRequestWithContext(ctx, "GET", s.AjaxEndpoint, nil)
 		if err != nil {
-			log.WithField("error", err.Error()).Warn("Could not create a request to SocsPortal ajax endpoint")
+			logging.FromContext(ctx).WithField("error", err).Warn("Could not create a request to SocsPortal ajax endpoint")
 			return nil, err
 		}
 
@@ -163,23 +171,23 @@ func (s *SocietiesPortalService) GetAllEventsDetails(eventDetailIDs []int) (map[
 		q.Add("action", b64.StdEncoding.EncodeToString([]byte(s.EventServiceAction)))
 		req.URL.RawQuery = q.Encode()
 
-		res, err := http.DefaultClient.Do(req)
+		res, err := s.do(req, "event_details")
 		if err != nil {
-			log.WithField("error", err.Error()).Warn("Could not make a request to SocsPortal endpoint")
+			logging.FromContext(ctx).WithField("error", err).Warn("Could not make a request to SocsPortal endpoint")
 			return nil, err
 		}
 		defer res.Body.Close()
 
 		if res.StatusCode != http.StatusOK {
 			err := errors.New("Socs Portal is not returning a status Ok (200)")
-			log.Warn("error: ", err.Error())
+			logging.FromContext(ctx).WithField("status", res.StatusCode).Warn("Socs Portal is not returning a status Ok (200)")
 			return nil, err
 		}
 
 		data := []models.EventDetails{}
 		err = json.NewDecoder(res.Body).Decode(&data)
 		if err != nil {
-			log.WithField("error", err.Error()).Warn("Could not decode JSON response from Socs Portal into interface")
+			logging.FromContext(ctx).WithField("error", err).Warn("Could not decode JSON response from Socs Portal into interface")
 			return nil, err
 		}
 		eventsDetails[data[0].EventDetailsID] = data[0]
@@ -188,10 +196,47 @@ func (s *SocietiesPortalService) GetAllEventsDetails(eventDetailIDs []int) (map[
 	return eventsDetails, nil
 }
 
-func (s *SocietiesPortalService) GetAllEvents(onlyUpcomingEvents bool) ([]models.Event, error) {
-	req, err := http.NewRequest("GET", s.AjaxEndpoint, nil)
+// GetAllEvents asks the portal for the events of the societies we track,
+// only those between start and end unless they're zero
+func (s *SocietiesPortalService) GetAllEvents(ctx context.Context, start time.Time, end time.Time) ([]models.Event, error) {
+	if start.IsZero() || end.IsZero() {
+		logging.FromContext(ctx).Info("Requesting all events")
+	} else {
+		logging.FromContext(ctx).WithFields(log.Fields{"start": start, "end": end}).Info("Requesting events between start and end")
+	}
+	events, err := s.requestEvents(ctx, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	societies, err := s.Datastore.GetAllSocieties(ctx)
 	if err != nil {
-		log.WithField("error", err.Error()).Warn("Could not create a request to SocsPortal ajaxendpoint")
+		return nil, err
+	}
+
+	socIDs := make([]int, len(societies))
+	index := 0
+	for _, society := range societies {
+		socIDs[index] = int(society.SocietiesPortalID)
+		index++
+	}
+
+	eventsWeWant := []models.Event{}
+	for _, event := range events {
+		if slices.Contains(socIDs, event.OwnerID) {
+			eventsWeWant = append(eventsWeWant, event)
+		}
+	}
+
+	return eventsWeWant, nil
+}
+
+// Asks the portal for the events of every society, only those between start
+// and end unless they're zero
+func (s *SocietiesPortalService) requestEvents(ctx context.Context, start time.Time, end time.Time) ([]models.Event, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", s.AjaxEndpoint, nil)
+	if err != nil {
+		logging.FromContext(ctx).WithField("error", err).Warn("Could not create a request to SocsPortal ajaxendpoint")
 		return nil, err
 	}
 
@@ -199,62 +244,100 @@ func (s *SocietiesPortalService) GetAllEvents(onlyUpcomingEvents bool) ([]models
 	q.Add("object", b64.StdEncoding.EncodeToString([]byte(s.EventService)))
 	q.Add("method", b64.StdEncoding.EncodeToString([]byte(s.EventServiceMethodAll)))
 	q.Add("action", b64.StdEncoding.EncodeToString([]byte(s.EventServiceAction)))
-	if !onlyUpcomingEvents {
-		log.Info("Requesting only upcoming events")
-		q.Add("start", time.Now().UTC().Format(time.RFC3339))
-		q.Add("end", time.Now().UTC().AddDate(1, 0, 0).Format(time.RFC3339))
-	} else {
-		log.Info("Requesting all events")
+	if !start.IsZero() && !end.IsZero() {
+		q.Add("start", start.Format(time.RFC3339))
+		q.Add("end", end.Format(time.RFC3339))
 	}
 	req.URL.RawQuery = q.Encode()
 
-	res, err := http.DefaultClient.Do(req)
+	res, err := s.do(req, "all_events")
 	if err != nil {
-		log.WithField("error", err.Error()).Warn("Could not make a request to SocsPortal endpoint")
+		logging.FromContext(ctx).WithField("error", err).Warn("Could not make a request to SocsPortal endpoint")
 		return nil, err
 	}
 	defer res.Body.Close()
 
 	if res.StatusCode != http.StatusOK {
 		err := errors.New("Socs Portal is not returning a status Ok (200)")
-		log.Warn("error: ", err.Error())
+		logging.FromContext(ctx).WithField("status", res.StatusCode).Warn("Socs Portal is not returning a status Ok (200)")
 		return nil, err
 	}
 
 	events := []models.Event{}
 	err = json.NewDecoder(res.Body).Decode(&events)
 	if err != nil {
-		log.WithField("error", err.Error()).Warn("Could not decode JSON response from Socs Portal into interface")
+		logging.FromContext(ctx).WithField("error", err).Warn("Could not decode JSON response from Socs Portal into interface")
 		return nil, err
 	}
 
-	societies, err := s.Datastore.GetAllSocieties()
+	return events, nil
+}
+
+// DiscoverSocieties looks through every event on the portal for societies we
+// don't track, proposing them for an admin to approve. It returns the
+// proposals still waiting on an admin.
+func (s *SocietiesPortalService) DiscoverSocieties(ctx context.Context) ([]models.SocietyProposal, error) {
+	events, err := s.requestEvents(ctx, time.Time{}, time.Time{})
 	if err != nil {
 		return nil, err
 	}
 
-	socIDs := make([]int, len(societies))
-	index := 0
+	societies, err := s.Datastore.GetAllSocieties(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	proposals := proposeSocieties(events, societies, time.Now().UTC())
+	if err := s.Datastore.UpsertSocietyProposals(ctx, proposals); err != nil {
+		return nil, err
+	}
+
+	return s.Datastore.GetSocietyProposals(ctx, models.ProposalPending)
+}
+
+// Proposes the owners of events, identified by their ownerID and named by
+// their ownerTitle, unless we track them already
+func proposeSocieties(events []models.Event, societies map[string]models.Society, now time.Time) []models.SocietyProposal {
+	tracked := map[int32]bool{}
 	for _, society := range societies {
-		socIDs[index] = int(society.SocietiesPortalID)
-		index++
+		tracked[society.SocietiesPortalID] = true
 	}
 
-	eventsWeWant := []models.Event{}
+	proposals := []models.SocietyProposal{}
+	indexes := map[int32]int{}
 	for _, event := range events {
-		if slices.Contains(socIDs, event.OwnerID) {
-			eventsWeWant = append(eventsWeWant, event)
+		socID := int32(event.OwnerID)
+		if socID <= 0 || tracked[socID] {
+			continue
+		}
+
+		i, ok := indexes[socID]
+		if !ok {
+			i = len(proposals)
+			indexes[socID] = i
+			proposals = append(proposals, models.SocietyProposal{
+				SocietiesPortalID: socID,
+				Name:              "Society " + strconv.Itoa(event.OwnerID),
+				FirstSeen:         now,
+				LastSeen:          now,
+				Status:            models.ProposalPending,
+			})
+		}
+
+		if name := strings.TrimSpace(html.UnescapeString(event.OwnerTitle)); name != "" {
+			proposals[i].Name = name
 		}
+		proposals[i].EventCount++
 	}
 
-	return eventsWeWant, nil
+	return proposals
 }
 
-func (s *SocietiesPortalService) GetMemberFromSocietiesPortal(memberID string) (*models.SocietyMember, error) {
+func (s *SocietiesPortalService) GetMemberFromSocietiesPortal(ctx context.Context, memberID string) (*models.SocietyMember, error) {
 
-	req, err := http.NewRequest("GET", s.WebservicesEndpoint, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", s.WebservicesEndpoint, nil)
 	if err != nil {
-		log.WithField("error", err.Error()).Warn("Could not create a request to SocsPortal webservices endpoint")
+		logging.FromContext(ctx).WithField("error", err).Warn("Could not create a request to SocsPortal webservices endpoint")
 		return nil, err
 	}
 
@@ -267,9 +350,9 @@ func (s *SocietiesPortalService) GetMemberFromSocietiesPortal(memberID string) (
 	q.Add("encodeOutput", b64.StdEncoding.EncodeToString([]byte("true")))
 	req.URL.RawQuery = q.Encode()
 
-	res, err := http.DefaultClient.Do(req)
+	res, err := s.do(req, "member")
 	if err != nil {
-		log.WithField("error", err.Error()).Warn("Could not make a request to SocsPortal endpoint")
+		logging.FromContext(ctx).WithField("error", err).Warn("Could not make a request to SocsPortal endpoint")
 		return nil, err
 	}
 	defer res.Body.Close()
@@ -277,7 +360,7 @@ func (s *SocietiesPortalService) GetMemberFromSocietiesPortal(memberID string) (
 	data := map[string]string{}
 	err = json.NewDecoder(res.Body).Decode(&data)
 	if err != nil {
-		log.WithField("error", err.Error()).Warn("Could not decode JSON response from Socs Portal into interface")
+		logging.FromContext(ctx).WithField("error", err).Warn("Could not decode JSON response from Socs Portal into interface")
 		return nil, err
 	}
 
@@ -289,9 +372,29 @@ func (s *SocietiesPortalService) GetMemberFromSocietiesPortal(memberID string) (
 	member := models.SocietyMember{}
 	err = json.NewDecoder(res.Body).Decode(&data)
 	if err != nil {
-		log.WithField("error", err.Error()).Warn("Could not decode JSON response from Socs Portal into SocietyMember struct")
+		logging.FromContext(ctx).WithField("error", err).Warn("Could not decode JSON response from Socs Portal into SocietyMember struct")
 		return nil, err
 	}
 
 	return &member, nil
 }
+
+// Traces requests to the societies portal, propagating the trace to it
+var portalClient = &http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport)}
+
+// Sends a request to the societies portal, recording how it went under operation
+func (s *SocietiesPortalService) do(req *http.Request, operation string) (*http.Response, error) {
+	ctx, span := tracing.Tracer().Start(req.Context(), "societies_portal."+operation)
+	defer span.End()
+
+	start := time.Now()
+	res, err := portalClient.Do(req.WithContext(ctx))
+	metrics.ObservePortalRequest(operation, res, err, time.Since(start))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	} else if res.StatusCode != http.StatusOK {
+		span.SetStatus(codes.Error, res.Status)
+	}
+	return res, err
+}
@@ -0,0 +1,63 @@
+package services
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/nuigcompsoc/api/internal/config"
+	"github.com/nuigcompsoc/api/internal/logging"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestSocietiesPortalLogs(t *testing.T) {
+	portal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer portal.Close()
+
+	// The failures are expected, so only the hook should see them
+	hook := test.NewLocal(log.StandardLogger())
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	cfg := &config.Config{}
+	cfg.SocsPortal.AjaxEndpoint = portal.URL
+	datastore := NewMemoryDatastore()
+
+	// Logged against the request that asked for the events
+	ctx := logging.WithEntry(context.Background(), log.WithField("request_id", "portal-test"))
+	if _, err := NewSocietiesPortalService(cfg, datastore).GetAllEvents(ctx, time.Time{}, time.Time{}); err == nil {
+		t.Fatal("got events from a failing portal")
+	}
+	entry := hook.LastEntry()
+	if entry == nil || entry.Data["request_id"] != "portal-test" || entry.Data["status"] != http.StatusBadGateway {
+		t.Errorf("portal failure logged as %+v", entry)
+	}
+
+	// Or against the job run that did
+	hook.Reset()
+	s := NewSchedulerService(cfg, datastore)
+	if err := s.TriggerJob(context.Background(), JobSyncAllEvents, "tester"); err != nil {
+		t.Fatal(err)
+	}
+	waitForJob(t, s.Job(JobSyncAllEvents))
+	logged := false
+	for _, entry := range hook.AllEntries() {
+		if entry.Data["status"] == http.StatusBadGateway {
+			logged = true
+			if entry.Data["job"] != JobSyncAllEvents || entry.Data["replica"] != s.Replica {
+				t.Errorf("portal failure logged without the job: %+v", entry.Data)
+			}
+		}
+	}
+	if !logged {
+		t.Error("portal failure wasn't logged")
+	}
+}
@@ -0,0 +1,1196 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nuigcompsoc/api/internal/config"
+	"github.com/nuigcompsoc/api/internal/logging"
+	"github.com/nuigcompsoc/api/internal/models"
+
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+	_ "modernc.org/sqlite"
+)
+
+// Drivers the datastore can be backed by, chosen with database.driver
+const (
+	DriverMongo    = "mongo"
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+)
+
+// SQLDatastore keeps everything in SQLite or PostgreSQL, for deployments that
+// would rather not run Mongo. It behaves as MongoDatastore does.
+type SQLDatastore struct {
+	db     *sql.DB
+	driver string
+
+	queryTimeout time.Duration
+}
+
+// OpenDatastore connects to the datastore chosen by database.driver. Its
+// schema may be out of date until Migrate is called.
+func OpenDatastore(ctx context.Context, config *config.Config) (Datastore, error) {
+	switch config.Database.Driver {
+	case DriverMongo, "":
+		return NewDatastore(config), nil
+	default:
+		return NewSQLDatastore(ctx, config.Database.Driver, config.Database.DSN, config.Database.QueryTimeout)
+	}
+}
+
+// NewSQLDatastore connects to the database at dsn, a file path for SQLite or
+// a connection URL for PostgreSQL
+func NewSQLDatastore(ctx context.Context, driver string, dsn string, queryTimeout time.Duration) (*SQLDatastore, error) {
+	if driver != DriverSQLite && driver != DriverPostgres {
+		return nil, fmt.Errorf("unsupported SQL driver %q", driver)
+	}
+
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %v database: %w", driver, err)
+	}
+	if driver == DriverSQLite {
+		// SQLite only allows one writer at a time, and every connection to
+		// :memory: would otherwise get a database of its own
+		db.SetMaxOpenConns(1)
+	}
+
+	if queryTimeout <= 0 {
+		queryTimeout = defaultQueryTimeout
+	}
+	ds := &SQLDatastore{db: db, driver: driver, queryTimeout: queryTimeout}
+
+	if err := ds.Ping(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to %v database: %w", driver, err)
+	}
+
+	return ds, nil
+}
+
+func (ds *SQLDatastore) Ping(ctx context.Context) error {
+	return ds.db.PingContext(ctx)
+}
+
+// Close closes the connections to the database
+func (ds *SQLDatastore) Close(ctx context.Context) error {
+	return ds.db.Close()
+}
+
+/*
+ *	Schema
+ */
+
+// UpsertSociety used to let societies share a portal ID
+const sqlUniqueSocietyPortalIDs = `CREATE UNIQUE INDEX societies_portal_id ON societies (societies_portal_id)`
+
+// sqlMigrationChecks run before the migrations they're keyed by, failing them
+// when the data needs an admin's attention first
+var sqlMigrationChecks = map[string]func(ctx context.Context, tx *sql.Tx) error{
+	sqlUniqueSocietyPortalIDs: checkSQLSocietyPortalIDs,
+}
+
+// sqlMigrations are applied in order, each exactly once. Never edit one that
+// has been released, add another instead. Datetimes are kept as Unix
+// nanoseconds so that they compare and sort the same in every database.
+var sqlMigrations = []string{
+	`CREATE TABLE societies (
+		name                TEXT PRIMARY KEY,
+		societies_portal_id INTEGER NOT NULL
+	)`,
+	`CREATE TABLE events (
+		event_id                   INTEGER NOT NULL,
+		event_details_id           INTEGER NOT NULL,
+		title                      TEXT NOT NULL,
+		society_id                 INTEGER NOT NULL,
+		society_name               TEXT NOT NULL,
+		event_type                 TEXT NOT NULL,
+		location                   TEXT NOT NULL,
+		location_type              TEXT NOT NULL,
+		description                TEXT NOT NULL,
+		description_markdown       TEXT NOT NULL,
+		dangerous_description_html TEXT NOT NULL,
+		start_datetime             BIGINT NOT NULL,
+		end_datetime               BIGINT NOT NULL,
+		datetime_formatted         TEXT NOT NULL,
+		event_url                  TEXT NOT NULL,
+		event_ical_url             TEXT NOT NULL,
+		status                     TEXT NOT NULL,
+		sequence                   INTEGER NOT NULL,
+		updated_at                 BIGINT NOT NULL,
+		content_hash               TEXT NOT NULL,
+		PRIMARY KEY (event_details_id, event_id)
+	)`,
+	`CREATE INDEX events_start ON events (start_datetime, event_details_id, event_id)`,
+	`CREATE INDEX events_end ON events (end_datetime)`,
+	`CREATE INDEX events_society ON events (society_id, start_datetime)`,
+	`ALTER TABLE societies ADD COLUMN slug TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE societies ADD COLUMN description TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE societies ADD COLUMN website TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE societies ADD COLUMN logo_url TEXT NOT NULL DEFAULT ''`,
+	// A JSON object of platform to URL
+	`ALTER TABLE societies ADD COLUMN social_links TEXT NOT NULL DEFAULT '{}'`,
+	`CREATE TABLE society_proposals (
+		societies_portal_id INTEGER PRIMARY KEY,
+		name                TEXT NOT NULL,
+		event_count         INTEGER NOT NULL,
+		first_seen          BIGINT NOT NULL,
+		last_seen           BIGINT NOT NULL,
+		status              TEXT NOT NULL,
+		decided_by          TEXT NOT NULL DEFAULT '',
+		decided_at          BIGINT
+	)`,
+	sqlUniqueSocietyPortalIDs,
+	// changes is a JSON array of field names, before_json and after_json are
+	// the society as JSON when it existed
+	`CREATE TABLE society_audit (
+		societies_portal_id INTEGER NOT NULL,
+		action              TEXT NOT NULL,
+		actor               TEXT NOT NULL,
+		changes             TEXT NOT NULL,
+		before_json         TEXT,
+		after_json          TEXT,
+		at                  BIGINT NOT NULL
+	)`,
+	`CREATE INDEX society_audit_society ON society_audit (societies_portal_id, at)`,
+	// counts is a JSON object of what the run got through
+	`CREATE TABLE job_runs (
+		job          TEXT NOT NULL,
+		trigger_type TEXT NOT NULL,
+		triggered_by TEXT NOT NULL DEFAULT '',
+		started_at   BIGINT NOT NULL,
+		finished_at  BIGINT NOT NULL,
+		outcome      TEXT NOT NULL,
+		counts       TEXT NOT NULL DEFAULT '{}',
+		error        TEXT NOT NULL DEFAULT ''
+	)`,
+	`CREATE INDEX job_runs_job ON job_runs (job, started_at)`,
+	`ALTER TABLE job_runs ADD COLUMN replica TEXT NOT NULL DEFAULT ''`,
+	`CREATE TABLE locks (
+		name        TEXT PRIMARY KEY,
+		holder      TEXT NOT NULL,
+		acquired_at BIGINT NOT NULL,
+		expires_at  BIGINT NOT NULL
+	)`,
+}
+
+// Migrate applies the migrations the database hasn't had yet, recording each
+// in schema_migrations in the same transaction
+func (ds *SQLDatastore) Migrate(ctx context.Context) error {
+	_, err := ds.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at BIGINT NOT NULL
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	var applied int
+	err = ds.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&applied)
+	if err != nil {
+		return fmt.Errorf("failed to find applied migrations: %w", err)
+	}
+
+	for i := applied; i < len(sqlMigrations); i++ {
+		version := i + 1
+		err := ds.inTx(ctx, func(tx *sql.Tx) error {
+			if check, ok := sqlMigrationChecks[sqlMigrations[i]]; ok {
+				if err := check(ctx, tx); err != nil {
+					return err
+				}
+			}
+			if _, err := tx.ExecContext(ctx, sqlMigrations[i]); err != nil {
+				return err
+			}
+			_, err := tx.ExecContext(ctx, ds.rebind(`INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)`), version, time.Now().UnixNano())
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to apply migration %v: %w", version, err)
+		}
+		logging.FromContext(ctx).WithField("version", version).Info("Applied SQL migration")
+	}
+
+	return nil
+}
+
+// Fails if societies share a portal ID, so an admin can pick which of them
+// to keep
+func checkSQLSocietyPortalIDs(ctx context.Context, tx *sql.Tx) error {
+	rows, err := tx.QueryContext(ctx, `SELECT societies_portal_id, name FROM societies WHERE societies_portal_id IN (
+		SELECT societies_portal_id FROM societies GROUP BY societies_portal_id HAVING COUNT(*) > 1
+	)`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	duplicates := duplicateSocieties{}
+	for rows.Next() {
+		var id int
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return err
+		}
+		duplicates[id] = append(duplicates[id], name)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return duplicates.err(ctx)
+}
+
+func (ds *SQLDatastore) inTx(ctx context.Context, f func(tx *sql.Tx) error) error {
+	tx, err := ds.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := f(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Queries are written with ? placeholders, which PostgreSQL knows as $1, $2...
+func (ds *SQLDatastore) rebind(query string) string {
+	if ds.driver != DriverPostgres {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+/*
+ *	Societies
+ */
+
+const societyColumns = `name, societies_portal_id, slug, description, website, logo_url, social_links`
+
+func societyValues(society models.Society) ([]interface{}, error) {
+	socialLinks, err := json.Marshal(society.SocialLinks)
+	if err != nil {
+		return nil, err
+	}
+	if society.SocialLinks == nil {
+		socialLinks = []byte("{}")
+	}
+	return []interface{}{
+		society.Name, society.SocietiesPortalID, society.Slug, society.Description, society.Website, society.LogoURL, string(socialLinks),
+	}, nil
+}
+
+func scanSociety(row rowScanner) (models.Society, error) {
+	var society models.Society
+	var socialLinks string
+	err := row.Scan(&society.Name, &society.SocietiesPortalID, &society.Slug, &society.Description, &society.Website, &society.LogoURL, &socialLinks)
+	if err != nil {
+		return society, err
+	}
+	if socialLinks != "{}" {
+		err = json.Unmarshal([]byte(socialLinks), &society.SocialLinks)
+	}
+	return society, err
+}
+
+func (ds *SQLDatastore) UpsertSociety(ctx context.Context, society models.Society, actor string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, ds.queryTimeout)
+	defer cancel()
+
+	changed := false
+	err := ds.inTx(ctx, func(tx *sql.Tx) error {
+		stored, err := ds.findSociety(ctx, tx, "name", society.Name)
+		if err == models.ErrNotFound {
+			changed = true
+			return ds.insertSociety(ctx, tx, society, actor)
+		}
+		if err != nil {
+			return err
+		}
+
+		society = mergeSocietyMetadata(society, *stored)
+		if len(stored.ChangedFields(society)) == 0 {
+			return nil
+		}
+		changed = true
+		return ds.replaceSociety(ctx, tx, stored, society, actor)
+	})
+	if err != nil && err != models.ErrConflict {
+		logging.FromContext(ctx).WithFields(log.Fields{"error": err, "society": society.Name}).Warn("Failed to update Society")
+	}
+	return changed && err == nil, err
+}
+
+func (ds *SQLDatastore) GetAllSocieties(ctx context.Context) (map[string]models.Society, error) {
+	ctx, cancel := context.WithTimeout(ctx, ds.queryTimeout)
+	defer cancel()
+
+	rows, err := ds.db.QueryContext(ctx, `SELECT `+societyColumns+` FROM societies`)
+	if err != nil {
+		logging.FromContext(ctx).WithField("error", err).Debug("Failed to query all rows in societies table")
+		return nil, err
+	}
+	defer rows.Close()
+
+	societies := map[string]models.Society{}
+	for rows.Next() {
+		society, err := scanSociety(rows)
+		if err != nil {
+			return nil, err
+		}
+		societies[society.Name] = society
+	}
+
+	return societies, rows.Err()
+}
+
+func (ds *SQLDatastore) GetSocietyBySocietyName(ctx context.Context, societyName string) (*models.Society, error) {
+	ctx, cancel := context.WithTimeout(ctx, ds.queryTimeout)
+	defer cancel()
+
+	society, err := scanSociety(ds.db.QueryRowContext(ctx, ds.rebind(`SELECT `+societyColumns+` FROM societies WHERE name = ?`), societyName))
+	if err == sql.ErrNoRows {
+		logging.FromContext(ctx).Infof("Society %v not found", societyName)
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		logging.FromContext(ctx).WithField("error", err).Warn("Failed to return single society from societies table")
+		return nil, err
+	}
+
+	return &society, nil
+}
+
+func (ds *SQLDatastore) GetSocietyBySocietiesPortalID(ctx context.Context, societiesPortalID int32) (*models.Society, error) {
+	ctx, cancel := context.WithTimeout(ctx, ds.queryTimeout)
+	defer cancel()
+
+	society, err := scanSociety(ds.db.QueryRowContext(ctx, ds.rebind(`SELECT `+societyColumns+` FROM societies WHERE societies_portal_id = ?`), societiesPortalID))
+	if err == sql.ErrNoRows {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		logging.FromContext(ctx).WithFields(log.Fields{"error": err, "societiesPortalID": societiesPortalID}).Warn("Failed to return single society from societies table")
+		return nil, err
+	}
+
+	return &society, nil
+}
+
+func (ds *SQLDatastore) CreateSociety(ctx context.Context, society models.Society, actor string) error {
+	ctx, cancel := context.WithTimeout(ctx, ds.queryTimeout)
+	defer cancel()
+
+	err := ds.inTx(ctx, func(tx *sql.Tx) error {
+		return ds.insertSociety(ctx, tx, society, actor)
+	})
+	if err != nil && err != models.ErrConflict {
+		logging.FromContext(ctx).WithFields(log.Fields{"error": err, "society": society.Name}).Warn("Failed to insert Society")
+	}
+	return err
+}
+
+func (ds *SQLDatastore) UpdateSociety(ctx context.Context, societiesPortalID int32, society models.Society, actor string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, ds.queryTimeout)
+	defer cancel()
+
+	changed := false
+	err := ds.inTx(ctx, func(tx *sql.Tx) error {
+		stored, err := ds.findSociety(ctx, tx, "societies_portal_id", societiesPortalID)
+		if err != nil {
+			return err
+		}
+		if len(stored.ChangedFields(society)) == 0 {
+			return nil
+		}
+		changed = true
+		return ds.replaceSociety(ctx, tx, stored, society, actor)
+	})
+	if err != nil && err != models.ErrConflict && err != models.ErrNotFound {
+		logging.FromContext(ctx).WithFields(log.Fields{"error": err, "society": society.Name}).Warn("Failed to update Society")
+	}
+	return changed && err == nil, err
+}
+
+func (ds *SQLDatastore) DeleteSociety(ctx context.Context, societiesPortalID int32, actor string) error {
+	ctx, cancel := context.WithTimeout(ctx, ds.queryTimeout)
+	defer cancel()
+
+	err := ds.inTx(ctx, func(tx *sql.Tx) error {
+		stored, err := ds.findSociety(ctx, tx, "societies_portal_id", societiesPortalID)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, ds.rebind(`DELETE FROM societies WHERE societies_portal_id = ?`), societiesPortalID); err != nil {
+			return err
+		}
+		return ds.recordSocietyAudit(ctx, tx, newSocietyAuditEntry(actor, stored, nil, time.Now().UTC()))
+	})
+	if err != nil && err != models.ErrNotFound {
+		logging.FromContext(ctx).WithFields(log.Fields{"error": err, "societiesPortalID": societiesPortalID}).Warn("Failed to delete Society")
+	}
+	return err
+}
+
+func (ds *SQLDatastore) GetSocietyAudit(ctx context.Context, societiesPortalID int32) ([]models.SocietyAuditEntry, error) {
+	ctx, cancel := context.WithTimeout(ctx, ds.queryTimeout)
+	defer cancel()
+
+	rows, err := ds.db.QueryContext(ctx, ds.rebind(`SELECT societies_portal_id, action, actor, changes, before_json, after_json, at
+		FROM society_audit WHERE societies_portal_id = ? ORDER BY at DESC`), societiesPortalID)
+	if err != nil {
+		logging.FromContext(ctx).WithField("error", err).Warn("Failed to query society audit entries")
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []models.SocietyAuditEntry{}
+	for rows.Next() {
+		var entry models.SocietyAuditEntry
+		var changes string
+		var before, after sql.NullString
+		var at int64
+		if err := rows.Scan(&entry.SocietiesPortalID, &entry.Action, &entry.Actor, &changes, &before, &after, &at); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(changes), &entry.Changes); err != nil {
+			return nil, err
+		}
+		if before.Valid {
+			if err := json.Unmarshal([]byte(before.String), &entry.Before); err != nil {
+				return nil, err
+			}
+		}
+		if after.Valid {
+			if err := json.Unmarshal([]byte(after.String), &entry.After); err != nil {
+				return nil, err
+			}
+		}
+		entry.At = time.Unix(0, at).UTC()
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+// Finds the society whose column has value, column must be a trusted name
+func (ds *SQLDatastore) findSociety(ctx context.Context, tx *sql.Tx, column string, value interface{}) (*models.Society, error) {
+	society, err := scanSociety(tx.QueryRowContext(ctx, ds.rebind(`SELECT `+societyColumns+` FROM societies WHERE `+column+` = ?`), value))
+	if err == sql.ErrNoRows {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &society, nil
+}
+
+func (ds *SQLDatastore) insertSociety(ctx context.Context, tx *sql.Tx, society models.Society, actor string) error {
+	values, err := societyValues(society)
+	if err != nil {
+		return err
+	}
+	if err := ds.checkSocietyUnique(ctx, tx, society, nil); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, ds.rebind(`INSERT INTO societies (`+societyColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?)`), values...)
+	if isUniqueViolation(err) {
+		return models.ErrConflict
+	}
+	if err != nil {
+		return err
+	}
+	return ds.recordSocietyAudit(ctx, tx, newSocietyAuditEntry(actor, nil, &society, time.Now().UTC()))
+}
+
+func (ds *SQLDatastore) replaceSociety(ctx context.Context, tx *sql.Tx, stored *models.Society, society models.Society, actor string) error {
+	values, err := societyValues(society)
+	if err != nil {
+		return err
+	}
+	if err := ds.checkSocietyUnique(ctx, tx, society, &stored.SocietiesPortalID); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, ds.rebind(`UPDATE societies SET
+		name = ?, societies_portal_id = ?, slug = ?, description = ?, website = ?, logo_url = ?, social_links = ?
+		WHERE societies_portal_id = ?`), append(values, stored.SocietiesPortalID)...)
+	if isUniqueViolation(err) {
+		return models.ErrConflict
+	}
+	if err != nil {
+		return err
+	}
+	return ds.recordSocietyAudit(ctx, tx, newSocietyAuditEntry(actor, stored, &society, time.Now().UTC()))
+}
+
+// Fails with models.ErrConflict if another society has the name or portal ID
+// of society. When replacing a society, existing is its current portal ID.
+func (ds *SQLDatastore) checkSocietyUnique(ctx context.Context, tx *sql.Tx, society models.Society, existing *int32) error {
+	query := `SELECT COUNT(*) FROM societies WHERE (name = ? OR societies_portal_id = ?)`
+	args := []interface{}{society.Name, society.SocietiesPortalID}
+	if existing != nil {
+		query += ` AND societies_portal_id <> ?`
+		args = append(args, *existing)
+	}
+
+	var count int
+	if err := tx.QueryRowContext(ctx, ds.rebind(query), args...).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return models.ErrConflict
+	}
+	return nil
+}
+
+func (ds *SQLDatastore) recordSocietyAudit(ctx context.Context, tx *sql.Tx, entry models.SocietyAuditEntry) error {
+	changes, err := json.Marshal(entry.Changes)
+	if err != nil {
+		return err
+	}
+	var before, after sql.NullString
+	if entry.Before != nil {
+		b, err := json.Marshal(entry.Before)
+		if err != nil {
+			return err
+		}
+		before = sql.NullString{String: string(b), Valid: true}
+	}
+	if entry.After != nil {
+		b, err := json.Marshal(entry.After)
+		if err != nil {
+			return err
+		}
+		after = sql.NullString{String: string(b), Valid: true}
+	}
+
+	_, err = tx.ExecContext(ctx, ds.rebind(`INSERT INTO society_audit (societies_portal_id, action, actor, changes, before_json, after_json, at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`), entry.SocietiesPortalID, entry.Action, entry.Actor, string(changes), before, after, entry.At.UnixNano())
+	return err
+}
+
+// Reports whether err is the database refusing to break a unique index, which
+// the checks before writing can miss when writes race
+func isUniqueViolation(err error) bool {
+	if err == nil {
+		return false
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "23505"
+	}
+	return strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
+
+/*
+ *	Society Proposals
+ */
+
+const proposalColumns = `societies_portal_id, name, event_count, first_seen, last_seen, status, decided_by, decided_at`
+
+func scanProposal(row rowScanner) (models.SocietyProposal, error) {
+	var proposal models.SocietyProposal
+	var firstSeen, lastSeen int64
+	var decidedAt sql.NullInt64
+	err := row.Scan(&proposal.SocietiesPortalID, &proposal.Name, &proposal.EventCount, &firstSeen, &lastSeen,
+		&proposal.Status, &proposal.DecidedBy, &decidedAt)
+	proposal.FirstSeen = time.Unix(0, firstSeen).UTC()
+	proposal.LastSeen = time.Unix(0, lastSeen).UTC()
+	if decidedAt.Valid {
+		t := time.Unix(0, decidedAt.Int64).UTC()
+		proposal.DecidedAt = &t
+	}
+	return proposal, err
+}
+
+func (ds *SQLDatastore) UpsertSocietyProposals(ctx context.Context, proposals []models.SocietyProposal) error {
+	ctx, cancel := context.WithTimeout(ctx, ds.queryTimeout)
+	defer cancel()
+
+	upsert := ds.rebind(`INSERT INTO society_proposals (societies_portal_id, name, event_count, first_seen, last_seen, status)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (societies_portal_id) DO UPDATE SET
+			name = excluded.name, event_count = excluded.event_count, last_seen = excluded.last_seen`)
+	err := ds.inTx(ctx, func(tx *sql.Tx) error {
+		for _, proposal := range proposals {
+			_, err := tx.ExecContext(ctx, upsert, proposal.SocietiesPortalID, proposal.Name, proposal.EventCount,
+				proposal.FirstSeen.UnixNano(), proposal.LastSeen.UnixNano(), models.ProposalPending)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logging.FromContext(ctx).WithField("error", err).Warn("Failed to upsert society proposals")
+		return err
+	}
+
+	return nil
+}
+
+func (ds *SQLDatastore) GetSocietyProposals(ctx context.Context, status string) ([]models.SocietyProposal, error) {
+	ctx, cancel := context.WithTimeout(ctx, ds.queryTimeout)
+	defer cancel()
+
+	query := `SELECT ` + proposalColumns + ` FROM society_proposals`
+	args := []interface{}{}
+	if status != "" {
+		query += ` WHERE status = ?`
+		args = append(args, status)
+	}
+	rows, err := ds.db.QueryContext(ctx, ds.rebind(query+` ORDER BY name`), args...)
+	if err != nil {
+		logging.FromContext(ctx).WithField("error", err).Warn("Failed to query society proposals")
+		return nil, err
+	}
+	defer rows.Close()
+
+	proposals := []models.SocietyProposal{}
+	for rows.Next() {
+		proposal, err := scanProposal(rows)
+		if err != nil {
+			return nil, err
+		}
+		proposals = append(proposals, proposal)
+	}
+
+	return proposals, rows.Err()
+}
+
+func (ds *SQLDatastore) GetSocietyProposal(ctx context.Context, societiesPortalID int32) (*models.SocietyProposal, error) {
+	ctx, cancel := context.WithTimeout(ctx, ds.queryTimeout)
+	defer cancel()
+
+	proposal, err := scanProposal(ds.db.QueryRowContext(ctx, ds.rebind(`SELECT `+proposalColumns+` FROM society_proposals WHERE societies_portal_id = ?`), societiesPortalID))
+	if err == sql.ErrNoRows {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		logging.FromContext(ctx).WithFields(log.Fields{"error": err, "societiesPortalID": societiesPortalID}).Warn("Failed to return single society proposal")
+		return nil, err
+	}
+
+	return &proposal, nil
+}
+
+func (ds *SQLDatastore) DecideSocietyProposal(ctx context.Context, societiesPortalID int32, status string, decidedBy string) error {
+	ctx, cancel := context.WithTimeout(ctx, ds.queryTimeout)
+	defer cancel()
+
+	result, err := ds.db.ExecContext(ctx, ds.rebind(`UPDATE society_proposals SET status = ?, decided_by = ?, decided_at = ?
+		WHERE societies_portal_id = ?`), status, decidedBy, time.Now().UnixNano(), societiesPortalID)
+	if err != nil {
+		logging.FromContext(ctx).WithFields(log.Fields{"error": err, "societiesPortalID": societiesPortalID}).Warn("Failed to decide society proposal")
+		return err
+	}
+	decided, err := result.RowsAffected()
+	if err == nil && decided == 0 {
+		return models.ErrNotFound
+	}
+
+	return err
+}
+
+/*
+ *	Job Runs
+ */
+
+const jobRunColumns = `job, trigger_type, triggered_by, replica, started_at, finished_at, outcome, counts, error`
+
+func scanJobRun(row rowScanner) (models.JobRun, error) {
+	var run models.JobRun
+	var counts string
+	var startedAt, finishedAt int64
+	if err := row.Scan(&run.Job, &run.Trigger, &run.TriggeredBy, &run.Replica, &startedAt, &finishedAt, &run.Outcome, &counts, &run.Error); err != nil {
+		return run, err
+	}
+	run.StartedAt = time.Unix(0, startedAt).UTC()
+	run.FinishedAt = time.Unix(0, finishedAt).UTC()
+	return run, json.Unmarshal([]byte(counts), &run.Counts)
+}
+
+func (ds *SQLDatastore) RecordJobRun(ctx context.Context, run models.JobRun) error {
+	ctx, cancel := context.WithTimeout(ctx, ds.queryTimeout)
+	defer cancel()
+
+	counts, err := json.Marshal(run.Counts)
+	if err != nil {
+		return err
+	}
+
+	_, err = ds.db.ExecContext(ctx, ds.rebind(`INSERT INTO job_runs (job, trigger_type, triggered_by, replica, started_at, finished_at, outcome, counts, error)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`), run.Job, run.Trigger, run.TriggeredBy, run.Replica, run.StartedAt.UnixNano(), run.FinishedAt.UnixNano(),
+		run.Outcome, string(counts), run.Error)
+	if err != nil {
+		logging.FromContext(ctx).WithFields(log.Fields{"error": err, "job": run.Job}).Warn("Failed to record job run")
+	}
+	return err
+}
+
+func (ds *SQLDatastore) GetJobRuns(ctx context.Context, job string, limit int64) ([]models.JobRun, error) {
+	ctx, cancel := context.WithTimeout(ctx, ds.queryTimeout)
+	defer cancel()
+
+	rows, err := ds.db.QueryContext(ctx, ds.rebind(`SELECT `+jobRunColumns+` FROM job_runs WHERE job = ? ORDER BY started_at DESC LIMIT ?`), job, limit)
+	if err != nil {
+		logging.FromContext(ctx).WithFields(log.Fields{"error": err, "job": job}).Warn("Failed to query job runs")
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := []models.JobRun{}
+	for rows.Next() {
+		run, err := scanJobRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+
+	return runs, rows.Err()
+}
+
+func (ds *SQLDatastore) GetLastJobRun(ctx context.Context, job string, outcome string) (*models.JobRun, error) {
+	ctx, cancel := context.WithTimeout(ctx, ds.queryTimeout)
+	defer cancel()
+
+	run, err := scanJobRun(ds.db.QueryRowContext(ctx, ds.rebind(`SELECT `+jobRunColumns+` FROM job_runs
+		WHERE job = ? AND outcome = ? ORDER BY started_at DESC LIMIT 1`), job, outcome))
+	if err == sql.ErrNoRows {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		logging.FromContext(ctx).WithFields(log.Fields{"error": err, "job": job}).Warn("Failed to return last job run")
+		return nil, err
+	}
+
+	return &run, nil
+}
+
+/*
+ *	Locks
+ */
+
+func (ds *SQLDatastore) AcquireLock(ctx context.Context, name string, holder string, ttl time.Duration) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, ds.queryTimeout)
+	defer cancel()
+
+	// Only takes the lock over from another holder once their lease lapses
+	now := time.Now()
+	result, err := ds.db.ExecContext(ctx, ds.rebind(`INSERT INTO locks (name, holder, acquired_at, expires_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET
+			holder = excluded.holder, acquired_at = excluded.acquired_at, expires_at = excluded.expires_at
+		WHERE locks.holder = excluded.holder OR locks.expires_at <= excluded.acquired_at`),
+		name, holder, now.UnixNano(), now.Add(ttl).UnixNano())
+	if err != nil {
+		logging.FromContext(ctx).WithFields(log.Fields{"error": err, "lock": name}).Warn("Failed to acquire lock")
+		return false, err
+	}
+	acquired, err := result.RowsAffected()
+	return acquired > 0, err
+}
+
+func (ds *SQLDatastore) RenewLock(ctx context.Context, name string, holder string, ttl time.Duration) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, ds.queryTimeout)
+	defer cancel()
+
+	result, err := ds.db.ExecContext(ctx, ds.rebind(`UPDATE locks SET expires_at = ? WHERE name = ? AND holder = ?`),
+		time.Now().Add(ttl).UnixNano(), name, holder)
+	if err != nil {
+		logging.FromContext(ctx).WithFields(log.Fields{"error": err, "lock": name}).Warn("Failed to renew lock")
+		return false, err
+	}
+	renewed, err := result.RowsAffected()
+	return renewed > 0, err
+}
+
+func (ds *SQLDatastore) ReleaseLock(ctx context.Context, name string, holder string) error {
+	ctx, cancel := context.WithTimeout(ctx, ds.queryTimeout)
+	defer cancel()
+
+	_, err := ds.db.ExecContext(ctx, ds.rebind(`DELETE FROM locks WHERE name = ? AND holder = ?`), name, holder)
+	if err != nil {
+		logging.FromContext(ctx).WithFields(log.Fields{"error": err, "lock": name}).Warn("Failed to release lock")
+	}
+	return err
+}
+
+func (ds *SQLDatastore) GetLock(ctx context.Context, name string) (*models.Lock, error) {
+	ctx, cancel := context.WithTimeout(ctx, ds.queryTimeout)
+	defer cancel()
+
+	lock := models.Lock{Name: name}
+	var acquiredAt, expiresAt int64
+	err := ds.db.QueryRowContext(ctx, ds.rebind(`SELECT holder, acquired_at, expires_at FROM locks WHERE name = ? AND expires_at > ?`),
+		name, time.Now().UnixNano()).Scan(&lock.Holder, &acquiredAt, &expiresAt)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		logging.FromContext(ctx).WithFields(log.Fields{"error": err, "lock": name}).Warn("Failed to return lock")
+		return nil, err
+	}
+	lock.AcquiredAt = time.Unix(0, acquiredAt).UTC()
+	lock.ExpiresAt = time.Unix(0, expiresAt).UTC()
+
+	return &lock, nil
+}
+
+/*
+ *	Events
+ */
+
+const eventColumns = `event_id, event_details_id, title, society_id, society_name, event_type,
+	location, location_type, description, description_markdown, dangerous_description_html,
+	start_datetime, end_datetime, datetime_formatted, event_url, event_ical_url, status,
+	sequence, updated_at, content_hash`
+
+func eventValues(e models.DatabaseEvent) []interface{} {
+	return []interface{}{
+		e.EventID, e.EventDetailsID, e.Title, e.SocietyID, e.SocietyName, e.EventType,
+		e.Location, e.LocationType, e.Description, e.DescriptionMarkdown, e.DangerousDescriptionHTML,
+		e.StartDatetime.UnixNano(), e.EndDatetime.UnixNano(), e.DatetimeFormatted, e.EventURL, e.EventICalURL, e.Status,
+		e.Sequence, e.UpdatedAt.UnixNano(), e.ContentHash,
+	}
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanEvent(row rowScanner) (models.DatabaseEvent, error) {
+	var e models.DatabaseEvent
+	var start, end, updatedAt int64
+	err := row.Scan(
+		&e.EventID, &e.EventDetailsID, &e.Title, &e.SocietyID, &e.SocietyName, &e.EventType,
+		&e.Location, &e.LocationType, &e.Description, &e.DescriptionMarkdown, &e.DangerousDescriptionHTML,
+		&start, &end, &e.DatetimeFormatted, &e.EventURL, &e.EventICalURL, &e.Status,
+		&e.Sequence, &updatedAt, &e.ContentHash,
+	)
+	e.StartDatetime = time.Unix(0, start).In(models.EventLocation)
+	e.EndDatetime = time.Unix(0, end).In(models.EventLocation)
+	e.UpdatedAt = time.Unix(0, updatedAt).UTC()
+	return e, err
+}
+
+func (ds *SQLDatastore) queryEvents(ctx context.Context, query string, args ...interface{}) ([]models.DatabaseEvent, error) {
+	rows, err := ds.db.QueryContext(ctx, ds.rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []models.DatabaseEvent{}
+	for rows.Next() {
+		event, err := scanEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+func (ds *SQLDatastore) UpsertEvents(ctx context.Context, events []models.DatabaseEvent) error {
+	ctx, cancel := context.WithTimeout(ctx, ds.queryTimeout)
+	defer cancel()
+
+	if len(events) == 0 {
+		return nil
+	}
+
+	updates := []string{}
+	for _, column := range strings.Split(eventColumns, ",") {
+		column = strings.TrimSpace(column)
+		if column != "event_id" && column != "event_details_id" {
+			updates = append(updates, column+" = excluded."+column)
+		}
+	}
+	upsert := ds.rebind(`INSERT INTO events (` + eventColumns + `)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (event_details_id, event_id) DO UPDATE SET ` + strings.Join(updates, ", "))
+	selectStored := ds.rebind(`SELECT ` + eventColumns + ` FROM events WHERE event_details_id = ? AND event_id = ?`)
+
+	err := ds.inTx(ctx, func(tx *sql.Tx) error {
+		now := time.Now().UTC()
+		for _, event := range events {
+			stored, err := scanEvent(tx.QueryRowContext(ctx, selectStored, event.EventDetailsID, event.EventID))
+			switch {
+			case err == sql.ErrNoRows:
+				event.Version(nil, now)
+			case err != nil:
+				return err
+			default:
+				event.Version(&stored, now)
+			}
+
+			if _, err := tx.ExecContext(ctx, upsert, eventValues(event)...); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logging.FromContext(ctx).WithField("error", err).Warn("Failed to upsert events into events table")
+		return err
+	}
+
+	logging.FromContext(ctx).Info("Number of events upserted: ", len(events))
+	return nil
+}
+
+func (ds *SQLDatastore) GetAllEvents(ctx context.Context, filter models.EventFilter) (*models.EventPage, error) {
+	page, err := ds.findEvents(ctx, nil, nil, filter)
+	if err != nil {
+		logging.FromContext(ctx).WithField("error", err).Warn("Failed to find all rows in events table")
+		return nil, err
+	}
+
+	return page, nil
+}
+
+func (ds *SQLDatastore) GetAllUpcomingEvents(ctx context.Context, filter models.EventFilter) (*models.EventPage, error) {
+	page, err := ds.findEvents(ctx, []string{"end_datetime >= ?"}, []interface{}{upcomingCutoff().UnixNano()}, filter)
+	if err != nil {
+		logging.FromContext(ctx).WithField("error", err).Warn("Failed to find all rows that are upcoming in events table")
+		return nil, err
+	}
+
+	return page, nil
+}
+
+func (ds *SQLDatastore) GetAllPastEvents(ctx context.Context, filter models.EventFilter) (*models.EventPage, error) {
+	page, err := ds.findEvents(ctx, []string{"end_datetime < ?"}, []interface{}{upcomingCutoff().UnixNano()}, filter)
+	if err != nil {
+		logging.FromContext(ctx).WithField("error", err).Warn("Failed to find all rows that are past in events table")
+		return nil, err
+	}
+
+	return page, nil
+}
+
+func (ds *SQLDatastore) GetAllUpcomingEventsForSocID(ctx context.Context, socID int, filter models.EventFilter) (*models.EventPage, error) {
+	page, err := ds.findEvents(ctx,
+		[]string{"end_datetime >= ?", "society_id = ?"},
+		[]interface{}{upcomingCutoff().UnixNano(), socID}, filter)
+	if err != nil {
+		logging.FromContext(ctx).WithFields(log.Fields{"error": err, "socID": socID}).Warn("Failed to find all rows for society that are upcoming in events table")
+		return nil, err
+	}
+
+	return page, nil
+}
+
+func (ds *SQLDatastore) GetAllPastEventsForSocID(ctx context.Context, socID int, filter models.EventFilter) (*models.EventPage, error) {
+	page, err := ds.findEvents(ctx,
+		[]string{"end_datetime < ?", "society_id = ?"},
+		[]interface{}{upcomingCutoff().UnixNano(), socID}, filter)
+	if err != nil {
+		logging.FromContext(ctx).WithFields(log.Fields{"error": err, "socID": socID}).Warn("Failed to find all rows for society that are past in events table")
+		return nil, err
+	}
+
+	return page, nil
+}
+
+// sqlEventFilterConditions translates filter into a WHERE clause, not
+// including the pagination cursor, in the same way as eventFilterConditions
+func sqlEventFilterConditions(conditions []string, args []interface{}, filter models.EventFilter) ([]string, []interface{}) {
+	if !filter.From.IsZero() {
+		conditions = append(conditions, "end_datetime >= ?")
+		args = append(args, filter.From.UnixNano())
+	}
+	if !filter.To.IsZero() {
+		conditions = append(conditions, "start_datetime <= ?")
+		args = append(args, filter.To.UnixNano())
+	}
+
+	in := func(column string, n int) string {
+		return column + " IN (" + strings.TrimSuffix(strings.Repeat("?, ", n), ", ") + ")"
+	}
+	if len(filter.SocietyIDs) > 0 {
+		conditions = append(conditions, in("society_id", len(filter.SocietyIDs)))
+		for _, id := range filter.SocietyIDs {
+			args = append(args, id)
+		}
+	}
+	if len(filter.LocationTypes) > 0 {
+		conditions = append(conditions, in("location_type", len(filter.LocationTypes)))
+		for _, locationType := range filter.LocationTypes {
+			args = append(args, locationType)
+		}
+	}
+	if len(filter.EventTypes) > 0 {
+		conditions = append(conditions, in("event_type", len(filter.EventTypes)))
+		for _, eventType := range filter.EventTypes {
+			args = append(args, eventType)
+		}
+	}
+
+	return conditions, args
+}
+
+func where(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conditions, " AND ")
+}
+
+// findEvents returns a page of events matching both conditions and filter,
+// along with the total number of matching events across all pages
+func (ds *SQLDatastore) findEvents(ctx context.Context, conditions []string, args []interface{}, filter models.EventFilter) (*models.EventPage, error) {
+	ctx, cancel := context.WithTimeout(ctx, ds.queryTimeout)
+	defer cancel()
+
+	conditions, args = sqlEventFilterConditions(conditions, args, filter)
+
+	var total int64
+	err := ds.db.QueryRowContext(ctx, ds.rebind(`SELECT COUNT(*) FROM events`+where(conditions)), args...).Scan(&total)
+	if err != nil {
+		return nil, err
+	}
+
+	order, op := "ASC", ">"
+	if filter.Descending {
+		order, op = "DESC", "<"
+	}
+	if filter.After != nil {
+		conditions = append(conditions, "(start_datetime, event_details_id, event_id) "+op+" (?, ?, ?)")
+		args = append(args, filter.After.StartDatetime.UnixNano(), filter.After.EventDetailsID, filter.After.EventID)
+	}
+
+	query := `SELECT ` + eventColumns + ` FROM events` + where(conditions) +
+		` ORDER BY start_datetime ` + order + `, event_details_id ` + order + `, event_id ` + order
+	if filter.Limit > 0 {
+		// Fetch one extra so we know whether there's another page
+		query += ` LIMIT ?`
+		args = append(args, filter.Limit+1)
+	}
+
+	events, err := ds.queryEvents(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &models.EventPage{Total: total, Events: events}
+	if filter.Limit > 0 && int64(len(events)) > filter.Limit {
+		page.Events = events[:filter.Limit]
+		page.NextCursor = page.Events[len(page.Events)-1].CursorAfter().Encode()
+	}
+
+	return page, nil
+}
+
+// SearchEvents ranks the events matching filter in Go, as neither database
+// has a full-text search that behaves like Mongo's. There are few enough
+// events that this is quick.
+func (ds *SQLDatastore) SearchEvents(ctx context.Context, query string, filter models.EventFilter) (*models.EventSearchPage, error) {
+	ctx, cancel := context.WithTimeout(ctx, ds.queryTimeout)
+	defer cancel()
+
+	conditions, args := sqlEventFilterConditions(nil, nil, filter)
+	candidates, err := ds.queryEvents(ctx, `SELECT `+eventColumns+` FROM events`+where(conditions), args...)
+	if err != nil {
+		logging.FromContext(ctx).WithFields(log.Fields{"error": err, "query": query}).Warn("Failed to search events table")
+		return nil, err
+	}
+
+	return rankSearchResults(candidates, query, filter), nil
+}
+
+// GetEventByEventDetailsID prefers the next instance of a recurring event
+// that hasn't finished, falling back to the most recent one
+func (ds *SQLDatastore) GetEventByEventDetailsID(ctx context.Context, eventDetailsID int) (*models.DatabaseEvent, error) {
+	ctx, cancel := context.WithTimeout(ctx, ds.queryTimeout)
+	defer cancel()
+
+	event, err := scanEvent(ds.db.QueryRowContext(ctx, ds.rebind(`SELECT `+eventColumns+` FROM events
+		WHERE event_details_id = ? AND end_datetime >= ?
+		ORDER BY start_datetime ASC LIMIT 1`), eventDetailsID, upcomingCutoff().UnixNano()))
+	if err == sql.ErrNoRows {
+		event, err = scanEvent(ds.db.QueryRowContext(ctx, ds.rebind(`SELECT `+eventColumns+` FROM events
+			WHERE event_details_id = ?
+			ORDER BY start_datetime DESC LIMIT 1`), eventDetailsID))
+	}
+	if err == sql.ErrNoRows {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		logging.FromContext(ctx).WithFields(log.Fields{"error": err, "eventDetailsID": eventDetailsID}).Warn("Failed to return single event from events table")
+		return nil, err
+	}
+
+	return &event, nil
+}
+
+func (ds *SQLDatastore) GetEventByEventID(ctx context.Context, eventDetailsID int, eventID int) (*models.DatabaseEvent, error) {
+	ctx, cancel := context.WithTimeout(ctx, ds.queryTimeout)
+	defer cancel()
+
+	event, err := scanEvent(ds.db.QueryRowContext(ctx, ds.rebind(`SELECT `+eventColumns+` FROM events
+		WHERE event_details_id = ? AND event_id = ?`), eventDetailsID, eventID))
+	if err == sql.ErrNoRows {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		logging.FromContext(ctx).WithFields(log.Fields{"error": err, "eventDetailsID": eventDetailsID, "eventID": eventID}).Warn("Failed to return single event from events table")
+		return nil, err
+	}
+
+	return &event, nil
+}
+
+/*
+ *	Stats
+ */
+
+// Stats are tallied in Go rather than SQL, as grouping by month and weekday
+// in the portal's timezone differs too much between SQLite and PostgreSQL
+func (ds *SQLDatastore) GetSocietyStats(ctx context.Context, socID int, filter models.EventFilter) (*models.SocietyStats, error) {
+	ctx, cancel := context.WithTimeout(ctx, ds.queryTimeout)
+	defer cancel()
+
+	filter.SocietyIDs = []int{socID}
+	conditions, args := sqlEventFilterConditions(nil, nil, filter)
+	events, err := ds.queryEvents(ctx, `SELECT `+eventColumns+` FROM events`+where(conditions), args...)
+	if err != nil {
+		logging.FromContext(ctx).WithFields(log.Fields{"error": err, "socID": socID}).Warn("Failed to query events table for society stats")
+		return nil, err
+	}
+
+	return societyStatsFromEvents(socID, events, upcomingCutoff()), nil
+}
+
+func (ds *SQLDatastore) GetSocietyLeaderboard(ctx context.Context, filter models.EventFilter) ([]models.SocietyRanking, error) {
+	ctx, cancel := context.WithTimeout(ctx, ds.queryTimeout)
+	defer cancel()
+
+	conditions, args := sqlEventFilterConditions(nil, nil, filter)
+	events, err := ds.queryEvents(ctx, `SELECT `+eventColumns+` FROM events`+where(conditions), args...)
+	if err != nil {
+		logging.FromContext(ctx).WithField("error", err).Warn("Failed to query events table for the society leaderboard")
+		return nil, err
+	}
+
+	return leaderboardFromEvents(events, upcomingCutoff(), filter.Limit), nil
+}
@@ -0,0 +1,138 @@
+package services
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nuigcompsoc/api/internal/models"
+)
+
+// Months are keyed as YYYY-MM, as $dateToString formats them with this
+const statsMonthFormat = "2006-01"
+
+// Tallies events into stats in Go, in the same way the Mongo aggregation in
+// MongoDatastore.GetSocietyStats does
+func societyStatsFromEvents(socID int, events []models.DatabaseEvent, cutoff time.Time) *models.SocietyStats {
+	stats := newSocietyStats(socID)
+	months := map[string]int{}
+	weekdays := map[time.Weekday]int{}
+	var duration time.Duration
+	for _, event := range events {
+		if event.SocietyID != socID || event.Cancelled() {
+			continue
+		}
+
+		stats.Events++
+		if !event.EndDatetime.Before(cutoff) {
+			stats.UpcomingEvents++
+		}
+		start := event.StartDatetime.In(models.EventLocation)
+		months[start.Format(statsMonthFormat)]++
+		weekdays[start.Weekday()]++
+		stats.EventsPerType[event.EventType]++
+		stats.EventsPerLocationType[event.LocationType]++
+		duration += event.EndDatetime.Sub(event.StartDatetime)
+	}
+
+	if stats.Events > 0 {
+		stats.AverageDurationMinutes = duration.Minutes() / float64(stats.Events)
+	}
+	stats.EventsPerMonth = monthCounts(months)
+	stats.BusiestWeekday = busiestWeekday(weekdays)
+	return stats
+}
+
+// Ranks the societies running events in Go, in the same way the Mongo
+// aggregation in MongoDatastore.GetSocietyLeaderboard does
+func leaderboardFromEvents(events []models.DatabaseEvent, cutoff time.Time, limit int64) []models.SocietyRanking {
+	rankings := map[int]*models.SocietyRanking{}
+	latest := map[int]time.Time{}
+	durations := map[int]time.Duration{}
+	for _, event := range events {
+		if event.Cancelled() {
+			continue
+		}
+
+		ranking, ok := rankings[event.SocietyID]
+		if !ok {
+			ranking = &models.SocietyRanking{SocietyID: event.SocietyID}
+			rankings[event.SocietyID] = ranking
+		}
+		// Societies are named as they were on their most recent event
+		if !event.StartDatetime.Before(latest[event.SocietyID]) {
+			ranking.SocietyName = event.SocietyName
+			latest[event.SocietyID] = event.StartDatetime
+		}
+		ranking.Events++
+		if !event.EndDatetime.Before(cutoff) {
+			ranking.UpcomingEvents++
+		}
+		durations[event.SocietyID] += event.EndDatetime.Sub(event.StartDatetime)
+	}
+
+	unranked := []models.SocietyRanking{}
+	for socID, ranking := range rankings {
+		ranking.AverageDurationMinutes = durations[socID].Minutes() / float64(ranking.Events)
+		unranked = append(unranked, *ranking)
+	}
+	return rankSocieties(unranked, limit)
+}
+
+func newSocietyStats(socID int) *models.SocietyStats {
+	return &models.SocietyStats{
+		SocietyID:             socID,
+		EventsPerMonth:        []models.MonthCount{},
+		EventsPerType:         map[string]int{},
+		EventsPerLocationType: map[string]int{},
+	}
+}
+
+func monthCounts(months map[string]int) []models.MonthCount {
+	counts := []models.MonthCount{}
+	for month, events := range months {
+		counts = append(counts, models.MonthCount{Month: month, Events: events})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		return counts[i].Month < counts[j].Month
+	})
+	return counts
+}
+
+// Ties go to the day earliest in the week, weeks starting on Monday
+func busiestWeekday(weekdays map[time.Weekday]int) string {
+	busiest, most := "", 0
+	for _, day := range []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday, time.Sunday} {
+		if weekdays[day] > most {
+			busiest, most = day.String(), weekdays[day]
+		}
+	}
+	return busiest
+}
+
+// Orders societies by how many events they ran, then by name, and ranks them.
+// Only the first limit are kept unless limit is zero.
+func rankSocieties(rankings []models.SocietyRanking, limit int64) []models.SocietyRanking {
+	sort.Slice(rankings, func(i, j int) bool {
+		a, b := rankings[i], rankings[j]
+		if a.Events != b.Events {
+			return a.Events > b.Events
+		}
+		if nameA, nameB := strings.ToLower(a.SocietyName), strings.ToLower(b.SocietyName); nameA != nameB {
+			return nameA < nameB
+		}
+		return a.SocietyID < b.SocietyID
+	})
+
+	for i := range rankings {
+		rankings[i].Rank = i + 1
+		if i > 0 && rankings[i].Events == rankings[i-1].Events {
+			rankings[i].Rank = rankings[i-1].Rank
+		}
+	}
+
+	if limit > 0 && int64(len(rankings)) > limit {
+		rankings = rankings[:limit]
+	}
+	return rankings
+}
@@ -0,0 +1,177 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/nuigcompsoc/api/internal/models"
+)
+
+// EventStore keeps the events synced from the societies portal. Events that
+// don't exist are reported with models.ErrNotFound.
+type EventStore interface {
+	// UpsertEvents stores events, versioning them against any stored copies
+	UpsertEvents(ctx context.Context, events []models.DatabaseEvent) error
+
+	GetAllEvents(ctx context.Context, filter models.EventFilter) (*models.EventPage, error)
+	// Upcoming events include those that ended at most an hour ago
+	GetAllUpcomingEvents(ctx context.Context, filter models.EventFilter) (*models.EventPage, error)
+	GetAllPastEvents(ctx context.Context, filter models.EventFilter) (*models.EventPage, error)
+	GetAllUpcomingEventsForSocID(ctx context.Context, socID int, filter models.EventFilter) (*models.EventPage, error)
+	GetAllPastEventsForSocID(ctx context.Context, socID int, filter models.EventFilter) (*models.EventPage, error)
+	SearchEvents(ctx context.Context, query string, filter models.EventFilter) (*models.EventSearchPage, error)
+
+	GetEventByEventDetailsID(ctx context.Context, eventDetailsID int) (*models.DatabaseEvent, error)
+	GetEventByEventID(ctx context.Context, eventDetailsID int, eventID int) (*models.DatabaseEvent, error)
+}
+
+// StatsStore sums up the stored events. Cancelled events aren't counted, and
+// events are upcoming as they are for EventStore.
+type StatsStore interface {
+	// GetSocietyStats sums up the events of the society with socID that match
+	// filter, ignoring its society IDs and paging
+	GetSocietyStats(ctx context.Context, socID int, filter models.EventFilter) (*models.SocietyStats, error)
+	// GetSocietyLeaderboard ranks societies by how many of their events match
+	// filter, ignoring its paging other than keeping at most filter.Limit
+	GetSocietyLeaderboard(ctx context.Context, filter models.EventFilter) ([]models.SocietyRanking, error)
+}
+
+// SocietyStore keeps the societies whose events we sync. Societies are
+// identified by their societies portal ID, and their names are unique too;
+// writes that would break that are reported with models.ErrConflict. Every
+// write that changes a society is recorded in its audit log under actor.
+type SocietyStore interface {
+	// UpsertSociety stores society by name, keeping any stored metadata it
+	// leaves empty. It reports whether anything changed.
+	UpsertSociety(ctx context.Context, society models.Society, actor string) (bool, error)
+	// GetAllSocieties returns every society keyed by name
+	GetAllSocieties(ctx context.Context) (map[string]models.Society, error)
+	GetSocietyBySocietyName(ctx context.Context, societyName string) (*models.Society, error)
+	GetSocietyBySocietiesPortalID(ctx context.Context, societiesPortalID int32) (*models.Society, error)
+
+	CreateSociety(ctx context.Context, society models.Society, actor string) error
+	// UpdateSociety replaces the society with societiesPortalID, which may
+	// be given a new ID. It reports whether anything changed.
+	UpdateSociety(ctx context.Context, societiesPortalID int32, society models.Society, actor string) (bool, error)
+	DeleteSociety(ctx context.Context, societiesPortalID int32, actor string) error
+
+	// GetSocietyAudit returns the audit log of the society with
+	// societiesPortalID, newest first
+	GetSocietyAudit(ctx context.Context, societiesPortalID int32) ([]models.SocietyAuditEntry, error)
+}
+
+// SocietyProposalStore keeps the societies discovered on the societies
+// portal until an admin decides whether to track them
+type SocietyProposalStore interface {
+	// UpsertSocietyProposals adds new proposals as pending, and refreshes the
+	// name, event count and last seen time of ones already stored without
+	// changing what was decided about them
+	UpsertSocietyProposals(ctx context.Context, proposals []models.SocietyProposal) error
+	// GetSocietyProposals returns proposals ordered by name, only those with
+	// status unless it's empty
+	GetSocietyProposals(ctx context.Context, status string) ([]models.SocietyProposal, error)
+	GetSocietyProposal(ctx context.Context, societiesPortalID int32) (*models.SocietyProposal, error)
+	DecideSocietyProposal(ctx context.Context, societiesPortalID int32, status string, decidedBy string) error
+}
+
+// JobRunStore keeps the history of the scheduler's job runs
+type JobRunStore interface {
+	RecordJobRun(ctx context.Context, run models.JobRun) error
+	// GetJobRuns returns the most recent runs of job, at most limit of them,
+	// newest first
+	GetJobRuns(ctx context.Context, job string, limit int64) ([]models.JobRun, error)
+	// GetLastJobRun returns the most recent run of job that ended with
+	// outcome, models.ErrNotFound if there isn't one
+	GetLastJobRun(ctx context.Context, job string, outcome string) (*models.JobRun, error)
+}
+
+// LockStore leases locks to replicas of the API, so that only one of them
+// does something at a time. Leases lapse unless they're renewed, so that the
+// locks of replicas that die are taken over.
+type LockStore interface {
+	// AcquireLock leases the lock called name to holder for ttl, if no one
+	// else holds it or their lease has lapsed, starting a new lease if holder
+	// already has one. It reports whether holder got the lock.
+	AcquireLock(ctx context.Context, name string, holder string, ttl time.Duration) (bool, error)
+	// RenewLock extends holder's lease by ttl from now. It reports false if
+	// the lock has been taken over or released.
+	RenewLock(ctx context.Context, name string, holder string, ttl time.Duration) (bool, error)
+	// ReleaseLock gives up holder's lease, doing nothing if it's no longer
+	// holder's
+	ReleaseLock(ctx context.Context, name string, holder string) error
+	// GetLock returns the lease on the lock called name, models.ErrNotFound
+	// if no one holds it or the lease has lapsed
+	GetLock(ctx context.Context, name string) (*models.Lock, error)
+}
+
+// Datastore is everything the API persists
+type Datastore interface {
+	EventStore
+	StatsStore
+	SocietyStore
+	SocietyProposalStore
+	JobRunStore
+	LockStore
+
+	// Ping checks the datastore is reachable
+	Ping(ctx context.Context) error
+	// Migrate brings the schema up to date, creating indexes and transforming
+	// what's already stored
+	Migrate(ctx context.Context) error
+	// Close disconnects from the datastore, it can't be used afterwards
+	Close(ctx context.Context) error
+}
+
+var (
+	_ Datastore = (*MongoDatastore)(nil)
+	_ Datastore = (*SQLDatastore)(nil)
+	_ Datastore = (*MemoryDatastore)(nil)
+)
+
+// Events ending after this are upcoming, so events stay listed for an hour
+// after they finish
+func upcomingCutoff() time.Time {
+	return time.Now().Add(-time.Hour)
+}
+
+// Fills in the metadata society leaves empty from the stored copy, as $set
+// does in Mongo, so that syncing a society doesn't wipe out its metadata
+func mergeSocietyMetadata(society models.Society, stored models.Society) models.Society {
+	if society.Slug == "" {
+		society.Slug = stored.Slug
+	}
+	if society.Description == "" {
+		society.Description = stored.Description
+	}
+	if society.Website == "" {
+		society.Website = stored.Website
+	}
+	if society.LogoURL == "" {
+		society.LogoURL = stored.LogoURL
+	}
+	if len(society.SocialLinks) == 0 {
+		society.SocialLinks = stored.SocialLinks
+	}
+	return society
+}
+
+// Describes a change to a society for its audit log. before is nil when the
+// society was created, and after is nil when it was deleted.
+func newSocietyAuditEntry(actor string, before *models.Society, after *models.Society, now time.Time) models.SocietyAuditEntry {
+	entry := models.SocietyAuditEntry{Actor: actor, Before: before, After: after, At: now}
+	switch {
+	case before == nil:
+		entry.Action = models.SocietyCreated
+		entry.SocietiesPortalID = after.SocietiesPortalID
+		entry.Changes = models.Society{}.ChangedFields(*after)
+	case after == nil:
+		entry.Action = models.SocietyDeleted
+		entry.SocietiesPortalID = before.SocietiesPortalID
+		entry.Changes = before.ChangedFields(models.Society{})
+	default:
+		entry.Action = models.SocietyUpdated
+		entry.SocietiesPortalID = after.SocietiesPortalID
+		entry.Changes = before.ChangedFields(*after)
+	}
+	return entry
+}